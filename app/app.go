@@ -3,7 +3,9 @@ package app
 import (
 	"app/config"
 	"app/db"
+	"app/jobs"
 	"app/models"
+	"app/scheduler"
 	"app/worker"
 	"context"
 	"errors"
@@ -48,6 +50,10 @@ func Start(e *echo.Echo) error {
 		})
 	}
 
+	workerWg.Go(func() {
+		scheduler.StartScheduler(workerCtx)
+	})
+
 	err = pgdriver.Notify(workerCtx, db.Bun, "jobs:updated", "")
 	if err != nil {
 		slog.Error("failed to notify jobs:updated", "error", err)
@@ -96,6 +102,7 @@ func RunBackgroundCleanUp(ctx context.Context) {
 			case <-ticker.C:
 				slog.Info("running background cleanup")
 				_ = models.DeleteExpiredUsers(ctx)
+				_ = jobs.DeleteExpiredArchives(ctx)
 			}
 		}
 	}()
@@ -7,4 +7,15 @@ import (
 
 func RegisterJobs() {
 	worker.RegisterJob(jobs.MigrateMailboxType, jobs.MigrateMailboxFactory)
+	worker.RegisterJob(jobs.DeliverWebhookType, jobs.DeliverWebhookFactory)
+	worker.RegisterJob(jobs.SendEmailType, jobs.SendEmailFactory)
+	worker.RegisterJob(jobs.PlanSyncListType, jobs.PlanSyncListFactory)
+	worker.RegisterJob(jobs.VerifySyncListType, jobs.VerifySyncListFactory)
+	worker.RegisterJob(jobs.ImportArchiveType, jobs.ImportArchiveFactory)
+	worker.RegisterJob(jobs.ExportArchiveType, jobs.ExportArchiveFactory)
+	worker.RegisterLongRunningJob(jobs.LiveSyncType, jobs.LiveSyncFactory)
+
+	worker.RegisterJobListener(jobs.DispatchJobEvent)
+	worker.RegisterJobListener(jobs.NotifyMigrationFinished)
+	worker.RegisterJobListener(jobs.CompleteCutOver)
 }
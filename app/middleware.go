@@ -48,6 +48,11 @@ func RegisterMiddleware(e *echo.Echo) {
 	}))
 	e.Use(middleware.Recover())
 	e.Use(middleware.Secure())
-	e.Use(middleware.CSRF())
+	e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+		// token authenticated requests carry no session cookie to protect
+		Skipper: func(c *echo.Context) bool {
+			return helpers.IsApiRequest(c) || helpers.HasBearerToken(c)
+		},
+	}))
 	e.Use(session.Middleware(helpers.SessionStore))
 }
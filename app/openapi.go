@@ -0,0 +1,106 @@
+package app
+
+import (
+	"app/config"
+	"app/handlers"
+	"app/helpers"
+	"app/models"
+	"app/openapi"
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+// documentedRoutes lists the routes that serve JSON, either always (/api/v1)
+// or when the request sends "Accept: application/json".
+var documentedRoutes = []openapi.Route{
+	{Method: http.MethodGet, Path: "/app/sync-lists", Summary: "List sync lists", Tag: "sync-lists", Query: []string{"page"}, Response: handlers.SyncListsResponse{}},
+	{Method: http.MethodPost, Path: "/app/sync-lists", Summary: "Create a sync list", Tag: "sync-lists", Request: handlers.SyncListRequest{}, Response: handlers.SyncListResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/app/sync-lists/:id", Summary: "Show a sync list with a page of its mailboxes", Tag: "sync-lists", Query: []string{"page"}, Response: handlers.SyncListShowResponse{}},
+	{Method: http.MethodPut, Path: "/app/sync-lists/:id", Summary: "Update a sync list", Tag: "sync-lists", Request: handlers.SyncListRequest{}, Response: handlers.SyncListResponse{}},
+	{Method: http.MethodDelete, Path: "/app/sync-lists/:id", Summary: "Delete a sync list", Tag: "sync-lists", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:id/mailboxes", Summary: "Add a mailbox", Tag: "mailboxes", Request: handlers.MailboxCreateRequest{}, Response: handlers.MailboxResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/app/sync-lists/:listId/mailboxes/:id", Summary: "Update a mailbox", Tag: "mailboxes", Request: handlers.MailboxUpdateRequest{}, Response: handlers.MailboxResponse{}},
+	{Method: http.MethodDelete, Path: "/app/sync-lists/:listId/mailboxes/:id", Summary: "Delete a mailbox", Tag: "mailboxes", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:id/migrate/start", Summary: "Start migration for every mailbox", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:id/migrate/stop", Summary: "Stop migration for every mailbox", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodDelete, Path: "/app/sync-lists/:id/migrate", Summary: "Delete the jobs of every mailbox", Tag: "jobs", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:listId/mailboxes/:id/migrate/start", Summary: "Start migration for a mailbox", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:listId/mailboxes/:id/migrate/stop", Summary: "Stop migration for a mailbox", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodDelete, Path: "/app/sync-lists/:listId/mailboxes/:id/migrate", Summary: "Delete the job of a mailbox", Tag: "jobs", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:id/final-sync", Summary: "Run the final sync and cut the sync list over", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:id/plan", Summary: "Plan a dry run of the migration", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:id/verify", Summary: "Verify the destination against the source", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:id/live-sync/start", Summary: "Start live sync for every mailbox", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/app/sync-lists/:id/live-sync/stop", Summary: "Stop live sync", Tag: "jobs", Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: "/app/sync-lists/:id/reports", Summary: "List reports of a sync list", Tag: "reports", Query: []string{"page"}, Response: handlers.ReportsResponse{}},
+	{Method: http.MethodGet, Path: "/app/sync-lists/:listId/reports/:id", Summary: "Show a report", Tag: "reports", Response: handlers.ReportResponse{}},
+
+	{Method: http.MethodGet, Path: "/api/v1/sync-lists", Summary: "List sync lists", Tag: "api", Query: []string{"page"}, Response: handlers.SyncListsResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists", Summary: "Create a sync list", Tag: "api", Request: handlers.SyncListRequest{}, Response: handlers.SyncListResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/api/v1/sync-lists/:id", Summary: "Show a sync list", Tag: "api", Response: handlers.SyncListResponse{}},
+	{Method: http.MethodPut, Path: "/api/v1/sync-lists/:id", Summary: "Update a sync list", Tag: "api", Request: handlers.SyncListRequest{}, Response: handlers.SyncListResponse{}},
+	{Method: http.MethodDelete, Path: "/api/v1/sync-lists/:id", Summary: "Delete a sync list", Tag: "api", Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/v1/sync-lists/:id/progress", Summary: "Show migration progress of a sync list", Tag: "api", Response: handlers.SyncListProgressResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:id/migrate/start", Summary: "Start migration for every mailbox", Tag: "api", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:id/migrate/stop", Summary: "Stop migration for every mailbox", Tag: "api", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:id/final-sync", Summary: "Run the final sync and cut the sync list over", Tag: "api", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:id/plan", Summary: "Plan a dry run of the migration", Tag: "api", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:id/verify", Summary: "Verify the destination against the source", Tag: "api", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:id/live-sync/start", Summary: "Start live sync for every mailbox", Tag: "api", Request: handlers.LiveSyncRequest{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:id/live-sync/stop", Summary: "Stop live sync", Tag: "api", Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: "/api/v1/sync-lists/:id/mailboxes", Summary: "List mailboxes", Tag: "api", Query: []string{"page"}, Response: handlers.MailboxesResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:id/mailboxes", Summary: "Add a mailbox", Tag: "api", Request: handlers.MailboxCreateRequest{}, Response: handlers.MailboxResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/api/v1/sync-lists/:listId/mailboxes/:id", Summary: "Show a mailbox with its job", Tag: "api", Response: handlers.MailboxProgressResponse{}},
+	{Method: http.MethodPut, Path: "/api/v1/sync-lists/:listId/mailboxes/:id", Summary: "Update a mailbox", Tag: "api", Request: handlers.MailboxUpdateRequest{}, Response: handlers.MailboxResponse{}},
+	{Method: http.MethodDelete, Path: "/api/v1/sync-lists/:listId/mailboxes/:id", Summary: "Delete a mailbox", Tag: "api", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:listId/mailboxes/:id/migrate/start", Summary: "Start migration for a mailbox", Tag: "api", Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/api/v1/sync-lists/:listId/mailboxes/:id/migrate/stop", Summary: "Stop migration for a mailbox", Tag: "api", Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: "/api/v1/jobs", Summary: "List jobs", Tag: "api", Query: []string{"page"}, Response: handlers.JobsResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/jobs/:id", Summary: "Show a job", Tag: "api", Response: handlers.JobResponse{}},
+}
+
+func BuildOpenApiDocument() *openapi.Document {
+	doc := openapi.New(config.Config.AppName, "v1")
+	doc.SetProblemType(helpers.ProblemDetails{})
+	doc.RegisterEnum(models.JobStatus(""),
+		string(models.JobStatusNone),
+		string(models.JobStatusPending),
+		string(models.JobStatusRunning),
+		string(models.JobStatusInterrupted),
+		string(models.JobStatusCompleted),
+		string(models.JobStatusFailed),
+	)
+
+	doc.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{
+		Type:   "http",
+		Scheme: "bearer",
+	}
+	doc.Components.SecuritySchemes["cookieAuth"] = &openapi.SecurityScheme{
+		Type: "apiKey",
+		In:   "cookie",
+		Name: helpers.GetSessionKey(),
+	}
+	doc.Security = []map[string][]string{
+		{"bearerAuth": {}},
+		{"cookieAuth": {}},
+	}
+
+	for _, route := range documentedRoutes {
+		doc.AddRoute(route)
+	}
+
+	return doc
+}
+
+func openApiHandler() echo.HandlerFunc {
+	body, err := json.Marshal(BuildOpenApiDocument())
+	if err != nil {
+		panic(err)
+	}
+
+	return func(c *echo.Context) error {
+		return c.JSONBlob(http.StatusOK, body)
+	}
+}
@@ -12,6 +12,8 @@ import (
 )
 
 func RegisterRoutes(e *echo.Echo) {
+	e.GET("/openapi.json", openApiHandler())
+
 	aa := e.Group("")
 	aa.Use(middlewarex.WithAuthAny)
 	aa.GET("/", func(c *echo.Context) error {
@@ -47,7 +49,14 @@ func RegisterRoutes(e *echo.Echo) {
 
 	ar.GET("/app/sync-lists/:id/mailboxes/new", handlers.MailboxNew)
 	ar.POST("/app/sync-lists/:id/mailboxes", handlers.MailboxCreate)
+	ar.GET("/app/sync-lists/:listId/mailboxes/:id/edit", handlers.MailboxEdit)
+	ar.PUT("/app/sync-lists/:listId/mailboxes/:id", handlers.MailboxUpdate)
 	ar.DELETE("/app/sync-lists/:listId/mailboxes/:id", handlers.MailboxDelete)
+	ar.GET("/app/sync-lists/:listId/mailboxes/:id/archives", handlers.ArchiveIndex)
+	ar.POST("/app/sync-lists/:listId/mailboxes/:id/imports", handlers.ArchiveImport)
+	ar.POST("/app/sync-lists/:listId/mailboxes/:id/exports", handlers.ArchiveExport)
+	ar.GET("/app/sync-lists/:listId/mailboxes/:id/archives/:archiveId/download", handlers.ArchiveDownload)
+	ar.DELETE("/app/sync-lists/:listId/mailboxes/:id/archives/:archiveId", handlers.ArchiveDelete)
 
 	ar.POST("/app/sync-lists/:id/migrate/start", handlers.SyncListJobMigrateStart)
 	ar.POST("/app/sync-lists/:id/migrate/stop", handlers.SyncListJobMigrateStop)
@@ -55,4 +64,53 @@ func RegisterRoutes(e *echo.Echo) {
 	ar.POST("/app/sync-lists/:listId/mailboxes/:id/migrate/start", handlers.MailboxJobMigrateStart)
 	ar.POST("/app/sync-lists/:listId/mailboxes/:id/migrate/stop", handlers.MailboxJobMigrateStop)
 	ar.DELETE("/app/sync-lists/:listId/mailboxes/:id/migrate", handlers.MailboxDeleteJob)
+	ar.POST("/app/sync-lists/:id/final-sync", handlers.SyncListFinalSyncStart)
+	ar.POST("/app/sync-lists/:id/plan", handlers.SyncListPlanStart)
+	ar.POST("/app/sync-lists/:id/verify", handlers.SyncListVerifyStart)
+	ar.POST("/app/sync-lists/:id/live-sync/start", handlers.SyncListLiveSyncStart)
+	ar.POST("/app/sync-lists/:id/live-sync/stop", handlers.SyncListLiveSyncStop)
+
+	ar.GET("/app/sync-lists/:id/reports", handlers.ReportIndex)
+	ar.GET("/app/sync-lists/:listId/reports/:id", handlers.ReportShow)
+
+	ar.GET("/app/api-tokens", handlers.ApiTokenIndex)
+	ar.GET("/app/api-tokens/new", handlers.ApiTokenNew)
+	ar.POST("/app/api-tokens", handlers.ApiTokenCreate)
+	ar.DELETE("/app/api-tokens/:id", handlers.ApiTokenDelete)
+
+	ar.GET("/app/settings", handlers.SettingsShow)
+	ar.PUT("/app/settings", handlers.SettingsUpdate)
+
+	ar.GET("/app/webhooks", handlers.WebhookIndex)
+	ar.GET("/app/webhooks/new", handlers.WebhookNew)
+	ar.POST("/app/webhooks", handlers.WebhookCreate)
+	ar.GET("/app/webhooks/:id", handlers.WebhookShow)
+	ar.DELETE("/app/webhooks/:id", handlers.WebhookDelete)
+
+	api := e.Group("/api/v1")
+	api.Use(middlewarex.WithApiTokenRequired)
+	api.GET("/sync-lists", handlers.ApiSyncListIndex)
+	api.POST("/sync-lists", handlers.ApiSyncListCreate)
+	api.GET("/sync-lists/:id", handlers.ApiSyncListShow)
+	api.PUT("/sync-lists/:id", handlers.ApiSyncListUpdate)
+	api.DELETE("/sync-lists/:id", handlers.ApiSyncListDelete)
+	api.GET("/sync-lists/:id/progress", handlers.ApiSyncListProgress)
+	api.POST("/sync-lists/:id/migrate/start", handlers.ApiSyncListMigrateStart)
+	api.POST("/sync-lists/:id/migrate/stop", handlers.ApiSyncListMigrateStop)
+	api.POST("/sync-lists/:id/final-sync", handlers.ApiSyncListFinalSyncStart)
+	api.POST("/sync-lists/:id/plan", handlers.ApiSyncListPlanStart)
+	api.POST("/sync-lists/:id/verify", handlers.ApiSyncListVerifyStart)
+	api.POST("/sync-lists/:id/live-sync/start", handlers.ApiSyncListLiveSyncStart)
+	api.POST("/sync-lists/:id/live-sync/stop", handlers.ApiSyncListLiveSyncStop)
+
+	api.GET("/sync-lists/:id/mailboxes", handlers.ApiMailboxIndex)
+	api.POST("/sync-lists/:id/mailboxes", handlers.ApiMailboxCreate)
+	api.GET("/sync-lists/:listId/mailboxes/:id", handlers.ApiMailboxShow)
+	api.PUT("/sync-lists/:listId/mailboxes/:id", handlers.ApiMailboxUpdate)
+	api.DELETE("/sync-lists/:listId/mailboxes/:id", handlers.ApiMailboxDelete)
+	api.POST("/sync-lists/:listId/mailboxes/:id/migrate/start", handlers.ApiMailboxMigrateStart)
+	api.POST("/sync-lists/:listId/mailboxes/:id/migrate/stop", handlers.ApiMailboxMigrateStop)
+
+	api.GET("/jobs", handlers.ApiJobIndex)
+	api.GET("/jobs/:id", handlers.ApiJobShow)
 }
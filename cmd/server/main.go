@@ -44,6 +44,15 @@ func main() {
 	})
 
 	e.HTTPErrorHandler = func(c *echo.Context, err error) {
+		if helpers.WantsJSON(c) {
+			if errorsx.IsNotFoundError(err) {
+				helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+			} else {
+				helpers.Problem(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+			}
+			return
+		}
+
 		if errorsx.IsNotFoundError(err) {
 			helpers.Render(c, http.StatusNotFound, base.Error(helpers.MsgErrNotFound))
 		} else {
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -20,6 +21,22 @@ type config struct {
 	SMTPLogin                string
 	SMTPPassword             string
 	RequireEmailConfirmation bool
+	// Connections open at once to an IMAP host across all workers, 0 for no
+	// limit. Limits per host override the default one.
+	HostConnectionLimit  int
+	HostConnectionLimits map[string]int
+	// Transfer rates per IMAP host across all workers, hosts not listed are
+	// not limited
+	HostBytesPerSecond    map[string]int
+	HostMessagesPerSecond map[string]int
+	// Directory holding uploaded and exported mailbox archives
+	ArchiveDir string
+	// Directory inside ArchiveDir that server paths given for an import are
+	// taken from, empty disables them
+	ArchiveImportDir string
+	// Days exports and uploaded archives are kept by default, 0 keeps them
+	// until they are deleted
+	ArchiveRetentionDays int
 }
 
 var Config *config
@@ -40,6 +57,37 @@ func InitConfig() {
 	cfg.SMTPLogin = os.Getenv("SMTP_LOGIN")
 	cfg.SMTPPassword = os.Getenv("SMTP_PASSWORD")
 	cfg.RequireEmailConfirmation = os.Getenv("REQUIRE_EMAIL_CONFIRMATION") == "true"
+	cfg.HostConnectionLimit, _ = strconv.Atoi(os.Getenv("HOST_CONNECTION_LIMIT"))
+	cfg.HostConnectionLimits = parseHostLimits(os.Getenv("HOST_CONNECTION_LIMITS"))
+	cfg.HostBytesPerSecond = parseHostLimits(os.Getenv("HOST_BYTES_PER_SECOND"))
+	cfg.HostMessagesPerSecond = parseHostLimits(os.Getenv("HOST_MESSAGES_PER_SECOND"))
+	cfg.ArchiveDir = os.Getenv("ARCHIVE_DIR")
+	if cfg.ArchiveDir == "" {
+		cfg.ArchiveDir = "storage/archives"
+	}
+	cfg.ArchiveImportDir = os.Getenv("ARCHIVE_IMPORT_DIR")
+	cfg.ArchiveRetentionDays, _ = strconv.Atoi(os.Getenv("ARCHIVE_RETENTION_DAYS"))
 
 	Config = cfg
 }
+
+// parseHostLimits reads comma separated host=limit pairs, malformed pairs
+// are skipped.
+func parseHostLimits(value string) map[string]int {
+	limits := make(map[string]int)
+
+	for pair := range strings.SplitSeq(value, ",") {
+		host, limit, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || n < 0 {
+			continue
+		}
+		limits[strings.ToLower(strings.TrimSpace(host))] = n
+	}
+
+	return limits
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"app/errorsx"
+	"app/helpers"
+	"app/jobs"
+	"app/models"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v5"
+)
+
+var errForbidden = errors.New("user is not authorized to access this resource")
+
+func apiError(c *echo.Context, err error) error {
+	var validationErrs validator.ValidationErrors
+
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make(map[string]string)
+		for field, msg := range helpers.FormatErrors(validationErrs) {
+			fields[lowerFirst(field)] = msg
+		}
+
+		return helpers.ProblemWithErrors(c, http.StatusBadRequest, helpers.MsgErrBadRequest, fields)
+	case errorsx.IsNotFoundError(err):
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	case errors.Is(err, errForbidden):
+		return helpers.Problem(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	case errors.Is(err, errJobActive), errors.Is(err, errJobNotActive), errors.Is(err, jobs.ErrLiveSyncActive), errors.Is(err, jobs.ErrArchiveJobActive):
+		return helpers.Problem(c, http.StatusConflict, helpers.MsgErrConflict)
+	case errors.Is(err, jobs.ErrSyncListCutOver):
+		return helpers.Problem(c, http.StatusConflict, helpers.MsgErrCutOver)
+	case errors.Is(err, jobs.ErrImapSourceRequired):
+		return helpers.Problem(c, http.StatusConflict, helpers.MsgErrImapSource)
+	case errorsx.IsUniqueConstraintError(err):
+		return helpers.Problem(c, http.StatusConflict, helpers.MsgErrDuplicate)
+	default:
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Code < http.StatusInternalServerError {
+			return helpers.Problem(c, httpErr.Code, helpers.MsgErrBadRequest)
+		}
+
+		slog.Error("api request failed", "error", err)
+		return helpers.Problem(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func findOwnedSyncList(ctx context.Context, id int, userId int) (*models.SyncList, error) {
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if list.UserId != userId {
+		return nil, errForbidden
+	}
+
+	return list, nil
+}
+
+func findOwnedMailbox(ctx context.Context, listId int, id int, userId int) (*models.SyncList, *models.Mailbox, error) {
+	list, err := models.FindSyncListByIdWithMailboxById(ctx, listId, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if list.UserId != userId {
+		return nil, nil, errForbidden
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return nil, nil, errors.New("mailbox not found")
+	}
+
+	return list, list.Mailboxes[0], nil
+}
+
+func mailboxJobMap(ctx context.Context, mailboxes []*models.Mailbox) (map[int]*models.Job, error) {
+	jobsMap := make(map[int]*models.Job)
+	if len(mailboxes) == 0 {
+		return jobsMap, nil
+	}
+
+	mailboxIds := make([]int, len(mailboxes))
+	for i, mailbox := range mailboxes {
+		mailboxIds[i] = mailbox.Id
+	}
+
+	jobs, err := models.FindJobsByManyRelated(ctx, "mailboxes", mailboxIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		jobsMap[*job.RelatedId] = job
+	}
+
+	return jobsMap, nil
+}
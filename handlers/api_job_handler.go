@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"app/helpers"
+	"app/models"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+func ApiJobIndex(c *echo.Context) error {
+	page, err := helpers.QueryParamAsInt(c, "page")
+	if err != nil || page < 1 {
+		return helpers.Problem(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
+	}
+
+	jobs, err := models.FindJobsByUserIdPaginated(c.Request().Context(), helpers.GetUserSessionData(c).Id, page)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	res := JobsResponse{
+		Data:       make([]JobResponse, len(jobs.Jobs)),
+		Pagination: newPaginationResponse(jobs.Pagination),
+	}
+	for i, job := range jobs.Jobs {
+		res.Data[i] = newJobResponse(job)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func ApiJobShow(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	job, err := models.FindJobById(c.Request().Context(), id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if job.UserId != helpers.GetUserSessionData(c).Id {
+		return apiError(c, errForbidden)
+	}
+
+	return c.JSON(http.StatusOK, newJobResponse(job))
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"app/config"
+	"app/helpers"
+	"app/jobs"
+	"app/models"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+func ApiMailboxIndex(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	page, err := helpers.QueryParamAsInt(c, "page")
+	if err != nil || page < 1 {
+		return helpers.Problem(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := models.FindSyncListById(ctx, id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		return apiError(c, errForbidden)
+	}
+
+	mailboxes, err := models.FindMailboxesBySyncListIdPaginated(ctx, list.Id, page)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	jobsMap, err := mailboxJobMap(ctx, mailboxes.Mailboxes)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	res := MailboxesResponse{
+		Data:       make([]MailboxResponse, len(mailboxes.Mailboxes)),
+		Pagination: newPaginationResponse(mailboxes.Pagination),
+	}
+	for i, mailbox := range mailboxes.Mailboxes {
+		status := models.JobStatusNone
+		if job, ok := jobsMap[mailbox.Id]; ok {
+			status = job.Status
+		}
+		res.Data[i] = newMailboxResponse(mailbox, status)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func ApiMailboxCreate(c *echo.Context) error {
+	var req MailboxCreateRequest
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := models.FindSyncListById(ctx, id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		return apiError(c, errForbidden)
+	}
+
+	if list.IsCutOver() {
+		return apiError(c, jobs.ErrSyncListCutOver)
+	}
+
+	err = helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	encryptedSrcPassword, err := helpers.AesEncrypt(req.SrcPassword, config.Config.AppKey)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	encryptedDstPassword, err := helpers.AesEncrypt(req.DstPassword, config.Config.AppKey)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	mailbox, err := models.CreateMailbox(ctx, list.Id, req.SrcUser, encryptedSrcPassword, req.DstUser, encryptedDstPassword)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, newMailboxResponse(mailbox, models.JobStatusNone))
+}
+
+func ApiMailboxShow(c *echo.Context) error {
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	_, mailbox, err := findOwnedMailbox(ctx, listId, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	jobsMap, err := mailboxJobMap(ctx, []*models.Mailbox{mailbox})
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	res := MailboxProgressResponse{
+		MailboxResponse:     newMailboxResponse(mailbox, models.JobStatusNone),
+		FolderLastUid:       mailbox.FolderLastUid,
+		FolderHighestModSeq: mailbox.FolderHighestModSeq,
+	}
+	if job, ok := jobsMap[mailbox.Id]; ok {
+		jobRes := newJobResponse(job)
+		res.Job = &jobRes
+		res.Status = job.Status
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func ApiMailboxUpdate(c *echo.Context) error {
+	var req MailboxUpdateRequest
+
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, mailbox, err := findOwnedMailbox(ctx, listId, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if list.IsCutOver() {
+		return apiError(c, jobs.ErrSyncListCutOver)
+	}
+
+	err = ensureNoActiveJobs(ctx, []int{mailbox.Id})
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = ensureNoLiveSync(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	mailbox.SrcUser = req.SrcUser
+	mailbox.DstUser = req.DstUser
+
+	if req.SrcPassword != "" {
+		mailbox.SrcPasswordHash, err = helpers.AesEncrypt(req.SrcPassword, config.Config.AppKey)
+		if err != nil {
+			return apiError(c, err)
+		}
+	}
+
+	if req.DstPassword != "" {
+		mailbox.DstPasswordHash, err = helpers.AesEncrypt(req.DstPassword, config.Config.AppKey)
+		if err != nil {
+			return apiError(c, err)
+		}
+	}
+
+	err = models.UpdateMailboxAccounts(ctx, mailbox)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newMailboxResponse(mailbox, models.JobStatusNone))
+}
+
+func ApiMailboxDelete(c *echo.Context) error {
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	_, mailbox, err := findOwnedMailbox(ctx, listId, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = ensureNoActiveJobs(ctx, []int{mailbox.Id})
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = jobs.RemoveMailboxArchives(ctx, []int{mailbox.Id})
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = models.DeleteMailbox(ctx, mailbox.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func ApiMailboxMigrateStart(c *echo.Context) error {
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, mailbox, err := findOwnedMailbox(ctx, listId, id, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = startMailboxMigration(ctx, list, mailbox.Id, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func ApiMailboxMigrateStop(c *echo.Context) error {
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	_, mailbox, err := findOwnedMailbox(ctx, listId, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = stopMailboxMigration(ctx, mailbox.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
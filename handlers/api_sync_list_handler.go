@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"app/helpers"
+	"app/jobs"
+	"app/models"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+func ApiSyncListIndex(c *echo.Context) error {
+	page, err := helpers.QueryParamAsInt(c, "page")
+	if err != nil || page < 1 {
+		return helpers.Problem(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
+	}
+
+	ctx := c.Request().Context()
+
+	syncLists, err := models.FindSyncListsByUserIdPaginated(ctx, helpers.GetUserSessionData(c).Id, page)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	listIds := make([]int, len(syncLists.SyncLists))
+	for i, list := range syncLists.SyncLists {
+		listIds[i] = list.Id
+	}
+
+	statusMap := make(map[int]models.JobStatus)
+	if len(listIds) > 0 {
+		statuses, err := models.FindSyncListsStatus(ctx, listIds)
+		if err != nil {
+			return apiError(c, err)
+		}
+
+		for _, status := range statuses {
+			statusMap[status.Id] = status.Status
+		}
+	}
+
+	res := SyncListsResponse{
+		Data:       make([]SyncListResponse, len(syncLists.SyncLists)),
+		Pagination: newPaginationResponse(syncLists.Pagination),
+	}
+	for i, list := range syncLists.SyncLists {
+		res.Data[i] = newSyncListResponse(list, statusMap[list.Id])
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func ApiSyncListCreate(c *echo.Context) error {
+	var req SyncListRequest
+
+	err := helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	list, err := models.CreateSyncList(c.Request().Context(), models.CreateSyncListParams{
+		UserId:                 helpers.GetUserSessionData(c).Id,
+		Name:                   req.Name,
+		SrcHost:                req.SrcHost,
+		SrcPort:                req.SrcPort,
+		SrcProtocol:            models.SourceProtocol(req.SrcProtocol),
+		DstHost:                req.DstHost,
+		DstPort:                req.DstPort,
+		CompareMessageIds:      req.CompareMessageIds,
+		CompareLastUid:         req.CompareLastUid,
+		ContentDedup:           models.ContentDedup(req.ContentDedup),
+		SyncFlags:              req.SyncFlags,
+		FlagRenames:            req.FlagRenames,
+		KeepDeletedFlags:       req.KeepDeletedFlags,
+		GmailLabelMode:         models.GmailLabelMode(req.GmailLabelMode),
+		TwoWay:                 req.TwoWay,
+		DeletionPolicy:         models.DeletionPolicy(req.DeletionPolicy),
+		Mirror:                 req.Mirror,
+		MirrorMaxDeletePercent: req.MirrorMaxDeletePercent,
+		MirrorDryRun:           req.MirrorDryRun,
+		ParallelFolders:        req.ParallelFolders,
+		MaxBytesPerSecond:      req.MaxBytesPerSecond,
+		MaxMessagesPerSecond:   req.MaxMessagesPerSecond,
+		Schedule:               req.Schedule,
+	})
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, newSyncListResponse(list, models.JobStatusNone))
+}
+
+func ApiSyncListShow(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := findOwnedSyncList(ctx, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	status, err := models.FindSyncListStatus(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newSyncListResponse(list, status.Status))
+}
+
+func ApiSyncListUpdate(c *echo.Context) error {
+	var req SyncListRequest
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := findOwnedSyncList(ctx, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if list.IsCutOver() {
+		return apiError(c, jobs.ErrSyncListCutOver)
+	}
+
+	mailboxIds := make([]int, len(list.Mailboxes))
+	for i, mailbox := range list.Mailboxes {
+		mailboxIds[i] = mailbox.Id
+	}
+
+	err = ensureNoActiveJobs(ctx, mailboxIds)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = ensureNoLiveSync(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	list.Name = req.Name
+	list.SrcHost = req.SrcHost
+	list.SrcPort = req.SrcPort
+	list.DstHost = req.DstHost
+	list.DstPort = req.DstPort
+	list.CompareMessageIds = req.CompareMessageIds
+	list.CompareLastUid = req.CompareLastUid
+	list.SyncFlags = req.SyncFlags
+	list.FlagRenames = req.FlagRenames
+	if list.FlagRenames == nil {
+		list.FlagRenames = make(map[string]string)
+	}
+	list.KeepDeletedFlags = req.KeepDeletedFlags
+	list.ContentDedup = models.ContentDedup(req.ContentDedup)
+	if list.ContentDedup == "" {
+		list.ContentDedup = models.ContentDedupOff
+	}
+	list.SrcProtocol = models.SourceProtocol(req.SrcProtocol)
+	if list.SrcProtocol == "" {
+		list.SrcProtocol = models.SourceProtocolImap
+	}
+	list.GmailLabelMode = models.GmailLabelMode(req.GmailLabelMode)
+	if list.GmailLabelMode == "" {
+		list.GmailLabelMode = models.GmailLabelModeOff
+	}
+	list.TwoWay = req.TwoWay
+	list.DeletionPolicy = models.DeletionPolicy(req.DeletionPolicy)
+	if list.DeletionPolicy == "" {
+		list.DeletionPolicy = models.DeletionPolicyKeep
+	}
+	list.Mirror = req.Mirror
+	list.MirrorDryRun = req.MirrorDryRun
+	list.MirrorMaxDeletePercent = req.MirrorMaxDeletePercent
+	if list.MirrorMaxDeletePercent == 0 {
+		list.MirrorMaxDeletePercent = models.DefaultMirrorMaxDeletePercent
+	}
+	list.ParallelFolders = req.ParallelFolders
+	if list.ParallelFolders == 0 {
+		list.ParallelFolders = models.DefaultParallelFolders
+	}
+	list.MaxBytesPerSecond = req.MaxBytesPerSecond
+	list.MaxMessagesPerSecond = req.MaxMessagesPerSecond
+
+	err = list.ApplySchedule(req.Schedule, time.Now())
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = models.UpdateSyncList(ctx, list)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	status, err := models.FindSyncListStatus(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newSyncListResponse(list, status.Status))
+}
+
+func ApiSyncListDelete(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := findOwnedSyncList(ctx, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	mailboxIds := make([]int, len(list.Mailboxes))
+	for i, mailbox := range list.Mailboxes {
+		mailboxIds[i] = mailbox.Id
+	}
+
+	err = ensureNoActiveJobs(ctx, mailboxIds)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = ensureNoLiveSync(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = jobs.RemoveMailboxArchives(ctx, mailboxIds)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = models.DeleteSyncListById(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = models.DeleteJobsByRelated(ctx, jobs.SyncListRelatedTable, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func ApiSyncListProgress(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := findOwnedSyncList(ctx, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	status, err := models.FindSyncListStatus(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	jobsMap, err := mailboxJobMap(ctx, list.Mailboxes)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	liveSyncJob, err := findLiveSyncJob(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	res := SyncListProgressResponse{
+		Id:        list.Id,
+		Status:    status.Status,
+		LiveSync:  newLiveSyncResponse(liveSyncJob),
+		Mailboxes: make([]MailboxProgressResponse, len(list.Mailboxes)),
+	}
+	for i, mailbox := range list.Mailboxes {
+		progress := MailboxProgressResponse{
+			MailboxResponse:     newMailboxResponse(mailbox, models.JobStatusNone),
+			FolderLastUid:       mailbox.FolderLastUid,
+			FolderHighestModSeq: mailbox.FolderHighestModSeq,
+		}
+
+		if job, ok := jobsMap[mailbox.Id]; ok {
+			jobRes := newJobResponse(job)
+			progress.Job = &jobRes
+			progress.Status = job.Status
+		}
+
+		res.Mailboxes[i] = progress
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func ApiSyncListMigrateStart(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := findOwnedSyncList(ctx, id, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = jobs.EnqueueSyncListMigration(ctx, list, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func ApiSyncListFinalSyncStart(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := findOwnedSyncList(ctx, id, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = startFinalSync(ctx, list, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func ApiSyncListPlanStart(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := findOwnedSyncList(ctx, id, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = startPlan(ctx, list, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func ApiSyncListVerifyStart(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := findOwnedSyncList(ctx, id, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = startVerification(ctx, list, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func ApiSyncListMigrateStop(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := findOwnedSyncList(ctx, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = stopSyncListMigration(ctx, list)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func ApiSyncListLiveSyncStart(c *echo.Context) error {
+	var req LiveSyncRequest
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := findOwnedSyncList(ctx, id, userId)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = startLiveSync(ctx, list, userId, req.Folders)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func ApiSyncListLiveSyncStop(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Problem(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := findOwnedSyncList(ctx, id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	err = stopLiveSync(ctx, list.Id)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
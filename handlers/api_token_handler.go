@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"app/errorsx"
+	"app/helpers"
+	"app/models"
+	"app/templates/components/alert"
+	"app/templates/pages/apitoken"
+	"app/templates/pages/base"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+func ApiTokenIndex(c *echo.Context) error {
+	tokens, err := models.FindApiTokensByUserId(c.Request().Context(), helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		slog.Error("failed to find api tokens", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+	}
+
+	return helpers.Render(c, http.StatusOK, apitoken.Index(apitoken.IndexProps{
+		Tokens: tokens,
+	}))
+}
+
+func ApiTokenNew(c *echo.Context) error {
+	return helpers.Render(c, http.StatusOK, apitoken.New(apitoken.NewProps{}))
+}
+
+func ApiTokenCreate(c *echo.Context) error {
+	var req struct {
+		Name   string   `form:"Name" validate:"required,max=255"`
+		Scopes []string `form:"Scopes" validate:"required,min=1,dive,oneof=read write"`
+	}
+
+	err := helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return helpers.RenderFragment(c, http.StatusBadRequest, "form", apitoken.New(apitoken.NewProps{
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	tokenHash, token, err := helpers.GenerateToken()
+	if err != nil {
+		slog.Error("failed to generate token", "err", err)
+		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", apitoken.New(apitoken.NewProps{
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	scopes := make([]models.ApiTokenScope, len(req.Scopes))
+	for i, scope := range req.Scopes {
+		scopes[i] = models.ApiTokenScope(scope)
+	}
+
+	_, err = models.CreateApiToken(c.Request().Context(), helpers.GetUserSessionData(c).Id, req.Name, tokenHash, scopes)
+	if err != nil {
+		slog.Error("failed to create api token", "err", err)
+		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", apitoken.New(apitoken.NewProps{
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	return helpers.Render(c, http.StatusOK, apitoken.Created(apitoken.CreatedProps{
+		Token: token,
+	}))
+}
+
+func ApiTokenDelete(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+	}
+
+	err = models.DeleteApiTokenByIdAndUserId(c.Request().Context(), id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+		}
+
+		slog.Error("failed to delete api token", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+	}
+
+	return helpers.Redirect(c, "/app/api-tokens")
+}
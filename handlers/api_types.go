@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"app/helpers"
+	"app/models"
+	"encoding/json"
+	"time"
+)
+
+// JSON representations accepted and returned by the /api/v1 routes and by the
+// HTML routes when the client asks for JSON. Password hashes and
+// other internal columns never leave the models package through these.
+
+type SyncListRequest struct {
+	Name                   string            `json:"name" validate:"required,max=255"`
+	SrcHost                string            `json:"srcHost" validate:"required,max=255"`
+	SrcPort                int               `json:"srcPort" validate:"required,min=1,max=65535"`
+	SrcProtocol            string            `json:"srcProtocol" validate:"omitempty,oneof=imap pop3"`
+	DstHost                string            `json:"dstHost" validate:"required,max=255"`
+	DstPort                int               `json:"dstPort" validate:"required,min=1,max=65535"`
+	CompareMessageIds      bool              `json:"compareMessageIds"`
+	CompareLastUid         bool              `json:"compareLastUid"`
+	ContentDedup           string            `json:"contentDedup" validate:"omitempty,oneof=off headers body"`
+	SyncFlags              bool              `json:"syncFlags"`
+	FlagRenames            map[string]string `json:"flagRenames" validate:"max=100,dive,keys,flag,endkeys,flag"`
+	KeepDeletedFlags       bool              `json:"keepDeletedFlags"`
+	GmailLabelMode         string            `json:"gmailLabelMode" validate:"omitempty,oneof=off folders keywords"`
+	TwoWay                 bool              `json:"twoWay"`
+	DeletionPolicy         string            `json:"deletionPolicy" validate:"omitempty,oneof=keep propagate restore"`
+	Mirror                 bool              `json:"mirror" validate:"excluded_if=TwoWay true"`
+	MirrorMaxDeletePercent int               `json:"mirrorMaxDeletePercent" validate:"omitempty,min=1,max=100"`
+	MirrorDryRun           bool              `json:"mirrorDryRun"`
+	ParallelFolders        int               `json:"parallelFolders" validate:"omitempty,min=1,max=10"`
+	MaxBytesPerSecond      int               `json:"maxBytesPerSecond" validate:"min=0"`
+	MaxMessagesPerSecond   int               `json:"maxMessagesPerSecond" validate:"min=0"`
+	Schedule               string            `json:"schedule" validate:"max=255,schedule"`
+}
+
+type LiveSyncRequest struct {
+	Folders []string `json:"folders" validate:"max=50,dive,max=255"`
+}
+
+type MailboxCreateRequest struct {
+	SrcUser     string `json:"srcUser" validate:"email,required,max=255"`
+	SrcPassword string `json:"srcPassword" validate:"required,max=255"`
+	DstUser     string `json:"dstUser" validate:"email,required,max=255"`
+	DstPassword string `json:"dstPassword" validate:"required,max=255"`
+}
+
+// MailboxUpdateRequest keeps the stored password when a password is left blank.
+type MailboxUpdateRequest struct {
+	SrcUser     string `json:"srcUser" validate:"email,required,max=255"`
+	SrcPassword string `json:"srcPassword" validate:"max=255"`
+	DstUser     string `json:"dstUser" validate:"email,required,max=255"`
+	DstPassword string `json:"dstPassword" validate:"max=255"`
+}
+
+type PaginationResponse struct {
+	Page     int `json:"page"`
+	Limit    int `json:"limit"`
+	Total    int `json:"total"`
+	LastPage int `json:"lastPage"`
+}
+
+type SyncListResponse struct {
+	Id                     int               `json:"id"`
+	Name                   string            `json:"name"`
+	SrcHost                string            `json:"srcHost"`
+	SrcPort                int               `json:"srcPort"`
+	SrcProtocol            string            `json:"srcProtocol"`
+	DstHost                string            `json:"dstHost"`
+	DstPort                int               `json:"dstPort"`
+	CompareMessageIds      bool              `json:"compareMessageIds"`
+	CompareLastUid         bool              `json:"compareLastUid"`
+	ContentDedup           string            `json:"contentDedup"`
+	SyncFlags              bool              `json:"syncFlags"`
+	FlagRenames            map[string]string `json:"flagRenames"`
+	KeepDeletedFlags       bool              `json:"keepDeletedFlags"`
+	GmailLabelMode         string            `json:"gmailLabelMode"`
+	TwoWay                 bool              `json:"twoWay"`
+	DeletionPolicy         string            `json:"deletionPolicy"`
+	Mirror                 bool              `json:"mirror"`
+	MirrorMaxDeletePercent int               `json:"mirrorMaxDeletePercent"`
+	MirrorDryRun           bool              `json:"mirrorDryRun"`
+	ParallelFolders        int               `json:"parallelFolders"`
+	MaxBytesPerSecond      int               `json:"maxBytesPerSecond"`
+	MaxMessagesPerSecond   int               `json:"maxMessagesPerSecond"`
+	Schedule               *string           `json:"schedule"`
+	NextRunAt              *time.Time        `json:"nextRunAt"`
+	LastRunAt              *time.Time        `json:"lastRunAt"`
+	FinalSyncStartedAt     *time.Time        `json:"finalSyncStartedAt"`
+	CutOverAt              *time.Time        `json:"cutOverAt"`
+	Status                 models.JobStatus  `json:"status"`
+}
+
+type SyncListsResponse struct {
+	Data       []SyncListResponse `json:"data"`
+	Pagination PaginationResponse `json:"pagination"`
+}
+
+type SyncListShowResponse struct {
+	SyncListResponse
+	LiveSync   *LiveSyncResponse  `json:"liveSync"`
+	Mailboxes  []MailboxResponse  `json:"mailboxes"`
+	Pagination PaginationResponse `json:"pagination"`
+}
+
+type MailboxResponse struct {
+	Id              int              `json:"id"`
+	SyncListId      int              `json:"syncListId"`
+	SrcUser         string           `json:"srcUser"`
+	DstUser         string           `json:"dstUser"`
+	Status          models.JobStatus `json:"status"`
+	LastRunMessages int              `json:"lastRunMessages"`
+}
+
+type MailboxesResponse struct {
+	Data       []MailboxResponse  `json:"data"`
+	Pagination PaginationResponse `json:"pagination"`
+}
+
+type JobResponse struct {
+	Id           int              `json:"id"`
+	Type         models.JobType   `json:"type"`
+	Status       models.JobStatus `json:"status"`
+	RelatedTable *string          `json:"relatedTable"`
+	RelatedId    *int             `json:"relatedId"`
+	Error        *string          `json:"error"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	StartedAt    *time.Time       `json:"startedAt"`
+	FinishedAt   *time.Time       `json:"finishedAt"`
+}
+
+type JobsResponse struct {
+	Data       []JobResponse      `json:"data"`
+	Pagination PaginationResponse `json:"pagination"`
+}
+
+type MailboxProgressResponse struct {
+	MailboxResponse
+	Job                 *JobResponse      `json:"job"`
+	FolderLastUid       map[string]uint32 `json:"folderLastUid"`
+	FolderHighestModSeq map[string]uint64 `json:"folderHighestModSeq"`
+}
+
+type SyncListProgressResponse struct {
+	Id        int                       `json:"id"`
+	Status    models.JobStatus          `json:"status"`
+	LiveSync  *LiveSyncResponse         `json:"liveSync"`
+	Mailboxes []MailboxProgressResponse `json:"mailboxes"`
+}
+
+type LiveSyncResponse struct {
+	Job     JobResponse `json:"job"`
+	Folders []string    `json:"folders"`
+}
+
+func newPaginationResponse(p helpers.Pagination) PaginationResponse {
+	return PaginationResponse{
+		Page:     p.Page,
+		Limit:    p.Limit,
+		Total:    p.Total,
+		LastPage: p.LastPage,
+	}
+}
+
+func newSyncListResponse(list *models.SyncList, status models.JobStatus) SyncListResponse {
+	if status == "" {
+		status = models.JobStatusNone
+	}
+
+	return SyncListResponse{
+		Id:                     list.Id,
+		Name:                   list.Name,
+		SrcHost:                list.SrcHost,
+		SrcPort:                list.SrcPort,
+		SrcProtocol:            string(list.SrcProtocol),
+		DstHost:                list.DstHost,
+		DstPort:                list.DstPort,
+		CompareMessageIds:      list.CompareMessageIds,
+		CompareLastUid:         list.CompareLastUid,
+		ContentDedup:           string(list.ContentDedup),
+		SyncFlags:              list.SyncFlags,
+		FlagRenames:            list.FlagRenames,
+		KeepDeletedFlags:       list.KeepDeletedFlags,
+		GmailLabelMode:         string(list.GmailLabelMode),
+		TwoWay:                 list.TwoWay,
+		DeletionPolicy:         string(list.DeletionPolicy),
+		Mirror:                 list.Mirror,
+		MirrorMaxDeletePercent: list.MirrorMaxDeletePercent,
+		MirrorDryRun:           list.MirrorDryRun,
+		ParallelFolders:        list.ParallelFolders,
+		MaxBytesPerSecond:      list.MaxBytesPerSecond,
+		MaxMessagesPerSecond:   list.MaxMessagesPerSecond,
+		Schedule:               list.Schedule,
+		NextRunAt:              list.NextRunAt,
+		LastRunAt:              list.LastRunAt,
+		FinalSyncStartedAt:     list.FinalSyncStartedAt,
+		CutOverAt:              list.CutOverAt,
+		Status:                 status,
+	}
+}
+
+func newMailboxResponse(mailbox *models.Mailbox, status models.JobStatus) MailboxResponse {
+	if status == "" {
+		status = models.JobStatusNone
+	}
+
+	return MailboxResponse{
+		Id:              mailbox.Id,
+		SyncListId:      mailbox.SyncListId,
+		SrcUser:         mailbox.SrcUser,
+		DstUser:         mailbox.DstUser,
+		Status:          status,
+		LastRunMessages: mailbox.LastRunMessages,
+	}
+}
+
+func newJobResponse(job *models.Job) JobResponse {
+	return JobResponse{
+		Id:           job.Id,
+		Type:         job.Type,
+		Status:       job.Status,
+		RelatedTable: job.RelatedTable,
+		RelatedId:    job.RelatedId,
+		Error:        job.Error,
+		CreatedAt:    job.CreatedAt,
+		StartedAt:    job.StartedAt,
+		FinishedAt:   job.FinishedAt,
+	}
+}
+
+type ArchiveResponse struct {
+	Id        int                  `json:"id"`
+	MailboxId int                  `json:"mailboxId"`
+	Kind      models.ArchiveKind   `json:"kind"`
+	Format    models.ArchiveFormat `json:"format"`
+	Path      string               `json:"path"`
+	Size      int64                `json:"size"`
+	Messages  int                  `json:"messages"`
+	Status    models.JobStatus     `json:"status"`
+	Error     *string              `json:"error"`
+	ExpiresAt *time.Time           `json:"expiresAt"`
+	CreatedAt time.Time            `json:"createdAt"`
+}
+
+type ArchivesResponse struct {
+	Data []ArchiveResponse `json:"data"`
+}
+
+// newArchiveResponse takes the job of the archive, nil when it has none.
+func newArchiveResponse(archive *models.Archive, job *models.Job) ArchiveResponse {
+	res := ArchiveResponse{
+		Id:        archive.Id,
+		MailboxId: archive.MailboxId,
+		Kind:      archive.Kind,
+		Format:    archive.Format,
+		Path:      archive.Path,
+		Size:      archive.Size,
+		Messages:  archive.Messages,
+		Status:    models.JobStatusNone,
+		ExpiresAt: archive.ExpiresAt,
+		CreatedAt: archive.CreatedAt,
+	}
+	if job != nil {
+		res.Status = job.Status
+		res.Error = job.Error
+	}
+
+	return res
+}
+
+type ReportResponse struct {
+	Id         int               `json:"id"`
+	SyncListId int               `json:"syncListId"`
+	MailboxId  *int              `json:"mailboxId"`
+	Type       models.ReportType `json:"type"`
+	Passed     bool              `json:"passed"`
+	Data       json.RawMessage   `json:"data"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+type ReportsResponse struct {
+	Data       []ReportResponse   `json:"data"`
+	Pagination PaginationResponse `json:"pagination"`
+}
+
+func newReportResponse(report *models.Report) ReportResponse {
+	return ReportResponse{
+		Id:         report.Id,
+		SyncListId: report.SyncListId,
+		MailboxId:  report.MailboxId,
+		Type:       report.Type,
+		Passed:     report.Passed,
+		Data:       report.Data,
+		CreatedAt:  report.CreatedAt,
+	}
+}
+
+func newLiveSyncResponse(job *models.Job) *LiveSyncResponse {
+	if job == nil {
+		return nil
+	}
+
+	return &LiveSyncResponse{
+		Job:     newJobResponse(job),
+		Folders: liveSyncJobFolders(job),
+	}
+}
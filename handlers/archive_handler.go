@@ -0,0 +1,495 @@
+package handlers
+
+import (
+	"app/config"
+	"app/errorsx"
+	"app/helpers"
+	"app/jobs"
+	"app/models"
+	"app/templates/pages/synclist/archive"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+func archivesURL(list *models.SyncList, mailbox *models.Mailbox) string {
+	return "/app/sync-lists/" + strconv.Itoa(list.Id) + "/mailboxes/" + strconv.Itoa(mailbox.Id) + "/archives"
+}
+
+// findArchiveJobs maps archive ids to their job, archives without one are
+// left out.
+func findArchiveJobs(ctx context.Context, archives []*models.Archive) (map[int]*models.Job, error) {
+	archiveJobs := make(map[int]*models.Job, len(archives))
+	if len(archives) == 0 {
+		return archiveJobs, nil
+	}
+
+	ids := make([]int, len(archives))
+	for i, a := range archives {
+		ids[i] = a.Id
+	}
+
+	jobsByArchiveId, err := models.FindJobsByManyRelatedMap(ctx, jobs.ArchiveRelatedTable, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, archiveJobList := range jobsByArchiveId {
+		archiveJobs[id] = archiveJobList[0]
+	}
+
+	return archiveJobs, nil
+}
+
+// archiveFormValues keeps the submitted values, the retention of exports
+// defaults to the configured one.
+func archiveFormValues(c *echo.Context) map[string]string {
+	values := helpers.FormatValues(c)
+	if values["RetentionDays"] == "" {
+		values["RetentionDays"] = strconv.Itoa(config.Config.ArchiveRetentionDays)
+	}
+
+	return values
+}
+
+// archiveExpiresAt is when an archive kept for days is deleted, never when
+// days is 0.
+func archiveExpiresAt(days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, days)
+	return &expiresAt
+}
+
+// startArchiveJob queues the import or export job of a new archive.
+func startArchiveJob(ctx context.Context, a *models.Archive, userId int, jobType models.JobType, payload any) (*models.Job, error) {
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := models.CreateJobWithRelated(ctx, userId, jobType, jobs.ArchiveRelatedTable, a.Id, (*json.RawMessage)(&payloadJson))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs.DispatchJobEvent(ctx, job)
+	return job, nil
+}
+
+// saveArchiveUpload stores an uploaded archive under its own directory in the
+// uploads directory, keeping the file name that folder names are read from.
+func saveArchiveUpload(file *multipart.FileHeader) (string, int64, error) {
+	hash, _, err := helpers.GenerateToken()
+	if err != nil {
+		return "", 0, err
+	}
+
+	name := filepath.Base(file.Filename)
+	if name == "." || name == string(filepath.Separator) {
+		name = "archive"
+	}
+	relPath := filepath.Join(models.ArchiveUploadDir, hash[:16], name)
+
+	err = os.MkdirAll(filepath.Dir(jobs.ArchivePath(relPath)), 0o750)
+	if err != nil {
+		return "", 0, err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(jobs.ArchivePath(relPath))
+	if err != nil {
+		return "", 0, err
+	}
+	defer dst.Close()
+
+	size, err := io.Copy(dst, src)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return relPath, size, nil
+}
+
+func ArchiveIndex(c *echo.Context) error {
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := models.FindSyncListByIdWithMailboxById(ctx, listId, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list with mailbox", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		return renderPageError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	archives, err := models.FindArchivesByMailboxId(ctx, id)
+	if err != nil {
+		slog.Error("failed to find archives", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	archiveJobs, err := findArchiveJobs(ctx, archives)
+	if err != nil {
+		slog.Error("failed to find archive jobs", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if helpers.WantsJSON(c) {
+		res := ArchivesResponse{
+			Data: make([]ArchiveResponse, len(archives)),
+		}
+		for i, a := range archives {
+			res.Data[i] = newArchiveResponse(a, archiveJobs[a.Id])
+		}
+
+		return c.JSON(http.StatusOK, res)
+	}
+
+	return helpers.Render(c, http.StatusOK, archive.Index(archive.IndexProps{
+		List:        list,
+		Mailbox:     list.Mailboxes[0],
+		Archives:    archives,
+		Jobs:        archiveJobs,
+		Values:      archiveFormValues(c),
+		Errors:      map[string]string{},
+		ServerPaths: config.Config.ArchiveImportDir != "",
+	}))
+}
+
+// ArchiveImport queues the import of an uploaded archive, or of a file or
+// directory already inside the archive directory.
+func ArchiveImport(c *echo.Context) error {
+	var req struct {
+		Format string `form:"Format" validate:"required,oneof=mbox maildir"`
+		Path   string `form:"Path" validate:"max=2048"`
+	}
+
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := models.FindSyncListByIdWithMailboxById(ctx, listId, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list with mailbox", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != userId {
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+	mailbox := list.Mailboxes[0]
+
+	formProps := func(errs map[string]string) archive.IndexProps {
+		return archive.IndexProps{
+			List:        list,
+			Mailbox:     mailbox,
+			Values:      archiveFormValues(c),
+			Errors:      errs,
+			ServerPaths: config.Config.ArchiveImportDir != "",
+		}
+	}
+
+	err = helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return renderFormError(c, http.StatusBadRequest, err, archive.Index(formProps(helpers.FormatErrors(err))))
+	}
+
+	var relPath string
+	var size int64
+	var expiresAt *time.Time
+
+	file, err := c.FormFile("File")
+	switch {
+	case err == nil:
+		relPath, size, err = saveArchiveUpload(file)
+		if err != nil {
+			slog.Error("failed to save archive upload", "err", err)
+			return renderFormError(c, http.StatusInternalServerError, err, archive.Index(formProps(helpers.FormatErrors(err))))
+		}
+		// Files already on the server are never deleted
+		expiresAt = archiveExpiresAt(config.Config.ArchiveRetentionDays)
+	case errors.Is(err, http.ErrMissingFile) && req.Path != "":
+		relPath, err = jobs.ResolveArchivePath(req.Path)
+		if err == nil {
+			var info os.FileInfo
+			info, err = os.Stat(jobs.ArchivePath(relPath))
+			if err == nil {
+				size = info.Size()
+			}
+		}
+		if errors.Is(err, jobs.ErrArchivePathsOff) {
+			return renderArchiveFieldError(c, "File", helpers.MsgErrArchiveUpload, formProps)
+		}
+		if err != nil {
+			slog.Debug("Refused archive path", "path", req.Path, "error", err)
+			return renderArchiveFieldError(c, "Path", helpers.MsgErrArchivePath, formProps)
+		}
+	case errors.Is(err, http.ErrMissingFile):
+		return renderArchiveFieldError(c, "File", helpers.MsgErrArchiveRequired, formProps)
+	default:
+		slog.Error("failed to read archive upload", "err", err)
+		return renderFormError(c, http.StatusBadRequest, err, archive.Index(formProps(helpers.FormatErrors(err))))
+	}
+
+	a, err := models.CreateArchive(ctx, mailbox.Id, models.ArchiveKindImport, models.ArchiveFormat(req.Format), relPath, size, expiresAt)
+	if err != nil {
+		slog.Error("failed to create archive", "err", err)
+		return renderFormError(c, http.StatusInternalServerError, err, archive.Index(formProps(helpers.FormatErrors(err))))
+	}
+
+	job, err := startArchiveJob(ctx, a, userId, jobs.ImportArchiveType, jobs.ImportArchivePayload{ArchiveId: a.Id})
+	if err != nil {
+		slog.Error("failed to start archive import", "err", err)
+		return renderFormError(c, http.StatusInternalServerError, err, archive.Index(formProps(helpers.FormatErrors(err))))
+	}
+
+	return respond(c, http.StatusAccepted, newArchiveResponse(a, job), archivesURL(list, mailbox))
+}
+
+// ArchiveExport queues the export of the mailbox's source into a zip file
+// kept in the archive directory for the given number of days.
+func ArchiveExport(c *echo.Context) error {
+	var req struct {
+		ExportFormat  string `form:"ExportFormat" validate:"required,oneof=mbox maildir eml"`
+		RetentionDays int    `form:"RetentionDays" validate:"min=0,max=3650"`
+	}
+
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := models.FindSyncListByIdWithMailboxById(ctx, listId, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list with mailbox", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != userId {
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+	mailbox := list.Mailboxes[0]
+
+	formProps := func(errs map[string]string) archive.IndexProps {
+		return archive.IndexProps{
+			List:        list,
+			Mailbox:     mailbox,
+			Values:      archiveFormValues(c),
+			Errors:      errs,
+			ServerPaths: config.Config.ArchiveImportDir != "",
+		}
+	}
+
+	err = helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return renderFormError(c, http.StatusBadRequest, err, archive.Index(formProps(helpers.FormatErrors(err))))
+	}
+
+	format := models.ArchiveFormat(req.ExportFormat)
+
+	a, err := models.CreateArchive(ctx, mailbox.Id, models.ArchiveKindExport, format, "", 0, archiveExpiresAt(req.RetentionDays))
+	if err != nil {
+		slog.Error("failed to create archive", "err", err)
+		return renderFormError(c, http.StatusInternalServerError, err, archive.Index(formProps(helpers.FormatErrors(err))))
+	}
+
+	// The path needs the archive id
+	a.Path = filepath.Join(models.ArchiveExportDir, strconv.Itoa(mailbox.Id), strconv.Itoa(a.Id)+"-"+string(format)+".zip")
+	err = models.UpdateArchive(ctx, a)
+	if err != nil {
+		slog.Error("failed to update archive", "err", err)
+		return renderFormError(c, http.StatusInternalServerError, err, archive.Index(formProps(helpers.FormatErrors(err))))
+	}
+
+	job, err := startArchiveJob(ctx, a, userId, jobs.ExportArchiveType, jobs.ExportArchivePayload{ArchiveId: a.Id})
+	if err != nil {
+		slog.Error("failed to start archive export", "err", err)
+		return renderFormError(c, http.StatusInternalServerError, err, archive.Index(formProps(helpers.FormatErrors(err))))
+	}
+
+	return respond(c, http.StatusAccepted, newArchiveResponse(a, job), archivesURL(list, mailbox))
+}
+
+// findMailboxArchive loads the sync list with its mailbox and the archive of
+// the route for the current user, it answers the request itself when one of
+// them can't be used.
+func findMailboxArchive(c *echo.Context) (*models.SyncList, *models.Archive, error) {
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return nil, nil, renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return nil, nil, renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	archiveId, err := helpers.ParamAsInt(c, "archiveId")
+	if err != nil {
+		return nil, nil, renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := models.FindSyncListByIdWithMailboxById(ctx, listId, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return nil, nil, renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list with mailbox", "err", err)
+		return nil, nil, renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		return nil, nil, renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return nil, nil, renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	a, err := models.FindArchiveById(ctx, archiveId)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return nil, nil, renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find archive", "err", err)
+		return nil, nil, renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if a.MailboxId != list.Mailboxes[0].Id {
+		return nil, nil, renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	return list, a, nil
+}
+
+// ArchiveDownload sends the zip file of a completed export.
+func ArchiveDownload(c *echo.Context) error {
+	list, a, err := findMailboxArchive(c)
+	if list == nil {
+		return err
+	}
+
+	if a.Kind != models.ArchiveKindExport {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	job, err := models.FindJobByRelated(c.Request().Context(), jobs.ArchiveRelatedTable, a.Id)
+	if err != nil || job.Status != models.JobStatusCompleted {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	p := jobs.ArchivePath(a.Path)
+	if _, err := os.Stat(p); err != nil {
+		slog.Error("failed to find archive file", "archive", a.Id, "err", err)
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	name := list.Mailboxes[0].SrcUser + "-" + a.CreatedAt.Format("2006-01-02") + "-" + string(a.Format) + ".zip"
+	return c.Attachment(p, name)
+}
+
+// ArchiveDelete deletes an archive with its stored file, archives are kept
+// while their import or export runs.
+func ArchiveDelete(c *echo.Context) error {
+	list, a, err := findMailboxArchive(c)
+	if list == nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	job, err := models.FindJobByRelated(ctx, jobs.ArchiveRelatedTable, a.Id)
+	if err == nil && (job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning) {
+		return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
+	}
+
+	err = jobs.RemoveArchive(ctx, a)
+	if err != nil {
+		slog.Error("failed to delete archive", "archive", a.Id, "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	return respond(c, http.StatusNoContent, nil, archivesURL(list, list.Mailboxes[0]))
+}
+
+func renderArchiveFieldError(c *echo.Context, field string, message string, formProps func(map[string]string) archive.IndexProps) error {
+	if helpers.WantsJSON(c) {
+		return helpers.ProblemWithErrors(c, http.StatusBadRequest, helpers.MsgErrBadRequest, map[string]string{lowerFirst(field): message})
+	}
+
+	return helpers.RenderFragment(c, http.StatusBadRequest, "form", archive.Index(formProps(map[string]string{field: message})))
+}
@@ -6,15 +6,11 @@ import (
 	"app/helpers"
 	"app/jobs"
 	"app/models"
-	"app/templates/components/alert"
-	"app/templates/pages/base"
 	"app/templates/pages/synclist/mailbox"
-	"app/worker"
-	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/labstack/echo/v5"
 )
@@ -23,22 +19,22 @@ func MailboxNew(c *echo.Context) error {
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Error("failed to parse id", "err", err.Error())
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	list, err := models.FindSyncListById(c.Request().Context(), id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("failed to find sync list", "err", err.Error())
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Error("user not authorized")
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	return helpers.Render(c, http.StatusOK, mailbox.New(mailbox.NewProps{
@@ -57,23 +53,23 @@ func MailboxCreate(c *echo.Context) error {
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		helpers.Retarget(c, "_Error")
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	list, err := models.FindSyncListById(c.Request().Context(), id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
 			helpers.Retarget(c, "_Error")
-			return helpers.Render(c, http.StatusNotFound, base.Error(helpers.MsgErrNotFound))
+			return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("failed to find sync list", "err", err.Error())
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	err = helpers.BindAndValidate(c, &req)
 	if err != nil {
-		return helpers.RenderFragment(c, http.StatusBadRequest, "form", mailbox.New(mailbox.NewProps{
+		return renderFormError(c, http.StatusBadRequest, err, mailbox.New(mailbox.NewProps{
 			List:   list,
 			Values: helpers.FormatValues(c),
 			Errors: helpers.FormatErrors(err),
@@ -82,28 +78,17 @@ func MailboxCreate(c *echo.Context) error {
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Error("user is not authorized to access this sync list")
-		return helpers.RenderFragment(c, http.StatusForbidden, "form", mailbox.New(mailbox.NewProps{
-			List:   list,
-			Values: helpers.FormatValues(c),
-			Errors: helpers.FormatErrors(err),
-		}))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
-	relatedJobs, err := models.FindJobsByRelated(c.Request().Context(), "mailboxes", list.Mailboxes[0].Id)
-	if err != nil {
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
-	}
-
-	for _, job := range relatedJobs {
-		if job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending {
-			return helpers.Render(c, http.StatusConflict, alert.Error(helpers.MsgErrForbidden))
-		}
+	if list.IsCutOver() {
+		return renderAlertError(c, http.StatusConflict, helpers.MsgErrCutOver)
 	}
 
 	encryptedSrcPassword, err := helpers.AesEncrypt(req.SrcPassword, config.Config.AppKey)
 	if err != nil {
 		slog.Error("failed to encrypt source password", "err", err.Error())
-		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", mailbox.New(mailbox.NewProps{
+		return renderFormError(c, http.StatusInternalServerError, err, mailbox.New(mailbox.NewProps{
 			List:   list,
 			Values: helpers.FormatValues(c),
 			Errors: helpers.FormatErrors(err),
@@ -113,72 +98,244 @@ func MailboxCreate(c *echo.Context) error {
 	encryptedDstPassword, err := helpers.AesEncrypt(req.DstPassword, config.Config.AppKey)
 	if err != nil {
 		slog.Error("failed to encrypt destination password", "err", err.Error())
-		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", mailbox.New(mailbox.NewProps{
+		return renderFormError(c, http.StatusInternalServerError, err, mailbox.New(mailbox.NewProps{
 			List:   list,
 			Values: helpers.FormatValues(c),
 			Errors: helpers.FormatErrors(err),
 		}))
 	}
 
-	_, err = models.CreateMailbox(c.Request().Context(), list.Id, req.SrcUser, encryptedSrcPassword, req.DstUser, encryptedDstPassword)
+	mb, err := models.CreateMailbox(c.Request().Context(), list.Id, req.SrcUser, encryptedSrcPassword, req.DstUser, encryptedDstPassword)
 	if err != nil {
 		slog.Error("failed to create mailbox", "err", err.Error())
-		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", mailbox.New(mailbox.NewProps{
+		return renderFormError(c, http.StatusInternalServerError, err, mailbox.New(mailbox.NewProps{
 			List:   list,
 			Values: helpers.FormatValues(c),
 			Errors: helpers.FormatErrors(err),
 		}))
 	}
 
-	return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id))
+	return respond(c, http.StatusCreated, newMailboxResponse(mb, models.JobStatusNone), "/app/sync-lists/"+strconv.Itoa(list.Id))
+}
+
+func MailboxEdit(c *echo.Context) error {
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	list, err := models.FindSyncListByIdWithMailboxById(c.Request().Context(), listId, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list with mailbox", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		return renderPageError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	return helpers.Render(c, http.StatusOK, mailbox.Edit(mailbox.EditProps{
+		List:    list,
+		Mailbox: list.Mailboxes[0],
+		Values: map[string]string{
+			"SrcUser": list.Mailboxes[0].SrcUser,
+			"DstUser": list.Mailboxes[0].DstUser,
+		},
+	}))
+}
+
+func MailboxUpdate(c *echo.Context) error {
+	var req struct {
+		SrcUser     string `form:"SrcUser" validate:"email,required,max=255"`
+		SrcPassword string `form:"SrcPassword" validate:"max=255"`
+		DstUser     string `form:"DstUser" validate:"email,required,max=255"`
+		DstPassword string `form:"DstPassword" validate:"max=255"`
+	}
+
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	list, err := models.FindSyncListByIdWithMailboxById(c.Request().Context(), listId, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list with mailbox", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		slog.Error("user is not authorized to access this sync list", "userId", helpers.GetUserSessionData(c).Id, "syncListId", list.Id)
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	if list.IsCutOver() {
+		return renderAlertError(c, http.StatusConflict, helpers.MsgErrCutOver)
+	}
+
+	mb := list.Mailboxes[0]
+
+	relatedJobs, err := models.FindJobsByRelated(c.Request().Context(), "mailboxes", mb.Id)
+	if err != nil {
+		slog.Error("failed to find related jobs", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	for _, job := range relatedJobs {
+		if job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrForbidden)
+		}
+	}
+
+	err = ensureNoLiveSync(c.Request().Context(), list.Id)
+	if err != nil {
+		if errors.Is(err, errJobActive) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
+		}
+
+		slog.Error("failed to find live sync job", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	err = helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return renderFormError(c, http.StatusBadRequest, err, mailbox.Edit(mailbox.EditProps{
+			List:    list,
+			Mailbox: mb,
+			Values:  helpers.FormatValues(c),
+			Errors:  helpers.FormatErrors(err),
+		}))
+	}
+
+	mb.SrcUser = req.SrcUser
+	mb.DstUser = req.DstUser
+
+	// blank passwords keep the currently stored ones
+	if req.SrcPassword != "" {
+		mb.SrcPasswordHash, err = helpers.AesEncrypt(req.SrcPassword, config.Config.AppKey)
+		if err != nil {
+			slog.Error("failed to encrypt source password", "err", err.Error())
+			return renderFormError(c, http.StatusInternalServerError, err, mailbox.Edit(mailbox.EditProps{
+				List:    list,
+				Mailbox: mb,
+				Values:  helpers.FormatValues(c),
+				Errors:  helpers.FormatErrors(err),
+			}))
+		}
+	}
+
+	if req.DstPassword != "" {
+		mb.DstPasswordHash, err = helpers.AesEncrypt(req.DstPassword, config.Config.AppKey)
+		if err != nil {
+			slog.Error("failed to encrypt destination password", "err", err.Error())
+			return renderFormError(c, http.StatusInternalServerError, err, mailbox.Edit(mailbox.EditProps{
+				List:    list,
+				Mailbox: mb,
+				Values:  helpers.FormatValues(c),
+				Errors:  helpers.FormatErrors(err),
+			}))
+		}
+	}
+
+	err = models.UpdateMailboxAccounts(c.Request().Context(), mb)
+	if err != nil {
+		slog.Error("failed to update mailbox", "err", err.Error())
+		return renderFormError(c, http.StatusInternalServerError, err, mailbox.Edit(mailbox.EditProps{
+			List:    list,
+			Mailbox: mb,
+			Values:  helpers.FormatValues(c),
+			Errors:  helpers.FormatErrors(err),
+		}))
+	}
+
+	return respond(c, http.StatusOK, newMailboxResponse(mb, models.JobStatusNone), "/app/sync-lists/"+strconv.Itoa(list.Id))
 }
 
 func MailboxDelete(c *echo.Context) error {
 	listId, err := helpers.ParamAsInt(c, "listId")
 	if err != nil {
-		return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 	}
 
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
-		return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 	}
 
 	list, err := models.FindSyncListByIdWithMailboxById(c.Request().Context(), listId, id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("Failed to find sync list with mailbox", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Error("User is not authorized to access this sync list", "userId", helpers.GetUserSessionData(c).Id, "syncListId", list.Id)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	if len(list.Mailboxes) == 0 {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 	}
 
 	relatedJobs, err := models.FindJobsByRelated(c.Request().Context(), "mailboxes", list.Mailboxes[0].Id)
 	if err != nil {
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	for _, job := range relatedJobs {
 		if job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending {
-			return helpers.Render(c, http.StatusConflict, alert.Error(helpers.MsgErrForbidden))
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrForbidden)
 		}
 	}
 
+	err = jobs.RemoveMailboxArchives(c.Request().Context(), []int{list.Mailboxes[0].Id})
+	if err != nil {
+		if errors.Is(err, jobs.ErrArchiveJobActive) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
+		}
+
+		slog.Error("Failed to remove archives", "error", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
 	err = models.DeleteMailbox(c.Request().Context(), list.Mailboxes[0].Id)
 	if err != nil {
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if helpers.WantsJSON(c) {
+		return c.NoContent(http.StatusNoContent)
 	}
 
 	page, err := helpers.QueryParamAsInt(c, "page")
@@ -192,33 +349,37 @@ func MailboxDelete(c *echo.Context) error {
 func MailboxDeleteJob(c *echo.Context) error {
 	listId, err := helpers.ParamAsInt(c, "listId")
 	if err != nil {
-		return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 	}
 
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
-		return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 	}
 
 	list, err := models.FindSyncListByIdWithMailboxById(c.Request().Context(), listId, id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("Failed to find sync list with mailbox", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Error("Unauthorized access to sync list", "listId", listId, "userId", helpers.GetUserSessionData(c).Id)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	err = models.DeleteJobsByRelated(c.Request().Context(), "mailboxes", list.Mailboxes[0].Id)
 	if err != nil {
 		slog.Error("Failed to delete jobs", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if helpers.WantsJSON(c) {
+		return c.NoContent(http.StatusNoContent)
 	}
 
 	page, err := helpers.QueryParamAsInt(c, "page")
@@ -233,12 +394,12 @@ func MailboxJobMigrateStart(c *echo.Context) error {
 	listId, err := helpers.ParamAsInt(c, "listId")
 	if err != nil {
 		slog.Debug("Failed to parse list ID", "error", err)
-		return helpers.Render(c, http.StatusBadRequest, alert.Error(helpers.MsgErrBadRequest))
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 	mailboxId, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Debug("Failed to parse account ID", "error", err)
-		return helpers.Render(c, http.StatusBadRequest, alert.Error(helpers.MsgErrBadRequest))
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 
 	userId := helpers.GetUserSessionData(c).Id
@@ -247,144 +408,101 @@ func MailboxJobMigrateStart(c *echo.Context) error {
 	if err != nil {
 		if !errorsx.IsNotFoundError(err) {
 			slog.Debug("Failed to find sync list", "error", err)
-			return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+			return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 		}
 
 		slog.Debug("Failed to find sync list", "error", err)
-		return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Debug("User does not own the sync list", "userID", userId, "listID", listId)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	if len(list.Mailboxes) == 0 {
 		slog.Debug("Sync list has no mailboxes", "listID", listId)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
-	job, err := models.FindJobByRelated(c.Request().Context(), "mailboxes", mailboxId)
+	err = startMailboxMigration(c.Request().Context(), list, mailboxId, userId)
 	if err != nil {
-		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
-		}
-
-		slog.Debug("Failed to find job", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
-	}
-
-	if job != nil {
-		if job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending {
-			slog.Debug("Job already running or pending", "jobID", job.Id)
-			return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
-		}
-
-		job.Status = models.JobStatusPending
-		now := time.Now()
-		job.StartedAt = &now
-
-		err = models.UpdateJob(c.Request().Context(), job)
-		if err != nil {
-			slog.Debug("Failed to update job", "error", err)
-			return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		if errors.Is(err, errJobActive) {
+			slog.Debug("Job already running or pending", "mailboxID", mailboxId)
+			return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 		}
-
-		page, err := helpers.QueryParamAsInt(c, "page")
-		if err != nil {
-			return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id))
-		} else {
-			return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id)+"?page="+strconv.Itoa(page))
+		if errors.Is(err, jobs.ErrSyncListCutOver) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrCutOver)
 		}
-	}
 
-	payload := jobs.MigrateMailboxPayload{
-		SyncListId: list.Id,
-		MailboxId:  mailboxId,
+		slog.Debug("Failed to start mailbox migration", "error", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	payloadJson, err := json.Marshal(payload)
-	if err != nil {
-		slog.Debug("Failed to marshal payload", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+	if helpers.WantsJSON(c) {
+		return c.NoContent(http.StatusAccepted)
 	}
 
-	_, err = models.CreateJobWithRelated(c.Request().Context(), userId, jobs.MigrateMailboxType, "mailboxes", mailboxId, (*json.RawMessage)(&payloadJson))
-	if err != nil {
-		slog.Debug("Failed to create job", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
-	}
 	page, err := helpers.QueryParamAsInt(c, "page")
 	if err != nil {
 		return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id))
 	} else {
 		return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id)+"?page="+strconv.Itoa(page))
 	}
-
 }
 
 func MailboxJobMigrateStop(c *echo.Context) error {
 	listId, err := helpers.ParamAsInt(c, "listId")
 	if err != nil {
 		slog.Debug("Failed to parse list ID", "error", err)
-		return helpers.Render(c, http.StatusBadRequest, alert.Error(helpers.MsgErrBadRequest))
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 	mailboxId, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Debug("Failed to parse account ID", "error", err)
-		return helpers.Render(c, http.StatusBadRequest, alert.Error(helpers.MsgErrBadRequest))
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 
 	list, err := models.FindSyncListByIdWithMailboxById(c.Request().Context(), listId, mailboxId)
 	if err != nil {
 		if !errorsx.IsNotFoundError(err) {
 			slog.Debug("Failed to find sync list", "error", err)
-			return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+			return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 		}
 
 		slog.Debug("Failed to find sync list", "error", err)
-		return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+		return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Debug("User does not own the sync list", "userID", helpers.GetUserSessionData(c).Id, "listID", listId)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	if len(list.Mailboxes) == 0 {
 		slog.Debug("Sync list has no mailboxes", "listID", listId)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
-	job, err := models.FindJobByRelated(c.Request().Context(), "mailboxes", mailboxId)
+	err = stopMailboxMigration(c.Request().Context(), mailboxId)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
-		slog.Debug("Failed to find job", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
-	}
-
-	if job == nil || !(job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending) {
-		slog.Debug("Job not found or not running")
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
-	}
+		if errors.Is(err, errJobNotActive) {
+			slog.Debug("Job not running or pending", "mailboxID", mailboxId)
+			return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+		}
 
-	job.Status = models.JobStatusInterrupted
-	err = models.UpdateJob(c.Request().Context(), job)
-	if err != nil {
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		slog.Debug("Failed to stop mailbox migration", "error", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	runningJob := worker.GetRunningJob(job.Id)
-	if runningJob == nil {
-		slog.Debug("Running job not found")
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+	if helpers.WantsJSON(c) {
+		return c.NoContent(http.StatusAccepted)
 	}
 
-	runningJob.Cancel()
-
 	page, err := helpers.QueryParamAsInt(c, "page")
 	if err != nil {
 		return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id))
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"app/errorsx"
+	"app/jobs"
+	"app/models"
+	"app/worker"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	errJobActive    = errors.New("job is running or pending")
+	errJobNotActive = errors.New("job is not running or pending")
+)
+
+// Shared by the HTML and JSON handlers. The caller is responsible for loading
+// the sync list with its mailboxes and checking that the user owns it.
+
+func isJobActive(job *models.Job) bool {
+	return job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending
+}
+
+func ensureNoActiveJobs(ctx context.Context, mailboxIds []int) error {
+	if len(mailboxIds) == 0 {
+		return nil
+	}
+
+	relatedJobs, err := models.FindJobsByManyRelated(ctx, "mailboxes", mailboxIds)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range relatedJobs {
+		if isJobActive(job) {
+			return errJobActive
+		}
+	}
+
+	return nil
+}
+
+// ensureImapSource refuses the jobs that read the source folder by folder, a
+// POP3 source only supports migration runs.
+func ensureImapSource(list *models.SyncList) error {
+	if list.SrcProtocol == models.SourceProtocolPop3 {
+		return jobs.ErrImapSourceRequired
+	}
+
+	return nil
+}
+
+func ensureNoLiveSync(ctx context.Context, syncListId int) error {
+	active, err := jobs.IsLiveSyncActive(ctx, syncListId)
+	if err != nil {
+		return err
+	}
+	if active {
+		return errJobActive
+	}
+
+	return nil
+}
+
+// startFinalSync switches the list to its cutover pass. Schedules are disabled
+// so no incremental run interferes, and every mailbox is enqueued.
+func startFinalSync(ctx context.Context, list *models.SyncList, userId int) error {
+	err := ensureImapSource(list)
+	if err != nil {
+		return err
+	}
+
+	if list.IsCutOver() {
+		return jobs.ErrSyncListCutOver
+	}
+
+	mailboxIds := make([]int, len(list.Mailboxes))
+	for i, mailbox := range list.Mailboxes {
+		mailboxIds[i] = mailbox.Id
+	}
+
+	err = ensureNoActiveJobs(ctx, mailboxIds)
+	if err != nil {
+		return err
+	}
+
+	err = ensureNoLiveSync(ctx, list.Id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	list.FinalSyncStartedAt = &now
+	list.Schedule = nil
+	list.NextRunAt = nil
+
+	err = models.UpdateSyncList(ctx, list)
+	if err != nil {
+		return err
+	}
+
+	return jobs.EnqueueSyncListMigration(ctx, list, userId)
+}
+
+func stopSyncListMigration(ctx context.Context, list *models.SyncList) error {
+	if len(list.Mailboxes) == 0 {
+		return nil
+	}
+
+	mailboxIds := make([]int, len(list.Mailboxes))
+	for i, mailbox := range list.Mailboxes {
+		mailboxIds[i] = mailbox.Id
+	}
+
+	relatedJobs, err := models.FindJobsByManyRelated(ctx, "mailboxes", mailboxIds)
+	if err != nil {
+		return err
+	}
+
+	// Running jobs announce their interruption from the worker once cancelled
+	dequeuedJobs := make([]*models.Job, 0)
+	for _, job := range relatedJobs {
+		if job.Status == models.JobStatusPending {
+			dequeuedJobs = append(dequeuedJobs, job)
+		}
+
+		job.Status = models.JobStatusInterrupted
+
+		runningJob := worker.GetRunningJob(job.Id)
+		if runningJob != nil {
+			runningJob.Cancel()
+		}
+	}
+
+	err = models.UpdateJobs(ctx, relatedJobs)
+	if err != nil {
+		return err
+	}
+
+	jobs.DispatchJobEvents(ctx, dequeuedJobs)
+	return nil
+}
+
+func startMailboxMigration(ctx context.Context, list *models.SyncList, mailboxId int, userId int) error {
+	if list.IsCutOver() {
+		return jobs.ErrSyncListCutOver
+	}
+
+	err := ensureNoLiveSync(ctx, list.Id)
+	if err != nil {
+		return err
+	}
+
+	job, err := models.FindJobByRelated(ctx, "mailboxes", mailboxId)
+	if err != nil && !errorsx.IsNotFoundError(err) {
+		return err
+	}
+
+	if err == nil {
+		if isJobActive(job) {
+			return errJobActive
+		}
+
+		job.Status = models.JobStatusPending
+		now := time.Now()
+		job.StartedAt = &now
+
+		err = models.UpdateJob(ctx, job)
+		if err != nil {
+			return err
+		}
+
+		jobs.DispatchJobEvent(ctx, job)
+		return nil
+	}
+
+	payloadJson, err := json.Marshal(jobs.MigrateMailboxPayload{
+		SyncListId: list.Id,
+		MailboxId:  mailboxId,
+	})
+	if err != nil {
+		return err
+	}
+
+	job, err = models.CreateJobWithRelated(ctx, userId, jobs.MigrateMailboxType, "mailboxes", mailboxId, (*json.RawMessage)(&payloadJson))
+	if err != nil {
+		return err
+	}
+
+	jobs.DispatchJobEvent(ctx, job)
+	return nil
+}
+
+func stopMailboxMigration(ctx context.Context, mailboxId int) error {
+	job, err := models.FindJobByRelated(ctx, "mailboxes", mailboxId)
+	if err != nil {
+		return err
+	}
+
+	if !isJobActive(job) {
+		return errJobNotActive
+	}
+
+	wasPending := job.Status == models.JobStatusPending
+	job.Status = models.JobStatusInterrupted
+	err = models.UpdateJob(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	runningJob := worker.GetRunningJob(job.Id)
+	if runningJob != nil {
+		runningJob.Cancel()
+	}
+
+	if wasPending {
+		jobs.DispatchJobEvent(ctx, job)
+	}
+
+	return nil
+}
+
+// findLiveSyncJob returns nil when the list never had a live sync.
+func findLiveSyncJob(ctx context.Context, syncListId int) (*models.Job, error) {
+	job, err := models.FindJobByRelatedAndType(ctx, jobs.LiveSyncRelatedTable, syncListId, jobs.LiveSyncType)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func liveSyncJobFolders(job *models.Job) []string {
+	if job == nil || job.Payload == nil {
+		return nil
+	}
+
+	var payload jobs.LiveSyncPayload
+	err := json.Unmarshal(*job.Payload, &payload)
+	if err != nil {
+		return nil
+	}
+
+	return payload.Folders
+}
+
+// startLiveSync queues the live sync job of the list once no mailbox job is
+// active. The list keeps a single live sync job row that is reset to pending.
+func startLiveSync(ctx context.Context, list *models.SyncList, userId int, folders []string) error {
+	err := ensureImapSource(list)
+	if err != nil {
+		return err
+	}
+
+	if list.IsCutOver() {
+		return jobs.ErrSyncListCutOver
+	}
+
+	mailboxIds := make([]int, len(list.Mailboxes))
+	for i, mailbox := range list.Mailboxes {
+		mailboxIds[i] = mailbox.Id
+	}
+
+	err = ensureNoActiveJobs(ctx, mailboxIds)
+	if err != nil {
+		return err
+	}
+
+	payloadJson, err := json.Marshal(jobs.LiveSyncPayload{
+		SyncListId: list.Id,
+		Folders:    jobs.LiveSyncFolders(folders),
+	})
+	if err != nil {
+		return err
+	}
+
+	job, err := models.FindJobByRelatedAndType(ctx, jobs.LiveSyncRelatedTable, list.Id, jobs.LiveSyncType)
+	if err != nil && !errorsx.IsNotFoundError(err) {
+		return err
+	}
+
+	if err == nil {
+		if isJobActive(job) {
+			return errJobActive
+		}
+
+		job.Status = models.JobStatusPending
+		now := time.Now()
+		job.StartedAt = &now
+		job.Payload = (*json.RawMessage)(&payloadJson)
+
+		err = models.UpdateJob(ctx, job)
+		if err != nil {
+			return err
+		}
+
+		jobs.DispatchJobEvent(ctx, job)
+		return nil
+	}
+
+	job, err = models.CreateJobWithRelated(ctx, userId, jobs.LiveSyncType, jobs.LiveSyncRelatedTable, list.Id, (*json.RawMessage)(&payloadJson))
+	if err != nil {
+		return err
+	}
+
+	jobs.DispatchJobEvent(ctx, job)
+	return nil
+}
+
+func stopLiveSync(ctx context.Context, syncListId int) error {
+	job, err := models.FindJobByRelatedAndType(ctx, jobs.LiveSyncRelatedTable, syncListId, jobs.LiveSyncType)
+	if err != nil {
+		return err
+	}
+
+	if !isJobActive(job) {
+		return errJobNotActive
+	}
+
+	wasPending := job.Status == models.JobStatusPending
+	job.Status = models.JobStatusInterrupted
+	err = models.UpdateJob(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	runningJob := worker.GetRunningJob(job.Id)
+	if runningJob != nil {
+		runningJob.Cancel()
+	}
+
+	if wasPending {
+		jobs.DispatchJobEvent(ctx, job)
+	}
+
+	return nil
+}
+
+// startSyncListJob queues a plan or verification job of the list. Like live
+// sync the list keeps a single job row per type that is reset to pending.
+func startSyncListJob(ctx context.Context, list *models.SyncList, userId int, jobType models.JobType, payload any) error {
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	job, err := models.FindJobByRelatedAndType(ctx, jobs.SyncListRelatedTable, list.Id, jobType)
+	if err != nil && !errorsx.IsNotFoundError(err) {
+		return err
+	}
+
+	if err == nil {
+		if isJobActive(job) {
+			return errJobActive
+		}
+
+		job.Status = models.JobStatusPending
+		now := time.Now()
+		job.StartedAt = &now
+		job.Payload = (*json.RawMessage)(&payloadJson)
+
+		err = models.UpdateJob(ctx, job)
+		if err != nil {
+			return err
+		}
+
+		jobs.DispatchJobEvent(ctx, job)
+		return nil
+	}
+
+	job, err = models.CreateJobWithRelated(ctx, userId, jobType, jobs.SyncListRelatedTable, list.Id, (*json.RawMessage)(&payloadJson))
+	if err != nil {
+		return err
+	}
+
+	jobs.DispatchJobEvent(ctx, job)
+	return nil
+}
+
+func startPlan(ctx context.Context, list *models.SyncList, userId int) error {
+	err := ensureImapSource(list)
+	if err != nil {
+		return err
+	}
+
+	return startSyncListJob(ctx, list, userId, jobs.PlanSyncListType, jobs.PlanSyncListPayload{SyncListId: list.Id})
+}
+
+func startVerification(ctx context.Context, list *models.SyncList, userId int) error {
+	err := ensureImapSource(list)
+	if err != nil {
+		return err
+	}
+
+	return startSyncListJob(ctx, list, userId, jobs.VerifySyncListType, jobs.VerifySyncListPayload{SyncListId: list.Id})
+}
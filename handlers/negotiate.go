@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"app/helpers"
+	"app/templates/components/alert"
+	"app/templates/pages/base"
+	"errors"
+
+	"github.com/a-h/templ"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v5"
+)
+
+// Helpers for routes that serve both htmx and JSON clients. Requests sending
+// "Accept: application/json" get a typed body or RFC 7807 problem details,
+// everything else keeps receiving HTML.
+
+func renderAlertError(c *echo.Context, statusCode int, message string) error {
+	if helpers.WantsJSON(c) {
+		return helpers.Problem(c, statusCode, message)
+	}
+
+	return helpers.Render(c, statusCode, alert.Error(message))
+}
+
+func renderPageError(c *echo.Context, statusCode int, message string) error {
+	if helpers.WantsJSON(c) {
+		return helpers.Problem(c, statusCode, message)
+	}
+
+	return helpers.Render(c, statusCode, base.Error(message))
+}
+
+func renderFormError(c *echo.Context, statusCode int, err error, t templ.Component) error {
+	if !helpers.WantsJSON(c) {
+		return helpers.RenderFragment(c, statusCode, "form", t)
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make(map[string]string)
+		for field, msg := range helpers.FormatErrors(validationErrs) {
+			fields[lowerFirst(field)] = msg
+		}
+
+		return helpers.ProblemWithErrors(c, statusCode, helpers.MsgErrBadRequest, fields)
+	}
+
+	return helpers.Problem(c, statusCode, helpers.FormatErrors(err)["_Error"])
+}
+
+func respond(c *echo.Context, statusCode int, body any, redirectURL string) error {
+	if helpers.WantsJSON(c) {
+		if body == nil {
+			return c.NoContent(statusCode)
+		}
+
+		return c.JSON(statusCode, body)
+	}
+
+	return helpers.Redirect(c, redirectURL)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"app/errorsx"
+	"app/helpers"
+	"app/models"
+	"app/templates/pages/synclist/report"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+func ReportIndex(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	page, err := helpers.QueryParamAsInt(c, "page")
+	if err != nil {
+		slog.Error("failed to parse page parameter", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := models.FindSyncListById(ctx, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		return renderPageError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	reportsPaginated, err := models.FindReportsBySyncListIdPaginated(ctx, list.Id, page)
+	if err != nil {
+		slog.Error("failed to find reports", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if helpers.WantsJSON(c) {
+		res := ReportsResponse{
+			Data:       make([]ReportResponse, len(reportsPaginated.Reports)),
+			Pagination: newPaginationResponse(reportsPaginated.Pagination),
+		}
+		for i, r := range reportsPaginated.Reports {
+			res.Data[i] = newReportResponse(r)
+		}
+
+		return c.JSON(http.StatusOK, res)
+	}
+
+	return helpers.Render(c, http.StatusOK, report.Index(report.IndexProps{
+		SyncList:         list,
+		PaginatedReports: reportsPaginated,
+	}))
+}
+
+func ReportShow(c *echo.Context) error {
+	listId, err := helpers.ParamAsInt(c, "listId")
+	if err != nil {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := models.FindSyncListById(ctx, listId)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		return renderPageError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	r, err := models.FindReportByIdWithMailbox(ctx, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find report", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if r.SyncListId != list.Id {
+		return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+	}
+
+	if helpers.WantsJSON(c) {
+		return c.JSON(http.StatusOK, newReportResponse(r))
+	}
+
+	var data models.MailboxReportData
+	var plan *models.PlanReportData
+	if r.Type == models.ReportTypePlan {
+		plan = new(models.PlanReportData)
+		err = json.Unmarshal(r.Data, plan)
+	} else {
+		err = json.Unmarshal(r.Data, &data)
+	}
+	if err != nil {
+		slog.Error("failed to decode report data", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	return helpers.Render(c, http.StatusOK, report.Show(report.ShowProps{
+		SyncList: list,
+		Report:   r,
+		Data:     &data,
+		Plan:     plan,
+	}))
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"app/helpers"
+	"app/models"
+	"app/templates/pages/base"
+	"app/templates/pages/settings"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+func SettingsShow(c *echo.Context) error {
+	u, err := models.FindUserById(c.Request().Context(), helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		slog.Error("failed to find user", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+	}
+
+	return helpers.Render(c, http.StatusOK, settings.Show(settings.ShowProps{
+		User: u,
+	}))
+}
+
+func SettingsUpdate(c *echo.Context) error {
+	var req struct {
+		NotificationPreference string `form:"NotificationPreference" validate:"required,oneof=immediate summary off"`
+	}
+
+	u, err := models.FindUserById(c.Request().Context(), helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		slog.Error("failed to find user", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+	}
+
+	err = helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return helpers.RenderFragment(c, http.StatusBadRequest, "form", settings.Show(settings.ShowProps{
+			User:   u,
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	u.NotificationPreference = models.NotificationPreference(req.NotificationPreference)
+
+	_, err = models.UpdateUser(c.Request().Context(), u)
+	if err != nil {
+		slog.Error("failed to update user", "err", err)
+		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", settings.Show(settings.ShowProps{
+			User:   u,
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	return helpers.RenderFragment(c, http.StatusOK, "form", settings.Show(settings.ShowProps{
+		User:    u,
+		Success: helpers.MsgSuccessGeneric,
+	}))
+}
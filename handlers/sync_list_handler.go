@@ -5,14 +5,12 @@ import (
 	"app/helpers"
 	"app/jobs"
 	"app/models"
-	"app/templates/components/alert"
-	"app/templates/pages/base"
 	"app/templates/pages/synclist"
-	"app/worker"
-	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v5"
@@ -22,13 +20,13 @@ func SyncListIndex(c *echo.Context) error {
 	page, err := helpers.QueryParamAsInt(c, "page")
 	if err != nil {
 		slog.Error("Error parsing page parameter", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	syncLists, err := models.FindSyncListsByUserIdPaginated(c.Request().Context(), helpers.GetUserSessionData(c).Id, page)
 	if err != nil {
 		slog.Error("Error finding sync lists", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	listIds := make([]int, len(syncLists.SyncLists))
@@ -39,7 +37,7 @@ func SyncListIndex(c *echo.Context) error {
 	statuses, err := models.FindSyncListsStatus(c.Request().Context(), listIds)
 	if err != nil {
 		slog.Error("Error finding sync list statuses", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	jobStatusMap := make(map[int]models.JobStatus)
@@ -47,6 +45,18 @@ func SyncListIndex(c *echo.Context) error {
 		jobStatusMap[status.Id] = status.Status
 	}
 
+	if helpers.WantsJSON(c) {
+		res := SyncListsResponse{
+			Data:       make([]SyncListResponse, len(syncLists.SyncLists)),
+			Pagination: newPaginationResponse(syncLists.Pagination),
+		}
+		for i, list := range syncLists.SyncLists {
+			res.Data[i] = newSyncListResponse(list, jobStatusMap[list.Id])
+		}
+
+		return c.JSON(http.StatusOK, res)
+	}
+
 	return helpers.Render(c, http.StatusOK, synclist.Index(synclist.IndexProps{
 		PaginatedSyncLists: syncLists,
 		SyncListStatusMap:  jobStatusMap,
@@ -59,61 +69,102 @@ func SyncListNew(c *echo.Context) error {
 
 func SyncListCreate(c *echo.Context) error {
 	var req struct {
-		Name              string `form:"Name" validate:"required,max=255"`
-		SrcHost           string `form:"SrcHost" validate:"required,max=255"`
-		SrcPort           int    `form:"SrcPort" validate:"required,min=1,max=65535"`
-		DstHost           string `form:"DstHost" validate:"required,max=255"`
-		DstPort           int    `form:"DstPort" validate:"required,min=1,max=65535"`
-		CompareMessageIds bool   `form:"CompareMessageIds" validate:"boolean"`
-		CompareLastUid    bool   `form:"CompareLastUid" validate:"boolean"`
+		Name                   string `form:"Name" validate:"required,max=255"`
+		SrcHost                string `form:"SrcHost" validate:"required,max=255"`
+		SrcPort                int    `form:"SrcPort" validate:"required,min=1,max=65535"`
+		SrcProtocol            string `form:"SrcProtocol" validate:"required,oneof=imap pop3"`
+		DstHost                string `form:"DstHost" validate:"required,max=255"`
+		DstPort                int    `form:"DstPort" validate:"required,min=1,max=65535"`
+		CompareMessageIds      bool   `form:"CompareMessageIds" validate:"boolean"`
+		CompareLastUid         bool   `form:"CompareLastUid" validate:"boolean"`
+		ContentDedup           string `form:"ContentDedup" validate:"required,oneof=off headers body"`
+		SyncFlags              bool   `form:"SyncFlags" validate:"boolean"`
+		FlagRenames            string `form:"FlagRenames" validate:"max=4000,flag_renames"`
+		KeepDeletedFlags       bool   `form:"KeepDeletedFlags" validate:"boolean"`
+		GmailLabelMode         string `form:"GmailLabelMode" validate:"required,oneof=off folders keywords"`
+		TwoWay                 bool   `form:"TwoWay" validate:"boolean"`
+		DeletionPolicy         string `form:"DeletionPolicy" validate:"required,oneof=keep propagate restore"`
+		Mirror                 bool   `form:"Mirror" validate:"boolean,excluded_if=TwoWay true"`
+		MirrorMaxDeletePercent int    `form:"MirrorMaxDeletePercent" validate:"required,min=1,max=100"`
+		MirrorDryRun           bool   `form:"MirrorDryRun" validate:"boolean"`
+		ParallelFolders        int    `form:"ParallelFolders" validate:"required,min=1,max=10"`
+		MaxBytesPerSecond      int    `form:"MaxBytesPerSecond" validate:"min=0"`
+		MaxMessagesPerSecond   int    `form:"MaxMessagesPerSecond" validate:"min=0"`
+		Schedule               string `form:"Schedule" validate:"max=255,schedule"`
 	}
 
 	err := helpers.BindAndValidate(c, &req)
 	if err != nil {
-		return helpers.RenderFragment(c, http.StatusBadRequest, "form", synclist.New(synclist.NewProps{
+		return renderFormError(c, http.StatusBadRequest, err, synclist.New(synclist.NewProps{
 			Values: helpers.FormatValues(c),
 			Errors: helpers.FormatErrors(err),
 		}))
 	}
 
+	// Validated by the flag_renames tag
+	flagRenames, _ := helpers.ParseFlagRenames(req.FlagRenames)
+
 	list, err := models.CreateSyncList(c.Request().Context(), models.CreateSyncListParams{
-		UserId:            helpers.GetUserSessionData(c).Id,
-		Name:              req.Name,
-		SrcHost:           req.SrcHost,
-		SrcPort:           req.SrcPort,
-		DstHost:           req.DstHost,
-		DstPort:           req.DstPort,
-		CompareMessageIds: req.CompareMessageIds,
-		CompareLastUid:    req.CompareLastUid,
+		UserId:                 helpers.GetUserSessionData(c).Id,
+		Name:                   req.Name,
+		SrcHost:                req.SrcHost,
+		SrcPort:                req.SrcPort,
+		SrcProtocol:            models.SourceProtocol(req.SrcProtocol),
+		DstHost:                req.DstHost,
+		DstPort:                req.DstPort,
+		CompareMessageIds:      req.CompareMessageIds,
+		CompareLastUid:         req.CompareLastUid,
+		ContentDedup:           models.ContentDedup(req.ContentDedup),
+		SyncFlags:              req.SyncFlags,
+		FlagRenames:            flagRenames,
+		KeepDeletedFlags:       req.KeepDeletedFlags,
+		GmailLabelMode:         models.GmailLabelMode(req.GmailLabelMode),
+		TwoWay:                 req.TwoWay,
+		DeletionPolicy:         models.DeletionPolicy(req.DeletionPolicy),
+		Mirror:                 req.Mirror,
+		MirrorMaxDeletePercent: req.MirrorMaxDeletePercent,
+		MirrorDryRun:           req.MirrorDryRun,
+		ParallelFolders:        req.ParallelFolders,
+		MaxBytesPerSecond:      req.MaxBytesPerSecond,
+		MaxMessagesPerSecond:   req.MaxMessagesPerSecond,
+		Schedule:               req.Schedule,
 	})
 	if err != nil {
 		slog.Error("failed to create sync list", "err", err)
-		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", synclist.New(synclist.NewProps{
+		return renderFormError(c, http.StatusInternalServerError, err, synclist.New(synclist.NewProps{
 			Values: helpers.FormatValues(c),
 			Errors: helpers.FormatErrors(err),
 		}))
 	}
 
-	return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id))
+	return respond(c, http.StatusCreated, newSyncListResponse(list, models.JobStatusNone), "/app/sync-lists/"+strconv.Itoa(list.Id))
 }
 
 func SyncListShow(c *echo.Context) error {
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Error("failed to parse sync list ID", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	page, err := helpers.QueryParamAsInt(c, "page")
 	if err != nil {
 		slog.Error("failed to parse page parameter", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	listPaginated, err := models.FindSyncListByIdWithMailboxesPaginated(c.Request().Context(), id, page)
 	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
 		slog.Error("failed to find sync list", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if listPaginated.SyncList.UserId != helpers.GetUserSessionData(c).Id {
+		return renderPageError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	mailboxIds := make([]int, len(listPaginated.SyncList.Mailboxes))
@@ -121,21 +172,43 @@ func SyncListShow(c *echo.Context) error {
 		mailboxIds[i] = mailbox.Id
 	}
 
-	jobs, err := models.FindJobsByManyRelated(c.Request().Context(), "mailboxes", mailboxIds)
+	mailboxJobs, err := models.FindJobsByManyRelated(c.Request().Context(), "mailboxes", mailboxIds)
 	if err != nil {
 		slog.Error("failed to find jobs", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	mailboxestatusMap := make(map[int]models.JobStatus)
-	for _, job := range jobs {
+	mailboxOverQuota := make(map[int]bool)
+	for _, job := range mailboxJobs {
 		mailboxestatusMap[*job.RelatedId] = job.Status
+		mailboxOverQuota[*job.RelatedId] = jobs.IsOverQuota(job)
 	}
 
 	listStatus, err := models.FindSyncListStatus(c.Request().Context(), listPaginated.SyncList.Id)
 	if err != nil {
 		slog.Error("failed to find sync list status", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	liveSyncJob, err := findLiveSyncJob(c.Request().Context(), listPaginated.SyncList.Id)
+	if err != nil {
+		slog.Error("failed to find live sync job", "err", err)
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if helpers.WantsJSON(c) {
+		res := SyncListShowResponse{
+			SyncListResponse: newSyncListResponse(listPaginated.SyncList, listStatus.Status),
+			LiveSync:         newLiveSyncResponse(liveSyncJob),
+			Mailboxes:        make([]MailboxResponse, len(listPaginated.SyncList.Mailboxes)),
+			Pagination:       newPaginationResponse(listPaginated.MailboxPagination),
+		}
+		for i, mailbox := range listPaginated.SyncList.Mailboxes {
+			res.Mailboxes[i] = newMailboxResponse(mailbox, mailboxestatusMap[mailbox.Id])
+		}
+
+		return c.JSON(http.StatusOK, res)
 	}
 
 	if c.QueryParam("polling") == "true" {
@@ -144,6 +217,9 @@ func SyncListShow(c *echo.Context) error {
 			SyncList:         listPaginated.SyncList,
 			SyncListStatus:   listStatus.Status,
 			MailboxStatusMap: mailboxestatusMap,
+			MailboxOverQuota: mailboxOverQuota,
+			LiveSyncJob:      liveSyncJob,
+			LiveSyncFolders:  liveSyncJobFolders(liveSyncJob),
 			PaginatedMailboxes: &models.MailboxesPaginated{
 				Mailboxes:  listPaginated.SyncList.Mailboxes,
 				Pagination: listPaginated.MailboxPagination,
@@ -155,6 +231,9 @@ func SyncListShow(c *echo.Context) error {
 		SyncList:         listPaginated.SyncList,
 		SyncListStatus:   listStatus.Status,
 		MailboxStatusMap: mailboxestatusMap,
+		MailboxOverQuota: mailboxOverQuota,
+		LiveSyncJob:      liveSyncJob,
+		LiveSyncFolders:  liveSyncJobFolders(liveSyncJob),
 		PaginatedMailboxes: &models.MailboxesPaginated{
 			Mailboxes:  listPaginated.SyncList.Mailboxes,
 			Pagination: listPaginated.MailboxPagination,
@@ -166,59 +245,81 @@ func SyncListEdit(c *echo.Context) error {
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Error("failed to parse sync list id", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	list, err := models.FindSyncListById(c.Request().Context(), id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, base.Error(helpers.MsgErrNotFound))
+			return renderPageError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("failed to find sync list", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+		return renderPageError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
-		return helpers.Render(c, http.StatusForbidden, base.Error(helpers.MsgErrForbidden))
+		return renderPageError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
+	values := helpers.StructToValues(list)
+	values["FlagRenames"] = helpers.FormatFlagRenames(list.FlagRenames)
+
 	return helpers.Render(c, http.StatusOK, synclist.Edit(synclist.EditProps{
 		List:   list,
-		Values: helpers.StructToValues(list),
+		Values: values,
 	}))
 }
 
 func SyncListUpdate(c *echo.Context) error {
 	var req struct {
-		Name              string `form:"Name" validate:"required,max=255"`
-		SrcHost           string `form:"SrcHost" validate:"required,max=255"`
-		SrcPort           int    `form:"SrcPort" validate:"required,min=1,max=65535"`
-		DstHost           string `form:"DstHost" validate:"required,max=255"`
-		DstPort           int    `form:"DstPort" validate:"required,min=1,max=65535"`
-		CompareMessageIds bool   `form:"CompareMessageIds" validate:"boolean"`
-		CompareLastUid    bool   `form:"CompareLastUid" validate:"boolean"`
+		Name                   string `form:"Name" validate:"required,max=255"`
+		SrcHost                string `form:"SrcHost" validate:"required,max=255"`
+		SrcPort                int    `form:"SrcPort" validate:"required,min=1,max=65535"`
+		SrcProtocol            string `form:"SrcProtocol" validate:"required,oneof=imap pop3"`
+		DstHost                string `form:"DstHost" validate:"required,max=255"`
+		DstPort                int    `form:"DstPort" validate:"required,min=1,max=65535"`
+		CompareMessageIds      bool   `form:"CompareMessageIds" validate:"boolean"`
+		CompareLastUid         bool   `form:"CompareLastUid" validate:"boolean"`
+		ContentDedup           string `form:"ContentDedup" validate:"required,oneof=off headers body"`
+		SyncFlags              bool   `form:"SyncFlags" validate:"boolean"`
+		FlagRenames            string `form:"FlagRenames" validate:"max=4000,flag_renames"`
+		KeepDeletedFlags       bool   `form:"KeepDeletedFlags" validate:"boolean"`
+		GmailLabelMode         string `form:"GmailLabelMode" validate:"required,oneof=off folders keywords"`
+		TwoWay                 bool   `form:"TwoWay" validate:"boolean"`
+		DeletionPolicy         string `form:"DeletionPolicy" validate:"required,oneof=keep propagate restore"`
+		Mirror                 bool   `form:"Mirror" validate:"boolean,excluded_if=TwoWay true"`
+		MirrorMaxDeletePercent int    `form:"MirrorMaxDeletePercent" validate:"required,min=1,max=100"`
+		MirrorDryRun           bool   `form:"MirrorDryRun" validate:"boolean"`
+		ParallelFolders        int    `form:"ParallelFolders" validate:"required,min=1,max=10"`
+		MaxBytesPerSecond      int    `form:"MaxBytesPerSecond" validate:"min=0"`
+		MaxMessagesPerSecond   int    `form:"MaxMessagesPerSecond" validate:"min=0"`
+		Schedule               string `form:"Schedule" validate:"max=255,schedule"`
 	}
 
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Error("failed to parse sync list id", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	list, err := models.FindSyncListByIdWithMailboxes(c.Request().Context(), id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("failed to find sync list", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Error("failed to validate sync list", "err", err)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	if list.IsCutOver() {
+		return renderAlertError(c, http.StatusConflict, helpers.MsgErrCutOver)
 	}
 
 	mailboxIds := make([]int, len(list.Mailboxes))
@@ -229,20 +330,30 @@ func SyncListUpdate(c *echo.Context) error {
 	relatedJobs, err := models.FindJobsByManyRelated(c.Request().Context(), "mailboxes", mailboxIds)
 	if err != nil {
 		slog.Error("failed to find jobs by many related", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	for _, job := range relatedJobs {
 		if job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending {
 			slog.Error("failed to validate sync list", "err", "job is running or pending")
-			return helpers.Render(c, http.StatusConflict, alert.Error(helpers.MsgErrForbidden))
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrForbidden)
+		}
+	}
+
+	err = ensureNoLiveSync(c.Request().Context(), list.Id)
+	if err != nil {
+		if errors.Is(err, errJobActive) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
 		}
+
+		slog.Error("failed to find live sync job", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	err = helpers.BindAndValidate(c, &req)
 	if err != nil {
 		slog.Error("failed to bind and validate sync list", "err", err)
-		return helpers.RenderFragment(c, http.StatusBadRequest, "form", synclist.Edit(synclist.EditProps{
+		return renderFormError(c, http.StatusBadRequest, err, synclist.Edit(synclist.EditProps{
 			List:   list,
 			Values: helpers.FormatValues(c),
 			Errors: helpers.FormatErrors(err),
@@ -252,40 +363,64 @@ func SyncListUpdate(c *echo.Context) error {
 	list.Name = req.Name
 	list.SrcHost = req.SrcHost
 	list.SrcPort = req.SrcPort
+	list.SrcProtocol = models.SourceProtocol(req.SrcProtocol)
 	list.DstHost = req.DstHost
 	list.DstPort = req.DstPort
 	list.CompareMessageIds = req.CompareMessageIds
 	list.CompareLastUid = req.CompareLastUid
+	list.ContentDedup = models.ContentDedup(req.ContentDedup)
+	list.SyncFlags = req.SyncFlags
+	list.KeepDeletedFlags = req.KeepDeletedFlags
+	list.GmailLabelMode = models.GmailLabelMode(req.GmailLabelMode)
+	list.TwoWay = req.TwoWay
+	list.DeletionPolicy = models.DeletionPolicy(req.DeletionPolicy)
+	list.Mirror = req.Mirror
+	list.MirrorMaxDeletePercent = req.MirrorMaxDeletePercent
+	list.MirrorDryRun = req.MirrorDryRun
+	list.ParallelFolders = req.ParallelFolders
+	list.MaxBytesPerSecond = req.MaxBytesPerSecond
+	list.MaxMessagesPerSecond = req.MaxMessagesPerSecond
+	// Validated by the flag_renames tag
+	list.FlagRenames, _ = helpers.ParseFlagRenames(req.FlagRenames)
+
+	err = list.ApplySchedule(req.Schedule, time.Now())
+	if err != nil {
+		return renderFormError(c, http.StatusBadRequest, err, synclist.Edit(synclist.EditProps{
+			List:   list,
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
 
 	err = models.UpdateSyncList(c.Request().Context(), list)
 	if err != nil {
 		slog.Error("failed to update sync list", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id))
+	return respond(c, http.StatusOK, newSyncListResponse(list, models.JobStatusNone), "/app/sync-lists/"+strconv.Itoa(list.Id))
 }
 
 func SyncListDelete(c *echo.Context) error {
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Error("failed to parse sync list ID", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	list, err := models.FindSyncListByIdWithMailboxes(c.Request().Context(), id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("failed to find sync list", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Error("user is not authorized to delete sync list", "err", err)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	mailboxIds := make([]int, len(list.Mailboxes))
@@ -296,45 +431,72 @@ func SyncListDelete(c *echo.Context) error {
 	relatedJobs, err := models.FindJobsByManyRelated(c.Request().Context(), "mailboxes", mailboxIds)
 	if err != nil {
 		slog.Error("failed to find related jobs", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	for _, job := range relatedJobs {
 		if job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending {
 			slog.Error("job is running or pending", "err", err)
-			return helpers.Render(c, http.StatusConflict, alert.Error(helpers.MsgErrForbidden))
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrForbidden)
+		}
+	}
+
+	err = ensureNoLiveSync(c.Request().Context(), list.Id)
+	if err != nil {
+		if errors.Is(err, errJobActive) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
+		}
+
+		slog.Error("failed to find live sync job", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	err = jobs.RemoveMailboxArchives(c.Request().Context(), mailboxIds)
+	if err != nil {
+		if errors.Is(err, jobs.ErrArchiveJobActive) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
 		}
+
+		slog.Error("failed to remove archives", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	err = models.DeleteSyncListById(c.Request().Context(), id)
 	if err != nil {
 		slog.Error("failed to delete sync list", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	// Live sync, plan and verification jobs of the list
+	err = models.DeleteJobsByRelated(c.Request().Context(), jobs.SyncListRelatedTable, id)
+	if err != nil {
+		slog.Error("failed to delete sync list jobs", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	return helpers.Redirect(c, "/app/sync-lists")
+	return respond(c, http.StatusNoContent, nil, "/app/sync-lists")
 }
 
 func SyncListDeleteJobs(c *echo.Context) error {
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Error("failed to parse id", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	list, err := models.FindSyncListByIdWithMailboxes(c.Request().Context(), id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("failed to find sync list", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != helpers.GetUserSessionData(c).Id {
 		slog.Error("user is not authorized to delete sync list", "err", err)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	mailboxIds := make([]int, len(list.Mailboxes))
@@ -345,7 +507,11 @@ func SyncListDeleteJobs(c *echo.Context) error {
 	err = models.DeleteJobsByManyRelated(c.Request().Context(), "mailboxes", mailboxIds)
 	if err != nil {
 		slog.Error("failed to delete jobs", "err", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if helpers.WantsJSON(c) {
+		return c.NoContent(http.StatusNoContent)
 	}
 
 	page, err := helpers.QueryParamAsInt(c, "page")
@@ -360,7 +526,7 @@ func SyncListJobMigrateStart(c *echo.Context) error {
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
 		slog.Debug("Invalid ID parameter", "error", err)
-		return helpers.Render(c, http.StatusBadRequest, alert.Error(helpers.MsgErrBadRequest))
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 
 	ctx := c.Request().Context()
@@ -369,85 +535,157 @@ func SyncListJobMigrateStart(c *echo.Context) error {
 	list, err := models.FindSyncListByIdWithMailboxes(ctx, id)
 	if err != nil {
 		slog.Debug("Failed to find sync list", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != userId {
 		slog.Debug("Unauthorized access attempt", "userID", userId, "listID", id)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	if len(list.Mailboxes) == 0 {
 		return c.NoContent(http.StatusOK)
 	}
 
-	mailboxIds := make([]int, 0)
-	for _, mailbox := range list.Mailboxes {
-		mailboxIds = append(mailboxIds, mailbox.Id)
+	err = jobs.EnqueueSyncListMigration(ctx, list, userId)
+	if err != nil {
+		if errors.Is(err, jobs.ErrSyncListCutOver) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrCutOver)
+		}
+		if errors.Is(err, jobs.ErrLiveSyncActive) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
+		}
+
+		slog.Error("Failed to start sync list migration", "error", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	jobsByMailboxId, err := models.FindJobsByManyRelatedMap(ctx, "mailboxes", mailboxIds)
+	return respond(c, http.StatusAccepted, nil, "/app/sync-lists/"+strconv.Itoa(list.Id))
+}
+
+func SyncListFinalSyncStart(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
-		slog.Debug("Failed to find existing jobs", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 
-	jobsToUpdate := make([]*models.Job, 0)
-	newJobPayloads := make([]*json.RawMessage, 0)
-	newJobMailboxIds := make([]int, 0)
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
 
-	for _, mailboxId := range mailboxIds {
-		relJobs, exists := jobsByMailboxId[mailboxId]
-		if len(relJobs) > 1 {
-			slog.Error("Found multiple jobs for mailbox", "mailbox_id", mailboxId)
-			return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		slog.Error("failed to find sync list", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != userId {
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	err = startFinalSync(ctx, list, userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrImapSourceRequired):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrImapSource)
+		case errors.Is(err, jobs.ErrSyncListCutOver):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrCutOver)
+		case errors.Is(err, errJobActive):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
+		}
+
+		slog.Error("failed to start final sync", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	return respond(c, http.StatusAccepted, nil, "/app/sync-lists/"+strconv.Itoa(list.Id))
+}
+
+func SyncListPlanStart(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
-		if exists {
-			relJobs[0].Status = models.JobStatusPending
-			now := time.Now()
-			relJobs[0].StartedAt = &now
-			relJobs[0].FinishedAt = nil
-			jobsToUpdate = append(jobsToUpdate, relJobs[0])
-		} else {
-			payload := jobs.MigrateMailboxPayload{
-				SyncListId: list.Id,
-				MailboxId:  mailboxId,
-			}
-
-			payloadJson, err := json.Marshal(payload)
-			if err != nil {
-				slog.Debug("Failed to marshal payload", "error", err)
-				return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
-			}
-
-			newJobPayloads = append(newJobPayloads, (*json.RawMessage)(&payloadJson))
-			newJobMailboxIds = append(newJobMailboxIds, mailboxId)
+		slog.Error("failed to find sync list", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != userId {
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	err = startPlan(ctx, list, userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrImapSourceRequired):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrImapSource)
+		case errors.Is(err, errJobActive):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
 		}
+
+		slog.Error("failed to start plan", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	if len(jobsToUpdate) > 0 {
-		if err := models.UpdateJobs(ctx, jobsToUpdate); err != nil {
-			slog.Debug("Failed to update jobs", "error", err)
-			return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+	return respond(c, http.StatusAccepted, nil, "/app/sync-lists/"+strconv.Itoa(list.Id)+"/reports")
+}
+
+func SyncListVerifyStart(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
+	}
+
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
+
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
+
+		slog.Error("failed to find sync list", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != userId {
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
-	if len(newJobPayloads) > 0 {
-		_, err = models.CreateJobsWithRelated(ctx, userId, jobs.MigrateMailboxType, "mailboxes", newJobMailboxIds, newJobPayloads)
-		if err != nil {
-			slog.Debug("Failed to create jobs", "error", err)
-			return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+	err = startVerification(ctx, list, userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrImapSourceRequired):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrImapSource)
+		case errors.Is(err, errJobActive):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
 		}
+
+		slog.Error("failed to start verification", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id))
+	return respond(c, http.StatusAccepted, nil, "/app/sync-lists/"+strconv.Itoa(list.Id)+"/reports")
 }
 
 func SyncListJobMigrateStop(c *echo.Context) error {
 	id, err := helpers.ParamAsInt(c, "id")
 	if err != nil {
-		return helpers.Render(c, http.StatusBadRequest, alert.Error(helpers.MsgErrBadRequest))
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 
 	ctx := c.Request().Context()
@@ -456,45 +694,116 @@ func SyncListJobMigrateStop(c *echo.Context) error {
 	list, err := models.FindSyncListByIdWithMailboxes(c.Request().Context(), id)
 	if err != nil {
 		if errorsx.IsNotFoundError(err) {
-			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
 
 		slog.Error("Failed to find sync list", "error", err)
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
 	if list.UserId != userId {
 		slog.Error("Unauthorized access to sync list", "sync_list_id", list.Id, "user_id", userId)
-		return helpers.Render(c, http.StatusForbidden, alert.Error(helpers.MsgErrForbidden))
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
 	}
 
 	if len(list.Mailboxes) == 0 {
 		return c.NoContent(http.StatusOK)
 	}
 
-	mailboxIds := make([]int, len(list.Mailboxes))
-	for i, mailbox := range list.Mailboxes {
-		mailboxIds[i] = mailbox.Id
+	err = stopSyncListMigration(ctx, list)
+	if err != nil {
+		slog.Error("Failed to stop sync list migration", "error", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	return respond(c, http.StatusAccepted, nil, "/app/sync-lists/"+strconv.Itoa(list.Id))
+}
+
+func SyncListLiveSyncStart(c *echo.Context) error {
+	var req struct {
+		Folders string `form:"Folders" validate:"max=1000"`
+	}
+
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 
-	jobs, err := models.FindJobsByManyRelated(ctx, "mailboxes", mailboxIds)
+	err = helpers.BindAndValidate(c, &req)
 	if err != nil {
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
 	}
 
-	for _, job := range jobs {
-		job.Status = models.JobStatusInterrupted
+	ctx := c.Request().Context()
+	userId := helpers.GetUserSessionData(c).Id
 
-		runningJob := worker.GetRunningJob(job.Id)
-		if runningJob != nil {
-			runningJob.Cancel()
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
 		}
+
+		slog.Error("failed to find sync list", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	err = models.UpdateJobs(ctx, jobs)
+	if list.UserId != userId {
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return c.NoContent(http.StatusOK)
+	}
+
+	err = startLiveSync(ctx, list, userId, strings.Split(req.Folders, ","))
 	if err != nil {
-		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+		switch {
+		case errors.Is(err, jobs.ErrImapSourceRequired):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrImapSource)
+		case errors.Is(err, jobs.ErrSyncListCutOver):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrCutOver)
+		case errors.Is(err, errJobActive):
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrConflict)
+		}
+
+		slog.Error("failed to start live sync", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	return respond(c, http.StatusAccepted, nil, "/app/sync-lists/"+strconv.Itoa(list.Id))
+}
+
+func SyncListLiveSyncStop(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return renderAlertError(c, http.StatusBadRequest, helpers.MsgErrBadRequest)
+	}
+
+	ctx := c.Request().Context()
+
+	list, err := models.FindSyncListById(ctx, id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return renderAlertError(c, http.StatusNotFound, helpers.MsgErrNotFound)
+		}
+
+		slog.Error("failed to find sync list", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+	}
+
+	if list.UserId != helpers.GetUserSessionData(c).Id {
+		return renderAlertError(c, http.StatusForbidden, helpers.MsgErrForbidden)
+	}
+
+	err = stopLiveSync(ctx, list.Id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) || errors.Is(err, errJobNotActive) {
+			return renderAlertError(c, http.StatusConflict, helpers.MsgErrBadRequest)
+		}
+
+		slog.Error("failed to stop live sync", "err", err)
+		return renderAlertError(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
 	}
 
-	return helpers.Redirect(c, "/app/sync-lists/"+strconv.Itoa(list.Id))
+	return respond(c, http.StatusAccepted, nil, "/app/sync-lists/"+strconv.Itoa(list.Id))
 }
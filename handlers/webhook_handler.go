@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"app/config"
+	"app/errorsx"
+	"app/helpers"
+	"app/models"
+	"app/templates/components/alert"
+	"app/templates/pages/base"
+	"app/templates/pages/webhook"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+func WebhookIndex(c *echo.Context) error {
+	webhooks, err := models.FindWebhooksByUserId(c.Request().Context(), helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		slog.Error("failed to find webhooks", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+	}
+
+	return helpers.Render(c, http.StatusOK, webhook.Index(webhook.IndexProps{
+		Webhooks: webhooks,
+	}))
+}
+
+func WebhookNew(c *echo.Context) error {
+	return helpers.Render(c, http.StatusOK, webhook.New(webhook.NewProps{}))
+}
+
+func WebhookCreate(c *echo.Context) error {
+	var req struct {
+		Url    string   `form:"Url" validate:"required,http_url,max=2048"`
+		Events []string `form:"Events" validate:"required,min=1,dive,oneof=job.queued job.started job.completed job.failed job.interrupted"`
+	}
+
+	err := helpers.BindAndValidate(c, &req)
+	if err != nil {
+		return helpers.RenderFragment(c, http.StatusBadRequest, "form", webhook.New(webhook.NewProps{
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	_, secret, err := helpers.GenerateToken()
+	if err != nil {
+		slog.Error("failed to generate webhook secret", "err", err)
+		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", webhook.New(webhook.NewProps{
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	// The secret is needed in clear to sign deliveries, so it is encrypted
+	// like mailbox passwords rather than hashed
+	secretHash, err := helpers.AesEncrypt(secret, config.Config.AppKey)
+	if err != nil {
+		slog.Error("failed to encrypt webhook secret", "err", err)
+		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", webhook.New(webhook.NewProps{
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	events := make([]models.WebhookEvent, len(req.Events))
+	for i, event := range req.Events {
+		events[i] = models.WebhookEvent(event)
+	}
+
+	_, err = models.CreateWebhook(c.Request().Context(), helpers.GetUserSessionData(c).Id, req.Url, secretHash, events)
+	if err != nil {
+		slog.Error("failed to create webhook", "err", err)
+		return helpers.RenderFragment(c, http.StatusInternalServerError, "form", webhook.New(webhook.NewProps{
+			Values: helpers.FormatValues(c),
+			Errors: helpers.FormatErrors(err),
+		}))
+	}
+
+	return helpers.Render(c, http.StatusOK, webhook.Created(webhook.CreatedProps{
+		Secret: secret,
+	}))
+}
+
+func WebhookShow(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Render(c, http.StatusNotFound, base.Error(helpers.MsgErrNotFound))
+	}
+
+	page, err := helpers.QueryParamAsInt(c, "page")
+	if err != nil {
+		slog.Error("failed to parse page parameter", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+	}
+
+	hook, err := models.FindWebhookById(c.Request().Context(), id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return helpers.Render(c, http.StatusNotFound, base.Error(helpers.MsgErrNotFound))
+		}
+
+		slog.Error("failed to find webhook", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+	}
+
+	if hook.UserId != helpers.GetUserSessionData(c).Id {
+		return helpers.Render(c, http.StatusForbidden, base.Error(helpers.MsgErrForbidden))
+	}
+
+	deliveriesPaginated, err := models.FindWebhookDeliveriesByWebhookIdPaginated(c.Request().Context(), hook.Id, page)
+	if err != nil {
+		slog.Error("failed to find webhook deliveries", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, base.Error(helpers.MsgErrGeneric))
+	}
+
+	return helpers.Render(c, http.StatusOK, webhook.Show(webhook.ShowProps{
+		Webhook:    hook,
+		Deliveries: deliveriesPaginated.Deliveries,
+		Pagination: deliveriesPaginated.Pagination,
+	}))
+}
+
+func WebhookDelete(c *echo.Context) error {
+	id, err := helpers.ParamAsInt(c, "id")
+	if err != nil {
+		return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+	}
+
+	err = models.DeleteWebhookByIdAndUserId(c.Request().Context(), id, helpers.GetUserSessionData(c).Id)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return helpers.Render(c, http.StatusNotFound, alert.Error(helpers.MsgErrNotFound))
+		}
+
+		slog.Error("failed to delete webhook", "err", err)
+		return helpers.Render(c, http.StatusInternalServerError, alert.Error(helpers.MsgErrGeneric))
+	}
+
+	return helpers.Redirect(c, "/app/webhooks")
+}
@@ -19,10 +19,12 @@ func GenerateToken() (string, string, error) {
 	}
 	confirmToken := base64.RawURLEncoding.EncodeToString(rawToken)
 
-	rawConfirmTokenHash := sha256.Sum256([]byte(confirmToken))
-	confirmTokenHash := hex.EncodeToString(rawConfirmTokenHash[:])
+	return HashToken(confirmToken), confirmToken, nil
+}
 
-	return confirmTokenHash, string(rawToken), nil
+func HashToken(token string) string {
+	rawTokenHash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(rawTokenHash[:])
 }
 
 func AesEncrypt(password string, keyStr string) (string, error) {
@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Flag renames map source flags to the flag set on the destination copy. In
+// forms they are written as comma separated pairs, e.g.
+// "$label1=Important, NonJunk=$NotJunk".
+
+var ErrInvalidFlagRenames = errors.New("invalid flag renames")
+
+const MaxFlagRenames = 100
+
+var systemFlags = []string{"\\seen", "\\answered", "\\flagged", "\\deleted", "\\draft"}
+
+// IsValidFlag accepts IMAP keywords and the system flags a client may set.
+func IsValidFlag(flag string) bool {
+	if flag == "" || len(flag) > 255 {
+		return false
+	}
+
+	if strings.HasPrefix(flag, "\\") {
+		return slices.Contains(systemFlags, strings.ToLower(flag))
+	}
+
+	for _, r := range flag {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune("(){%*\"\\]", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ParseFlagRenames(spec string) (map[string]string, error) {
+	renames := make(map[string]string)
+
+	for pair := range strings.SplitSeq(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || !IsValidFlag(from) || !IsValidFlag(to) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidFlagRenames, pair)
+		}
+
+		renames[from] = to
+	}
+
+	if len(renames) > MaxFlagRenames {
+		return nil, fmt.Errorf("%w: at most %d renames", ErrInvalidFlagRenames, MaxFlagRenames)
+	}
+
+	return renames, nil
+}
+
+// FormatFlagRenames is the inverse of ParseFlagRenames, sorted by source flag.
+func FormatFlagRenames(renames map[string]string) string {
+	froms := make([]string, 0, len(renames))
+	for from := range renames {
+		froms = append(froms, from)
+	}
+	slices.Sort(froms)
+
+	pairs := make([]string, len(froms))
+	for i, from := range froms {
+		pairs[i] = from + "=" + renames[from]
+	}
+
+	return strings.Join(pairs, ", ")
+}
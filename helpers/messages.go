@@ -10,10 +10,21 @@ var (
 	MsgErrTooLong            = "Value must be less than %s characters"
 	MsgErrInvalid            = "Invalid value"
 	MsgErrMismatch           = "Values do not match"
+	MsgErrExcludedIf         = "Can't be combined with %s"
 	MsgErrBadCredentials     = "Invalid email or password"
 	MsgErrJobQueueFull       = "Job queue is full"
 	MsgErrWorkersUnavailable = "No available workers"
 	MsgErrForbidden          = "Unauthorized"
+	MsgErrUnauthenticated    = "Invalid or missing API token"
+	MsgErrInsufficientScope  = "API token does not have the required scope"
+	MsgErrConflict           = "A job is running or pending"
+	MsgErrCutOver            = "Sync list is cut over and read-only"
+	MsgErrImapSource         = "The source is read over POP3, final sync, plan, verification and live sync need an IMAP source"
+	MsgErrInvalidSchedule    = "Use a cron expression such as \"0 2 * * *\" or an interval such as \"@every 6h\""
+	MsgErrInvalidFlagRenames = "Use comma separated pairs of keywords such as \"$label1=Important\""
+	MsgErrArchiveRequired    = "Upload an archive or give its path on the server"
+	MsgErrArchivePath        = "Give an existing file or directory inside the import directory"
+	MsgErrArchiveUpload      = "Upload an archive, server paths are disabled"
 
 	MsgSuccessGeneric     = "Action completed successfully"
 	MsgSuccessMessageSent = "Message sent"
@@ -2,6 +2,7 @@ package helpers
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v5"
 )
@@ -37,3 +38,11 @@ func QueryParamAsInt(c *echo.Context, param string) (int, error) {
 
 	return strconv.Atoi(value)
 }
+
+func IsApiRequest(c *echo.Context) bool {
+	return strings.HasPrefix(c.Request().URL.Path, "/api/")
+}
+
+func HasBearerToken(c *echo.Context) bool {
+	return strings.HasPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+}
@@ -2,9 +2,11 @@ package helpers
 
 import (
 	"app/errorsx"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"reflect"
 	"strings"
 
@@ -41,6 +43,47 @@ func Redirect(c *echo.Context, url string) error {
 	return c.Redirect(303, url)
 }
 
+// ProblemDetails is an RFC 7807 error body.
+type ProblemDetails struct {
+	Type   string            `json:"type"`
+	Title  string            `json:"title"`
+	Status int               `json:"status"`
+	Detail string            `json:"detail,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+func WantsJSON(c *echo.Context) bool {
+	if IsApiRequest(c) {
+		return true
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return false
+	}
+
+	accept := c.Request().Header.Get("Accept")
+	return strings.Contains(accept, "application/json") || strings.Contains(accept, "application/problem+json")
+}
+
+func Problem(c *echo.Context, statusCode int, detail string) error {
+	return ProblemWithErrors(c, statusCode, detail, nil)
+}
+
+func ProblemWithErrors(c *echo.Context, statusCode int, detail string, errs map[string]string) error {
+	body, err := json.Marshal(ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: detail,
+		Errors: errs,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Blob(statusCode, "application/problem+json", body)
+}
+
 func FormatValues(c *echo.Context) map[string]string {
 	values := make(map[string]string)
 	form, err := c.FormValues()
@@ -87,6 +130,12 @@ func FormatErrors(err error) map[string]string {
 			errs[field] = fmt.Sprintf(MsgErrTooLong, err.Param())
 		case "eqfield":
 			errs[field] = MsgErrMismatch
+		case "excluded_if":
+			errs[field] = fmt.Sprintf(MsgErrExcludedIf, strings.Fields(err.Param())[0])
+		case "schedule":
+			errs[field] = MsgErrInvalidSchedule
+		case "flag", "flag_renames":
+			errs[field] = MsgErrInvalidFlagRenames
 		default:
 			errs[field] = MsgErrInvalid
 		}
@@ -130,8 +179,16 @@ func StructToValues(input any) map[string]string {
 			}
 		}
 
-		value := v.Field(i).Interface()
-		result[key] = fmt.Sprint(value)
+		field := v.Field(i)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				result[key] = ""
+				continue
+			}
+			field = field.Elem()
+		}
+
+		result[key] = fmt.Sprint(field.Interface())
 	}
 
 	return result
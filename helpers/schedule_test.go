@@ -0,0 +1,101 @@
+package helpers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"empty", ""},
+		{"too few fields", "0 0 * *"},
+		{"too many fields", "0 0 * * * *"},
+		{"unknown descriptor", "@fortnightly"},
+		{"minute out of range", "60 * * * *"},
+		{"hour out of range", "0 24 * * *"},
+		{"day of month zero", "0 0 0 * *"},
+		{"month out of range", "0 0 1 13 *"},
+		{"day of week out of range", "0 0 * * 8"},
+		{"reversed range", "0 10-5 * * *"},
+		{"zero step", "*/0 * * * *"},
+		{"bad step", "*/x * * * *"},
+		{"bad range", "0 a-5 * * *"},
+		{"bad value", "x * * * *"},
+		{"interval too short", "@every 30s"},
+		{"interval not a duration", "@every soon"},
+		{"unsatisfiable", "0 0 31 2 *"},
+		{"unsatisfiable in april", "0 0 31 4 *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSchedule(tt.spec)
+			if !errors.Is(err, ErrInvalidSchedule) {
+				t.Fatalf("ParseSchedule(%q) error = %v, want ErrInvalidSchedule", tt.spec, err)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// Monday
+	from := time.Date(2026, time.March, 2, 10, 17, 42, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		spec string
+		want time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2026, time.March, 2, 10, 18, 0, 0, time.UTC)},
+		{"step minutes", "*/15 * * * *", time.Date(2026, time.March, 2, 10, 30, 0, 0, time.UTC)},
+		{"list of hours", "0 3,12 * * *", time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)},
+		{"range of hours", "30 8-9 * * *", time.Date(2026, time.March, 3, 8, 30, 0, 0, time.UTC)},
+		{"stepped range", "0 0-12/6 * * *", time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)},
+		{"value with step", "0 20/2 * * *", time.Date(2026, time.March, 2, 20, 0, 0, 0, time.UTC)},
+		{"day of month", "0 0 15 * *", time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"month", "0 0 1 6 *", time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"day of week", "0 9 * * 5", time.Date(2026, time.March, 6, 9, 0, 0, 0, time.UTC)},
+		{"sunday as 0", "0 0 * * 0", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)},
+		{"day of month or week", "0 0 20 * 3", time.Date(2026, time.March, 4, 0, 0, 0, 0, time.UTC)},
+		{"question mark", "0 0 ? * ?", time.Date(2026, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"hourly", "@hourly", time.Date(2026, time.March, 2, 11, 0, 0, 0, time.UTC)},
+		{"daily", "@daily", time.Date(2026, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{"weekly", "@weekly", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)},
+		{"monthly", "@monthly", time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"yearly", "@yearly", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"surrounding space", "  @daily ", time.Date(2026, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{"interval", "@every 6h", time.Date(2026, time.March, 2, 16, 17, 42, 0, time.UTC)},
+		{"minimum interval", "@every 1m", time.Date(2026, time.March, 2, 10, 18, 42, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) error = %v", tt.spec, err)
+			}
+			if got := s.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextOnBoundary(t *testing.T) {
+	s, err := ParseSchedule("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC)
+	want := time.Date(2026, time.March, 2, 11, 0, 0, 0, time.UTC)
+	if got := s.Next(at); !got.Equal(want) {
+		t.Errorf("Next(%s) = %s, want %s", at, got, want)
+	}
+}
@@ -45,6 +45,11 @@ func InitPostgresSessionStore() {
 }
 
 func GetUserSessionData(c *echo.Context) *UserSessionData {
+	// requests authenticated with an API token carry the user on the echo context
+	if userData, ok := c.Get(userSessionKey).(*UserSessionData); ok {
+		return userData
+	}
+
 	sess, err := session.Get(GetSessionKey(), c)
 	if err != nil {
 		return nil
@@ -95,3 +100,7 @@ func ClearUserSessionData(c *echo.Context) error {
 
 	return nil
 }
+
+func SetRequestUserData(c *echo.Context, userData *UserSessionData) {
+	c.Set(userSessionKey, userData)
+}
@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"time"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -9,8 +11,13 @@ type Validator struct {
 }
 
 func NewValidator() *Validator {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	_ = validate.RegisterValidation("schedule", validateSchedule)
+	_ = validate.RegisterValidation("flag", validateFlag)
+	_ = validate.RegisterValidation("flag_renames", validateFlagRenames)
+
 	return &Validator{
-		validate: validator.New(validator.WithRequiredStructEnabled()),
+		validate: validate,
 	}
 }
 
@@ -18,3 +25,27 @@ func (v *Validator) Validate(target any) error {
 	err := v.validate.Struct(target)
 	return err
 }
+
+// validateSchedule accepts an empty string, use "required" to forbid it.
+func validateSchedule(fl validator.FieldLevel) bool {
+	spec := fl.Field().String()
+	if spec == "" {
+		return true
+	}
+
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return false
+	}
+
+	return !schedule.Next(time.Now()).IsZero()
+}
+
+func validateFlag(fl validator.FieldLevel) bool {
+	return IsValidFlag(fl.Field().String())
+}
+
+func validateFlagRenames(fl validator.FieldLevel) bool {
+	_, err := ParseFlagRenames(fl.Field().String())
+	return err == nil
+}
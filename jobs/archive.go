@@ -0,0 +1,688 @@
+package jobs
+
+import (
+	"app/config"
+	"app/models"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/mail"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+var (
+	ErrArchiveOutsideDir = errors.New("archive path is outside the import directory")
+	ErrArchivePathsOff   = errors.New("server paths are disabled for imports")
+	ErrArchiveJobActive  = errors.New("an archive is being imported or exported")
+	ErrEmptyArchive      = errors.New("the archive holds no mail folders")
+	ErrMaildirFile       = errors.New("a Maildir archive must be a directory or a zip file")
+)
+
+// archiveMessage is a message read from an archive with the flags and date
+// its format records.
+type archiveMessage struct {
+	body  []byte
+	flags []string
+	date  time.Time
+}
+
+// archiveFolder is a folder of an archive, "/" separates its levels.
+type archiveFolder struct {
+	name string
+	each func(fn func(msg *archiveMessage) error) error
+}
+
+// archiveSource is an archive opened as a file system. A single mbox file is
+// the only entry of its directory that is read.
+type archiveSource struct {
+	fsys  fs.FS
+	file  string
+	close func() error
+}
+
+// ArchivePath returns where an archive path relative to the archive
+// directory is on disk.
+func ArchivePath(relPath string) string {
+	return filepath.Join(config.Config.ArchiveDir, relPath)
+}
+
+// ResolveArchivePath returns p relative to the archive directory. Relative
+// paths are taken from the import directory, paths leaving it are refused.
+// The uploads and exports of every user are never reachable this way.
+func ResolveArchivePath(p string) (string, error) {
+	if config.Config.ArchiveImportDir == "" {
+		return "", ErrArchivePathsOff
+	}
+
+	dir, err := filepath.Abs(config.Config.ArchiveDir)
+	if err != nil {
+		return "", err
+	}
+	dir = evalSymlinks(dir)
+	importDir := evalSymlinks(filepath.Join(dir, config.Config.ArchiveImportDir))
+
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(importDir, p)
+	}
+	// Links must not lead out of the import directory
+	p = evalSymlinks(filepath.Clean(p))
+
+	if !isInsideDir(importDir, p) {
+		return "", ErrArchiveOutsideDir
+	}
+
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || !isInsideDir(dir, p) || rel == "." {
+		return "", ErrArchiveOutsideDir
+	}
+
+	for _, stored := range []string{models.ArchiveUploadDir, models.ArchiveExportDir} {
+		if rel == stored || strings.HasPrefix(rel, stored+string(filepath.Separator)) {
+			return "", ErrArchiveOutsideDir
+		}
+	}
+
+	return rel, nil
+}
+
+// evalSymlinks returns p with its links followed, or p when it can't be
+// read.
+func evalSymlinks(p string) string {
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return p
+	}
+
+	return real
+}
+
+// isInsideDir reports whether the clean path p is dir or below it.
+func isInsideDir(dir string, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// RemoveArchive deletes an archive with its job, and its files when the app
+// wrote them.
+func RemoveArchive(ctx context.Context, archive *models.Archive) error {
+	if archive.IsStored() && archive.Path != "" {
+		p := ArchivePath(archive.Path)
+
+		var err error
+		if archive.Kind == models.ArchiveKindImport {
+			// Each upload has a directory of its own
+			err = os.RemoveAll(filepath.Dir(p))
+		} else {
+			err = errors.Join(os.Remove(p), os.Remove(p+".part"))
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	err := models.DeleteJobsByRelated(ctx, ArchiveRelatedTable, archive.Id)
+	if err != nil {
+		return err
+	}
+
+	return models.DeleteArchive(ctx, archive.Id)
+}
+
+// RemoveMailboxArchives removes the archives of mailboxes about to be
+// deleted, whose rows would go with them but not their files. Nothing is
+// removed while one of them is being imported or exported.
+func RemoveMailboxArchives(ctx context.Context, mailboxIds []int) error {
+	archives, err := models.FindArchivesByMailboxIds(ctx, mailboxIds)
+	if err != nil || len(archives) == 0 {
+		return err
+	}
+
+	ids := make([]int, len(archives))
+	for i, archive := range archives {
+		ids[i] = archive.Id
+	}
+
+	archiveJobs, err := models.FindJobsByManyRelated(ctx, ArchiveRelatedTable, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range archiveJobs {
+		if job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning {
+			return ErrArchiveJobActive
+		}
+	}
+
+	for _, archive := range archives {
+		err = RemoveArchive(ctx, archive)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteExpiredArchives removes archives past their retention, archives
+// still being imported or exported are left for the next pass.
+func DeleteExpiredArchives(ctx context.Context) error {
+	archives, err := models.FindExpiredArchives(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, archive := range archives {
+		job, err := models.FindJobByRelated(ctx, ArchiveRelatedTable, archive.Id)
+		if err == nil && (job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning) {
+			continue
+		}
+
+		err = RemoveArchive(ctx, archive)
+		if err != nil {
+			slog.Error("Failed to delete expired archive", "archive", archive.Id, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// openArchive opens a directory as it is, a zip file by its entries and any
+// other file as a single mbox.
+func openArchive(p string) (*archiveSource, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &archiveSource{fsys: os.DirFS(p), close: func() error { return nil }}, nil
+	}
+
+	if strings.EqualFold(filepath.Ext(p), ".zip") {
+		r, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, err
+		}
+
+		return &archiveSource{fsys: r, close: r.Close}, nil
+	}
+
+	return &archiveSource{
+		fsys:  os.DirFS(filepath.Dir(p)),
+		file:  filepath.Base(p),
+		close: func() error { return nil },
+	}, nil
+}
+
+func (s *archiveSource) folders(format models.ArchiveFormat) ([]archiveFolder, error) {
+	var folders []archiveFolder
+	var err error
+
+	switch format {
+	case models.ArchiveFormatMaildir:
+		if s.file != "" {
+			return nil, ErrMaildirFile
+		}
+		folders, err = maildirFolders(s.fsys)
+	default:
+		if s.file != "" {
+			folders = []archiveFolder{mboxFolder(s.fsys, s.file)}
+		} else {
+			folders, err = mboxFolders(s.fsys)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(folders) == 0 {
+		return nil, ErrEmptyArchive
+	}
+
+	return folders, nil
+}
+
+// skipArchiveEntry leaves out what archivers add next to the mail, such as
+// macOS resource forks.
+func skipArchiveEntry(name string) bool {
+	return name == "__MACOSX" || name == ".DS_Store" || strings.HasPrefix(name, "._")
+}
+
+// toCrlf ends every line with CRLF, as APPEND expects.
+func toCrlf(body []byte) []byte {
+	return bytes.ReplaceAll(bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+}
+
+// archiveFolderName maps the folder of an archive onto the destination
+// hierarchy, any spelling of Inbox is the INBOX.
+func archiveFolderName(name string, delimiter string) string {
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX"
+	}
+
+	return strings.ReplaceAll(name, "/", delimiter)
+}
+
+// Maildir
+
+// Flags of the "2," info section, see https://cr.yp.to/proto/maildir.html
+var maildirFlagLetters = map[rune]string{
+	'D': imap.DraftFlag,
+	'F': imap.FlaggedFlag,
+	'P': "$Forwarded",
+	'R': imap.AnsweredFlag,
+	'S': imap.SeenFlag,
+	'T': imap.DeletedFlag,
+}
+
+func isMaildir(fsys fs.FS, dir string) bool {
+	for _, sub := range []string{"cur", "new"} {
+		info, err := fs.Stat(fsys, path.Join(dir, sub))
+		if err == nil && info.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maildirFolders finds every directory with cur or new below it. The
+// shallowest one holding all others is the INBOX, Maildir++ folders such as
+// ".Work.Projects" and nested directories become levels of the hierarchy.
+func maildirFolders(fsys fs.FS) ([]archiveFolder, error) {
+	dirs := make([]string, 0)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != "." && (skipArchiveEntry(d.Name()) || d.Name() == "cur" || d.Name() == "new" || d.Name() == "tmp") {
+			return fs.SkipDir
+		}
+
+		if isMaildir(fsys, p) {
+			dirs = append(dirs, p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(dirs, func(a, b int) bool {
+		return strings.Count(dirs[a], "/") < strings.Count(dirs[b], "/") || (strings.Count(dirs[a], "/") == strings.Count(dirs[b], "/") && dirs[a] < dirs[b])
+	})
+
+	root := ""
+	if len(dirs) > 0 {
+		root = dirs[0]
+		for _, dir := range dirs[1:] {
+			if root != "." && !strings.HasPrefix(dir, root+"/") {
+				root = ""
+				break
+			}
+		}
+	}
+
+	folders := make([]archiveFolder, 0, len(dirs))
+	for _, dir := range dirs {
+		folders = append(folders, archiveFolder{
+			name: maildirFolderName(root, dir),
+			each: func(fn func(msg *archiveMessage) error) error {
+				return eachMaildirMessage(fsys, dir, fn)
+			},
+		})
+	}
+
+	return folders, nil
+}
+
+func maildirFolderName(root string, dir string) string {
+	if dir == root {
+		return "INBOX"
+	}
+
+	rel := dir
+	if root != "" && root != "." {
+		rel = strings.TrimPrefix(dir, root+"/")
+	}
+
+	levels := make([]string, 0)
+	for level := range strings.SplitSeq(rel, "/") {
+		if !strings.HasPrefix(level, ".") {
+			levels = append(levels, level)
+			continue
+		}
+
+		for sub := range strings.SplitSeq(level[1:], ".") {
+			if sub != "" {
+				levels = append(levels, sub)
+			}
+		}
+	}
+
+	return strings.Join(levels, "/")
+}
+
+// maildirFlags reads the flags from the info section of a file name, mail
+// in new has none.
+func maildirFlags(name string) []string {
+	flags := make([]string, 0)
+
+	i := strings.LastIndex(name, ":2,")
+	if i < 0 {
+		// Archives written on Windows can't have colons in file names
+		i = strings.LastIndex(name, "!2,")
+	}
+	if i < 0 {
+		return flags
+	}
+
+	for _, letter := range name[i+3:] {
+		if flag, ok := maildirFlagLetters[letter]; ok {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
+
+// eachMaildirMessage reads new then cur, the delivery time of a message is
+// the modification time of its file.
+func eachMaildirMessage(fsys fs.FS, dir string, fn func(msg *archiveMessage) error) error {
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := fs.ReadDir(fsys, path.Join(dir, sub))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			body, err := fs.ReadFile(fsys, path.Join(dir, sub, entry.Name()))
+			if err != nil {
+				return err
+			}
+
+			msg := &archiveMessage{
+				body:  toCrlf(body),
+				flags: []string{},
+				date:  info.ModTime(),
+			}
+			if sub == "cur" {
+				msg.flags = maildirFlags(entry.Name())
+			}
+
+			err = fn(msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// mbox
+
+var mboxFromLine = []byte("From ")
+
+var mboxXStatusFlags = []struct {
+	letter string
+	flag   string
+}{
+	{"A", imap.AnsweredFlag},
+	{"F", imap.FlaggedFlag},
+	{"T", imap.DraftFlag},
+	{"D", imap.DeletedFlag},
+}
+
+// Bits of Thunderbird's X-Mozilla-Status header
+var mozillaStatusFlags = []struct {
+	bit  uint64
+	flag string
+}{
+	{0x1, imap.SeenFlag},
+	{0x2, imap.AnsweredFlag},
+	{0x4, imap.FlaggedFlag},
+	{0x8, imap.DeletedFlag},
+}
+
+func isMbox(fsys fs.FS, name string) (bool, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	start := make([]byte, len(mboxFromLine))
+	_, err = io.ReadFull(f, start)
+	if err != nil {
+		return false, nil
+	}
+
+	return bytes.Equal(start, mboxFromLine), nil
+}
+
+// mboxFolders reads every file starting with a From line as a folder, other
+// files such as Thunderbird's .msf indexes are left out.
+func mboxFolders(fsys fs.FS) ([]archiveFolder, error) {
+	folders := make([]archiveFolder, 0)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		if skipArchiveEntry(d.Name()) || strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".msf") {
+			return nil
+		}
+
+		ok, err := isMbox(fsys, p)
+		if err != nil {
+			return err
+		}
+		if ok {
+			folders = append(folders, mboxFolder(fsys, p))
+		}
+
+		return nil
+	})
+
+	return folders, err
+}
+
+func mboxFolder(fsys fs.FS, p string) archiveFolder {
+	return archiveFolder{
+		name: mboxFolderName(p),
+		each: func(fn func(msg *archiveMessage) error) error {
+			return eachMboxMessage(fsys, p, fn)
+		},
+	}
+}
+
+// mboxFolderName drops the extensions mail clients add: Thunderbird keeps
+// subfolders in "Name.sbd" next to the "Name" file, Apple Mail exports
+// "Name.mbox/mbox". A lone file called mbox is the INBOX.
+func mboxFolderName(p string) string {
+	levels := strings.Split(p, "/")
+	if len(levels) > 1 && levels[len(levels)-1] == "mbox" {
+		levels = levels[:len(levels)-1]
+	}
+
+	for i, level := range levels {
+		for _, ext := range []string{".sbd", ".mbox", ".mbx"} {
+			level = strings.TrimSuffix(level, ext)
+		}
+		levels[i] = level
+	}
+
+	name := strings.Join(levels, "/")
+	if name == "mbox" {
+		return "INBOX"
+	}
+
+	return name
+}
+
+// unescapeFrom removes the ">" mboxrd writers put before From lines in a
+// message body.
+func unescapeFrom(line []byte) []byte {
+	unquoted := bytes.TrimLeft(line, ">")
+	if len(unquoted) < len(line) && bytes.HasPrefix(unquoted, mboxFromLine) {
+		return line[1:]
+	}
+
+	return line
+}
+
+// eachMboxMessage splits an mbox on From lines following a blank line or
+// starting the file.
+func eachMboxMessage(fsys fs.FS, p string, fn func(msg *archiveMessage) error) error {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	fromLine := ""
+	started := false
+	prevBlank := true
+
+	flush := func() error {
+		if !started {
+			return nil
+		}
+
+		raw := bytes.Clone(body.Bytes())
+		// The blank line before the next From line separates messages
+		if bytes.HasSuffix(raw, []byte("\r\n\r\n")) {
+			raw = raw[:len(raw)-2]
+		}
+		body.Reset()
+
+		return fn(parseMboxMessage(fromLine, raw))
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+
+			if prevBlank && bytes.HasPrefix(line, mboxFromLine) {
+				err := flush()
+				if err != nil {
+					return err
+				}
+
+				fromLine = string(line)
+				started = true
+				prevBlank = false
+				continue
+			}
+
+			if started {
+				body.Write(unescapeFrom(line))
+				body.WriteString("\r\n")
+			}
+			prevBlank = len(line) == 0
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	return flush()
+}
+
+// parseMboxMessage takes the date from the From line, or the Date header
+// when the line has none, and the flags from the Status, X-Status and
+// X-Mozilla-Status headers mail clients write.
+func parseMboxMessage(fromLine string, body []byte) *archiveMessage {
+	msg := &archiveMessage{
+		body:  body,
+		flags: []string{},
+	}
+
+	fields := strings.Fields(fromLine)
+	if len(fields) >= 7 {
+		msg.date, _ = time.Parse(time.ANSIC, strings.Join(fields[2:7], " "))
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(body))
+	if err != nil {
+		return msg
+	}
+
+	if msg.date.IsZero() {
+		msg.date, _ = parsed.Header.Date()
+	}
+
+	addFlag := func(flag string) {
+		if !hasFlag(msg.flags, flag) {
+			msg.flags = append(msg.flags, flag)
+		}
+	}
+
+	if strings.Contains(parsed.Header.Get("Status"), "R") {
+		addFlag(imap.SeenFlag)
+	}
+
+	xStatus := parsed.Header.Get("X-Status")
+	for _, status := range mboxXStatusFlags {
+		if strings.Contains(xStatus, status.letter) {
+			addFlag(status.flag)
+		}
+	}
+
+	mozillaStatus, err := strconv.ParseUint(strings.TrimSpace(parsed.Header.Get("X-Mozilla-Status")), 16, 16)
+	if err == nil {
+		for _, status := range mozillaStatusFlags {
+			if mozillaStatus&status.bit != 0 {
+				addFlag(status.flag)
+			}
+		}
+	}
+
+	return msg
+}
@@ -0,0 +1,332 @@
+package jobs
+
+import (
+	"app/config"
+	"app/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestResolveArchivePath(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"imports/alice/Maildir", "uploads/1", "exports/1", "elsewhere"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "elsewhere"), filepath.Join(dir, "imports", "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "uploads"), filepath.Join(dir, "imports", "uploads")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		importDir string
+		path      string
+		want      string
+		wantErr   error
+	}{
+		{"relative", "imports", "alice/Maildir", "imports/alice/Maildir", nil},
+		{"absolute", "imports", filepath.Join(dir, "imports", "alice"), "imports/alice", nil},
+		{"not yet created", "imports", "bob.mbox", "imports/bob.mbox", nil},
+		{"dot dot", "imports", "../elsewhere", "", ErrArchiveOutsideDir},
+		{"absolute outside", "imports", "/etc/passwd", "", ErrArchiveOutsideDir},
+		{"link leaving the import directory", "imports", "escape", "", ErrArchiveOutsideDir},
+		{"link to the uploads", "imports", "uploads/1", "", ErrArchiveOutsideDir},
+		{"import directory itself", "imports", ".", "imports", nil},
+		{"archive directory as import directory", ".", ".", "", ErrArchiveOutsideDir},
+		{"uploads below the import directory", ".", "uploads/1", "", ErrArchiveOutsideDir},
+		{"exports below the import directory", ".", "exports", "", ErrArchiveOutsideDir},
+		{"disabled", "", "alice/Maildir", "", ErrArchivePathsOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ARCHIVE_DIR", dir)
+			t.Setenv("ARCHIVE_IMPORT_DIR", tt.importDir)
+			config.InitConfig()
+
+			got, err := ResolveArchivePath(tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResolveArchivePath(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+			}
+			if got != filepath.FromSlash(tt.want) {
+				t.Errorf("ResolveArchivePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMboxFolderName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"mbox", "INBOX"},
+		{"Inbox", "Inbox"},
+		{"Sent.mbx", "Sent"},
+		{"Work.sbd/Projects", "Work/Projects"},
+		{"Archive.mbox/mbox", "Archive"},
+		{"Work.mbox/Projects.mbox/mbox", "Work/Projects"},
+		{"Local Folders/mbox", "Local Folders"},
+	}
+
+	for _, tt := range tests {
+		if got := mboxFolderName(tt.path); got != tt.want {
+			t.Errorf("mboxFolderName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMaildirFolderName(t *testing.T) {
+	tests := []struct {
+		root string
+		dir  string
+		want string
+	}{
+		{".", ".", "INBOX"},
+		{".", ".Sent", "Sent"},
+		{".", ".Work.Projects", "Work/Projects"},
+		{"Maildir", "Maildir", "INBOX"},
+		{"Maildir", "Maildir/.Work.Projects", "Work/Projects"},
+		{"Maildir", "Maildir/Work/Projects", "Work/Projects"},
+		{"", "alice/Sent", "alice/Sent"},
+	}
+
+	for _, tt := range tests {
+		if got := maildirFolderName(tt.root, tt.dir); got != tt.want {
+			t.Errorf("maildirFolderName(%q, %q) = %q, want %q", tt.root, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestMaildirFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"1700000000.M1P2.host", []string{}},
+		{"1700000000.M1P2.host:2,", []string{}},
+		{"1700000000.M1P2.host:2,S", []string{imap.SeenFlag}},
+		{"1700000000.M1P2.host:2,DFPRST", []string{imap.DraftFlag, imap.FlaggedFlag, "$Forwarded", imap.AnsweredFlag, imap.SeenFlag, imap.DeletedFlag}},
+		{"1700000000.M1P2.host!2,RS", []string{imap.AnsweredFlag, imap.SeenFlag}},
+		{"1700000000.M1P2.host:2,Sa", []string{imap.SeenFlag}},
+	}
+
+	for _, tt := range tests {
+		if got := maildirFlags(tt.name); !slices.Equal(got, tt.want) {
+			t.Errorf("maildirFlags(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnescapeFrom(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{">From here", "From here"},
+		{">>From here", ">From here"},
+		{"> quoted", "> quoted"},
+		{">Fromage", ">Fromage"},
+		{"From here", "From here"},
+	}
+
+	for _, tt := range tests {
+		if got := string(unescapeFrom([]byte(tt.line))); got != tt.want {
+			t.Errorf("unescapeFrom(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseMboxMessage(t *testing.T) {
+	fromLineDate := time.Date(2026, time.March, 2, 10, 17, 42, 0, time.UTC)
+	headerDate := time.Date(2026, time.February, 1, 8, 0, 0, 0, time.FixedZone("", 3600))
+
+	tests := []struct {
+		name      string
+		fromLine  string
+		headers   string
+		wantDate  time.Time
+		wantFlags []string
+	}{
+		{
+			name:      "date from the From line",
+			fromLine:  "From alice@example.com Mon Mar  2 10:17:42 2026",
+			headers:   "Date: Sun, 01 Feb 2026 08:00:00 +0100\r\n",
+			wantDate:  fromLineDate,
+			wantFlags: []string{},
+		},
+		{
+			name:      "date from the header",
+			fromLine:  "From MAILER-DAEMON",
+			headers:   "Date: Sun, 01 Feb 2026 08:00:00 +0100\r\n",
+			wantDate:  headerDate,
+			wantFlags: []string{},
+		},
+		{
+			name:      "status headers",
+			fromLine:  "From -",
+			headers:   "Status: RO\r\nX-Status: AF\r\n",
+			wantFlags: []string{imap.SeenFlag, imap.AnsweredFlag, imap.FlaggedFlag},
+		},
+		{
+			name:      "mozilla status",
+			fromLine:  "From -",
+			headers:   "X-Mozilla-Status: 0009\r\n",
+			wantFlags: []string{imap.SeenFlag, imap.DeletedFlag},
+		},
+		{
+			name:      "flags are not repeated",
+			fromLine:  "From -",
+			headers:   "Status: R\r\nX-Status: D\r\nX-Mozilla-Status: 0009\r\n",
+			wantFlags: []string{imap.SeenFlag, imap.DeletedFlag},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(tt.headers + "Subject: Hi\r\n\r\nHello\r\n")
+
+			msg := parseMboxMessage(tt.fromLine, body)
+			if !msg.date.Equal(tt.wantDate) {
+				t.Errorf("date = %s, want %s", msg.date, tt.wantDate)
+			}
+			if !slices.Equal(msg.flags, tt.wantFlags) {
+				t.Errorf("flags = %q, want %q", msg.flags, tt.wantFlags)
+			}
+			if string(msg.body) != string(body) {
+				t.Errorf("body = %q, want %q", msg.body, body)
+			}
+		})
+	}
+}
+
+func TestEachMboxMessage(t *testing.T) {
+	fsys := fstest.MapFS{"Inbox": {Data: []byte(
+		"From alice@example.com Mon Mar  2 10:17:42 2026\n" +
+			"Subject: One\n" +
+			"\n" +
+			">From the start\n" +
+			"From is fine mid-paragraph\n" +
+			"\n" +
+			"From bob@example.com Mon Mar  2 11:00:00 2026\r\n" +
+			"Subject: Two\r\n" +
+			"\r\n" +
+			"Bye\r\n",
+	)}}
+
+	var bodies []string
+	err := eachMboxMessage(fsys, "Inbox", func(msg *archiveMessage) error {
+		bodies = append(bodies, string(msg.body))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("eachMboxMessage() error = %v", err)
+	}
+
+	want := []string{
+		"Subject: One\r\n\r\nFrom the start\r\nFrom is fine mid-paragraph\r\n",
+		"Subject: Two\r\n\r\nBye\r\n",
+	}
+	if !slices.Equal(bodies, want) {
+		t.Errorf("bodies = %q, want %q", bodies, want)
+	}
+}
+
+func TestArchiveFolders(t *testing.T) {
+	message := &fstest.MapFile{Data: []byte("Subject: Hi\n\nHello\n"), ModTime: time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)}
+	mbox := &fstest.MapFile{Data: []byte("From - Mon Mar  2 10:17:42 2026\nSubject: Hi\n\nHello\n")}
+
+	tests := []struct {
+		name   string
+		format models.ArchiveFormat
+		fsys   fstest.MapFS
+		want   map[string]int
+	}{
+		{
+			name:   "maildir++",
+			format: models.ArchiveFormatMaildir,
+			fsys: fstest.MapFS{
+				"Maildir/cur/1:2,S":                   message,
+				"Maildir/new/2":                       message,
+				"Maildir/tmp/3":                       message,
+				"Maildir/.Work.Projects/cur/4:2,":     message,
+				"Maildir/.Sent/new/5":                 message,
+				"Maildir/.Sent/cur/.hidden":           message,
+				"__MACOSX/Maildir/cur/._1":            message,
+				"Maildir/.Drafts/maildirfolder":       message,
+				"Maildir/.Drafts/courierimapkeywords": message,
+			},
+			want: map[string]int{"INBOX": 2, "Work/Projects": 1, "Sent": 1},
+		},
+		{
+			name:   "thunderbird profile",
+			format: models.ArchiveFormatMbox,
+			fsys: fstest.MapFS{
+				"Inbox":                 mbox,
+				"Inbox.msf":             mbox,
+				"Work.sbd/Projects":     mbox,
+				"Work.sbd/Projects.msf": mbox,
+				"filterlog.html":        message,
+				".DS_Store":             mbox,
+			},
+			want: map[string]int{"Inbox": 1, "Work/Projects": 1},
+		},
+		{
+			name:   "no mail",
+			format: models.ArchiveFormatMbox,
+			fsys:   fstest.MapFS{"notes.txt": message},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &archiveSource{fsys: tt.fsys}
+
+			folders, err := source.folders(tt.format)
+			if tt.want == nil {
+				if !errors.Is(err, ErrEmptyArchive) {
+					t.Fatalf("folders() error = %v, want ErrEmptyArchive", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("folders() error = %v", err)
+			}
+
+			got := make(map[string]int)
+			for _, folder := range folders {
+				err := folder.each(func(msg *archiveMessage) error {
+					got[folder.name]++
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("reading %s: %v", folder.name, err)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("folders = %v, want %v", got, tt.want)
+			}
+			for name, count := range tt.want {
+				if got[name] != count {
+					t.Errorf("folder %q has %d messages, want %d", name, got[name], count)
+				}
+			}
+		})
+	}
+
+	source := &archiveSource{fsys: fstest.MapFS{"Inbox": mbox}, file: "Inbox"}
+	if _, err := source.folders(models.ArchiveFormatMaildir); !errors.Is(err, ErrMaildirFile) {
+		t.Errorf("folders() of a single file as Maildir error = %v, want ErrMaildirFile", err)
+	}
+}
@@ -0,0 +1,273 @@
+package jobs
+
+import (
+	"app/models"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// archiveWriter writes the folders of a mailbox into a zip file, the messages
+// of a folder follow its begin. The zip files of mbox and Maildir exports
+// can be imported again.
+type archiveWriter interface {
+	begin(folder string) error
+	add(msg *archiveMessage) error
+	close() error
+}
+
+func newArchiveWriter(w io.Writer, format models.ArchiveFormat, mailbox string) archiveWriter {
+	zw := zip.NewWriter(w)
+
+	switch format {
+	case models.ArchiveFormatMaildir:
+		return &maildirWriter{zip: zw}
+	case models.ArchiveFormatEml:
+		return &emlWriter{zip: zw, manifest: emlManifest{Mailbox: mailbox, ExportedAt: time.Now(), Folders: []*emlManifestFolder{}}}
+	default:
+		return &mboxWriter{zip: zw}
+	}
+}
+
+// archiveEntryLevels splits a folder into levels safe as zip entry names.
+func archiveEntryLevels(folder string) []string {
+	levels := strings.Split(folder, "/")
+	for i, level := range levels {
+		if level == "" || level == "." || level == ".." {
+			levels[i] = "_"
+		}
+	}
+
+	return levels
+}
+
+// exportDate is the date written for a message, the export time when the
+// source has none.
+func exportDate(msg *archiveMessage) time.Time {
+	if msg.date.IsZero() {
+		return time.Now()
+	}
+
+	return msg.date
+}
+
+// mbox
+
+// mboxWriter writes an mboxrd file per folder, "Work/Projects.mbox" for a
+// nested folder. Flags are kept in Status and X-Status headers, keywords are
+// lost.
+type mboxWriter struct {
+	zip *zip.Writer
+	w   io.Writer
+}
+
+func (m *mboxWriter) begin(folder string) error {
+	w, err := m.zip.CreateHeader(&zip.FileHeader{
+		Name:     path.Join(archiveEntryLevels(folder)...) + ".mbox",
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	m.w = w
+	return nil
+}
+
+func (m *mboxWriter) add(msg *archiveMessage) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From MAILER-DAEMON %s\n", exportDate(msg).UTC().Format(time.ANSIC))
+
+	status := "O"
+	if hasFlag(msg.flags, imap.SeenFlag) {
+		status = "RO"
+	}
+	fmt.Fprintf(&buf, "Status: %s\n", status)
+
+	xStatus := ""
+	for _, x := range mboxXStatusFlags {
+		if hasFlag(msg.flags, x.flag) {
+			xStatus += x.letter
+		}
+	}
+	if xStatus != "" {
+		fmt.Fprintf(&buf, "X-Status: %s\n", xStatus)
+	}
+
+	body := bytes.TrimSuffix(bytes.ReplaceAll(msg.body, []byte("\r\n"), []byte("\n")), []byte("\n"))
+	for line := range bytes.SplitSeq(body, []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), mboxFromLine) {
+			buf.WriteByte('>')
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	_, err := m.w.Write(buf.Bytes())
+	return err
+}
+
+func (m *mboxWriter) close() error {
+	return m.zip.Close()
+}
+
+// Maildir
+
+// maildirWriter writes a Maildir++ tree under "Maildir", the INBOX at its
+// top and other folders as ".Work.Projects". Dots inside a folder name
+// become underscores. Each message is a file in cur with its flags in the
+// name and its date as modification time, keywords are lost.
+type maildirWriter struct {
+	zip *zip.Writer
+	dir string
+	seq int
+}
+
+func maildirEntryDir(folder string) string {
+	if strings.EqualFold(folder, "INBOX") {
+		return "Maildir/"
+	}
+
+	levels := archiveEntryLevels(folder)
+	for i, level := range levels {
+		levels[i] = strings.ReplaceAll(level, ".", "_")
+	}
+
+	return "Maildir/." + strings.Join(levels, ".") + "/"
+}
+
+func (m *maildirWriter) begin(folder string) error {
+	m.dir = maildirEntryDir(folder)
+
+	for _, sub := range []string{"cur/", "new/", "tmp/"} {
+		_, err := m.zip.CreateHeader(&zip.FileHeader{
+			Name:     m.dir + sub,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *maildirWriter) add(msg *archiveMessage) error {
+	date := exportDate(msg)
+
+	// Info letters must be in ASCII order
+	letters := ""
+	for _, letter := range "DFPRST" {
+		if hasFlag(msg.flags, maildirFlagLetters[letter]) {
+			letters += string(letter)
+		}
+	}
+
+	m.seq++
+	w, err := m.zip.CreateHeader(&zip.FileHeader{
+		Name:     fmt.Sprintf("%scur/%d.M%d.mailgrate:2,%s", m.dir, date.Unix(), m.seq, letters),
+		Method:   zip.Deflate,
+		Modified: date,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(bytes.ReplaceAll(msg.body, []byte("\r\n"), []byte("\n")))
+	return err
+}
+
+func (m *maildirWriter) close() error {
+	return m.zip.Close()
+}
+
+// EML
+
+// emlManifest is written as manifest.json, it keeps what EML files can't:
+// the folder of each file with its flags and date.
+type emlManifest struct {
+	Mailbox    string               `json:"mailbox"`
+	ExportedAt time.Time            `json:"exportedAt"`
+	Folders    []*emlManifestFolder `json:"folders"`
+}
+
+type emlManifestFolder struct {
+	Name     string               `json:"name"`
+	Path     string               `json:"path"`
+	Messages []emlManifestMessage `json:"messages"`
+}
+
+type emlManifestMessage struct {
+	File  string    `json:"file"`
+	Flags []string  `json:"flags"`
+	Date  time.Time `json:"date"`
+}
+
+type emlWriter struct {
+	zip      *zip.Writer
+	manifest emlManifest
+	folder   *emlManifestFolder
+}
+
+func (e *emlWriter) begin(folder string) error {
+	e.folder = &emlManifestFolder{
+		Name:     folder,
+		Path:     path.Join(archiveEntryLevels(folder)...),
+		Messages: []emlManifestMessage{},
+	}
+	e.manifest.Folders = append(e.manifest.Folders, e.folder)
+
+	return nil
+}
+
+func (e *emlWriter) add(msg *archiveMessage) error {
+	date := exportDate(msg)
+	file := fmt.Sprintf("%s/%06d.eml", e.folder.Path, len(e.folder.Messages)+1)
+
+	w, err := e.zip.CreateHeader(&zip.FileHeader{
+		Name:     file,
+		Method:   zip.Deflate,
+		Modified: date,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg.body)
+	if err != nil {
+		return err
+	}
+
+	e.folder.Messages = append(e.folder.Messages, emlManifestMessage{
+		File:  file,
+		Flags: msg.flags,
+		Date:  date,
+	})
+
+	return nil
+}
+
+func (e *emlWriter) close() error {
+	w, err := e.zip.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(e.manifest)
+	if err != nil {
+		return err
+	}
+
+	return e.zip.Close()
+}
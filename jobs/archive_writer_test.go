@@ -0,0 +1,211 @@
+package jobs
+
+import (
+	"app/models"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+type exportedFolder struct {
+	name     string
+	messages []*archiveMessage
+}
+
+func exportTestFolders() []exportedFolder {
+	date := time.Date(2026, time.March, 2, 10, 17, 42, 0, time.UTC)
+
+	return []exportedFolder{
+		{"INBOX", []*archiveMessage{
+			{body: []byte("Subject: One\r\n\r\nHello\r\n"), flags: []string{imap.SeenFlag}, date: date},
+			{body: []byte("Subject: Two\r\n\r\nFrom here on\r\n>From quoted\r\n\r\nFrom the end\r\n"), flags: []string{}, date: date.Add(time.Hour)},
+		}},
+		{"Work", []*archiveMessage{
+			{body: []byte("Subject: Three\r\n\r\nBye\r\n"), flags: []string{imap.AnsweredFlag, imap.FlaggedFlag, imap.SeenFlag}, date: date.Add(2 * time.Hour)},
+		}},
+		{"Work/Projects", []*archiveMessage{
+			{body: []byte("Subject: Four\r\n\r\nDraft\r\n"), flags: []string{imap.DraftFlag, imap.DeletedFlag}, date: date.Add(3 * time.Hour)},
+		}},
+	}
+}
+
+func writeTestArchive(t *testing.T, format models.ArchiveFormat, folders []exportedFolder) string {
+	t.Helper()
+
+	p := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := newArchiveWriter(f, format, "alice@example.com")
+	for _, folder := range folders {
+		if err := w.begin(folder.name); err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range folder.messages {
+			if err := w.add(msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, format := range []models.ArchiveFormat{models.ArchiveFormatMbox, models.ArchiveFormatMaildir} {
+		t.Run(string(format), func(t *testing.T) {
+			exported := exportTestFolders()
+
+			source, err := openArchive(writeTestArchive(t, format, exported))
+			if err != nil {
+				t.Fatalf("openArchive() error = %v", err)
+			}
+			defer source.close()
+
+			folders, err := source.folders(format)
+			if err != nil {
+				t.Fatalf("folders() error = %v", err)
+			}
+
+			imported := make(map[string][]*archiveMessage)
+			for _, folder := range folders {
+				err := folder.each(func(msg *archiveMessage) error {
+					imported[folder.name] = append(imported[folder.name], msg)
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("reading %s: %v", folder.name, err)
+				}
+			}
+
+			if len(imported) != len(exported) {
+				t.Errorf("imported %d folders, want %d", len(imported), len(exported))
+			}
+			for _, folder := range exported {
+				messages := imported[folder.name]
+				if len(messages) != len(folder.messages) {
+					t.Errorf("folder %q has %d messages, want %d", folder.name, len(messages), len(folder.messages))
+					continue
+				}
+
+				for i, want := range folder.messages {
+					got := messages[i]
+					// The mbox writer puts the flags in headers in front of the message
+					if !bytes.HasSuffix(got.body, want.body) {
+						t.Errorf("%s message %d body = %q, want %q", folder.name, i, got.body, want.body)
+					}
+					if !got.date.Equal(want.date) {
+						t.Errorf("%s message %d date = %s, want %s", folder.name, i, got.date, want.date)
+					}
+					if !slices.Equal(slices.Sorted(slices.Values(got.flags)), slices.Sorted(slices.Values(want.flags))) {
+						t.Errorf("%s message %d flags = %q, want %q", folder.name, i, got.flags, want.flags)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMaildirEntryDir(t *testing.T) {
+	tests := []struct {
+		folder string
+		want   string
+	}{
+		{"INBOX", "Maildir/"},
+		{"Inbox", "Maildir/"},
+		{"Sent", "Maildir/.Sent/"},
+		{"Work/Projects", "Maildir/.Work.Projects/"},
+		{"Notes 2026.1", "Maildir/.Notes 2026_1/"},
+		{"../Escape", "Maildir/._.Escape/"},
+	}
+
+	for _, tt := range tests {
+		if got := maildirEntryDir(tt.folder); got != tt.want {
+			t.Errorf("maildirEntryDir(%q) = %q, want %q", tt.folder, got, tt.want)
+		}
+	}
+}
+
+func TestArchiveEntryLevels(t *testing.T) {
+	tests := []struct {
+		folder string
+		want   []string
+	}{
+		{"INBOX", []string{"INBOX"}},
+		{"Work/Projects", []string{"Work", "Projects"}},
+		{"../..", []string{"_", "_"}},
+		{"/Sent/./", []string{"_", "Sent", "_", "_"}},
+	}
+
+	for _, tt := range tests {
+		if got := archiveEntryLevels(tt.folder); !slices.Equal(got, tt.want) {
+			t.Errorf("archiveEntryLevels(%q) = %q, want %q", tt.folder, got, tt.want)
+		}
+	}
+}
+
+func TestEmlArchive(t *testing.T) {
+	exported := exportTestFolders()
+
+	r, err := zip.OpenReader(writeTestArchive(t, models.ArchiveFormatEml, exported))
+	if err != nil {
+		t.Fatalf("zip.OpenReader() error = %v", err)
+	}
+	defer r.Close()
+
+	f, err := r.Open("manifest.json")
+	if err != nil {
+		t.Fatalf("opening the manifest: %v", err)
+	}
+	defer f.Close()
+
+	var manifest emlManifest
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		t.Fatalf("decoding the manifest: %v", err)
+	}
+
+	if manifest.Mailbox != "alice@example.com" {
+		t.Errorf("manifest mailbox = %q", manifest.Mailbox)
+	}
+	if len(manifest.Folders) != len(exported) {
+		t.Fatalf("manifest has %d folders, want %d", len(manifest.Folders), len(exported))
+	}
+
+	for i, folder := range manifest.Folders {
+		want := exported[i]
+		if folder.Name != want.name || len(folder.Messages) != len(want.messages) {
+			t.Errorf("manifest folder %q with %d messages, want %q with %d", folder.Name, len(folder.Messages), want.name, len(want.messages))
+			continue
+		}
+
+		for j, msg := range folder.Messages {
+			eml, err := r.Open(msg.File)
+			if err != nil {
+				t.Errorf("opening %s: %v", msg.File, err)
+				continue
+			}
+			body, err := io.ReadAll(eml)
+			eml.Close()
+			if err != nil || !bytes.Equal(body, want.messages[j].body) {
+				t.Errorf("%s = %q, %v, want %q", msg.File, body, err, want.messages[j].body)
+			}
+			if !msg.Date.Equal(want.messages[j].date) || !slices.Equal(msg.Flags, want.messages[j].flags) {
+				t.Errorf("%s has date %s and flags %q, want %s and %q", msg.File, msg.Date, msg.Flags, want.messages[j].date, want.messages[j].flags)
+			}
+		}
+	}
+}
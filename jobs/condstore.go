@@ -0,0 +1,345 @@
+package jobs
+
+import (
+	"app/models"
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+// go-imap v1 has no CONDSTORE (RFC 7162) support, the commands and responses
+// needed for incremental flag and expunge sync are built here.
+
+const statusHighestModSeq imap.StatusItem = "HIGHESTMODSEQ"
+
+// changeTracking describes which change tracking extensions both servers
+// support for a run.
+type changeTracking struct {
+	condStore bool
+	qresync   bool
+	uidPlus   bool
+}
+
+// detectChangeTracking must run before a folder is selected, ENABLE is only
+// valid in the authenticated state.
+func detectChangeTracking(srcClient *client.Client, dstClient *client.Client) changeTracking {
+	var tracking changeTracking
+
+	srcCondStore, _ := srcClient.Support("CONDSTORE")
+	dstCondStore, _ := dstClient.Support("CONDSTORE")
+	tracking.condStore = srcCondStore && dstCondStore
+
+	srcQresync, _ := srcClient.Support("QRESYNC")
+	dstQresync, _ := dstClient.Support("QRESYNC")
+	if tracking.condStore && srcQresync && dstQresync {
+		_, err := srcClient.Enable([]string{"QRESYNC"})
+		if err != nil {
+			slog.Debug("Failed to enable QRESYNC", "error", err)
+		} else {
+			tracking.qresync = true
+		}
+	}
+
+	tracking.uidPlus, _ = dstClient.Support("UIDPLUS")
+
+	return tracking
+}
+
+func highestModSeq(c *client.Client, folderName string) (uint64, error) {
+	status, err := c.Status(folderName, []imap.StatusItem{statusHighestModSeq})
+	if err != nil {
+		return 0, err
+	}
+
+	return parseModSeq(status.Items[statusHighestModSeq])
+}
+
+func parseModSeq(f interface{}) (uint64, error) {
+	// FETCH returns MODSEQ as a list of one number
+	if list, ok := f.([]interface{}); ok && len(list) == 1 {
+		f = list[0]
+	}
+
+	switch f := f.(type) {
+	case string:
+		return strconv.ParseUint(f, 10, 64)
+	case imap.RawString:
+		return strconv.ParseUint(string(f), 10, 64)
+	}
+
+	return 0, errors.New("HIGHESTMODSEQ is not a number")
+}
+
+// changedSinceFetch is a FETCH with the CHANGEDSINCE modifier, optionally
+// asking for VANISHED uids when QRESYNC is enabled.
+type changedSinceFetch struct {
+	SeqSet   *imap.SeqSet
+	Items    []imap.FetchItem
+	ModSeq   uint64
+	Vanished bool
+}
+
+func (cmd *changedSinceFetch) Command() *imap.Command {
+	items := make([]interface{}, len(cmd.Items))
+	for i, item := range cmd.Items {
+		items[i] = imap.RawString(item)
+	}
+
+	modifiers := []interface{}{imap.RawString("CHANGEDSINCE"), imap.RawString(strconv.FormatUint(cmd.ModSeq, 10))}
+	if cmd.Vanished {
+		modifiers = append(modifiers, imap.RawString("VANISHED"))
+	}
+
+	return &imap.Command{
+		Name:      "FETCH",
+		Arguments: []interface{}{cmd.SeqSet, items, modifiers},
+	}
+}
+
+type changedSinceResult struct {
+	Messages []*imap.Message
+	Vanished []uint32
+}
+
+func (r *changedSinceResult) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok {
+		return responses.ErrUnhandled
+	}
+
+	switch name {
+	case "FETCH":
+		if len(fields) < 2 {
+			return responses.ErrUnhandled
+		}
+
+		seqNum, err := imap.ParseNumber(fields[0])
+		if err != nil {
+			return err
+		}
+
+		msgFields, _ := fields[1].([]interface{})
+		msg := &imap.Message{SeqNum: seqNum}
+		err = msg.Parse(msgFields)
+		if err != nil {
+			return err
+		}
+
+		// Unilateral flag updates carry no uid
+		if msg.Uid == 0 {
+			return responses.ErrUnhandled
+		}
+
+		r.Messages = append(r.Messages, msg)
+		return nil
+	case "VANISHED":
+		if len(fields) == 0 {
+			return responses.ErrUnhandled
+		}
+
+		// Only "VANISHED (EARLIER)" answers our fetch, plain VANISHED is unilateral
+		if _, earlier := fields[0].([]interface{}); !earlier || len(fields) < 2 {
+			return responses.ErrUnhandled
+		}
+
+		raw, _ := fields[1].(string)
+		seqset, err := imap.ParseSeqSet(raw)
+		if err != nil {
+			return err
+		}
+
+		for _, seq := range seqset.Set {
+			for uid := seq.Start; uid <= seq.Stop && uid != 0; uid++ {
+				r.Vanished = append(r.Vanished, uid)
+			}
+		}
+		return nil
+	}
+
+	return responses.ErrUnhandled
+}
+
+func fetchChangedSince(c *client.Client, seqset *imap.SeqSet, modSeq uint64, vanished bool, items []imap.FetchItem) (*changedSinceResult, error) {
+	cmd := &commands.Uid{Cmd: &changedSinceFetch{
+		SeqSet:   seqset,
+		Items:    items,
+		ModSeq:   modSeq,
+		Vanished: vanished,
+	}}
+	res := &changedSinceResult{}
+
+	status, err := c.Execute(cmd, res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, status.Err()
+}
+
+type uidExpunge struct {
+	SeqSet *imap.SeqSet
+}
+
+func (cmd *uidExpunge) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "UID",
+		Arguments: []interface{}{imap.RawString("EXPUNGE"), cmd.SeqSet},
+	}
+}
+
+// deleteUids flags messages of the selected folder as deleted. Without
+// UIDPLUS they stay flagged, EXPUNGE would also purge messages the user
+// deleted.
+func deleteUids(c *client.Client, seqset *imap.SeqSet, uidPlus bool) error {
+	err := c.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil)
+	if err != nil {
+		return err
+	}
+
+	if !uidPlus {
+		return nil
+	}
+
+	status, err := c.Execute(&uidExpunge{SeqSet: seqset}, nil)
+	if err != nil {
+		return err
+	}
+
+	return status.Err()
+}
+
+// appendMessage appends like client.Append but returns the uid of the new
+// message when the server answers with APPENDUID, otherwise 0.
+func appendMessage(c *client.Client, folderName string, flags []string, date time.Time, literal imap.Literal) (uint32, error) {
+	cmd := &commands.Append{
+		Mailbox: folderName,
+		Flags:   flags,
+		Date:    date,
+		Message: literal,
+	}
+
+	status, err := c.Execute(cmd, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := statusErr(status); err != nil {
+		return 0, err
+	}
+
+	if status.Code != "APPENDUID" || len(status.Arguments) < 2 {
+		return 0, nil
+	}
+
+	uid, err := imap.ParseNumber(status.Arguments[1])
+	if err != nil {
+		return 0, nil
+	}
+
+	return uid, nil
+}
+
+// syncFolderChanges replays flag changes of already copied messages onto
+// their destination copies. Expunged messages keep their copies, the source
+// folder must be selected.
+func (j *MigrateMailbox) syncFolderChanges(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderName string, sinceModSeq uint64) error {
+	lastUid := j.Mailbox.FolderLastUid[folderName]
+	if lastUid == 0 {
+		return nil
+	}
+
+	// Messages above lastUid are new and copied with their current flags
+	seqset := &imap.SeqSet{}
+	seqset.AddRange(1, lastUid)
+
+	// Two-way lists settle deletions through their deletion policy
+	vanished := j.tracking.qresync && !j.SyncList.TwoWay
+
+	changes, err := fetchChangedSince(srcClient, seqset, sinceModSeq, vanished, []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchEnvelope})
+	if err != nil {
+		return err
+	}
+
+	if len(changes.Messages) == 0 && len(changes.Vanished) == 0 {
+		return nil
+	}
+
+	srcUids := make([]uint32, 0, len(changes.Messages))
+	for _, msg := range changes.Messages {
+		srcUids = append(srcUids, msg.Uid)
+	}
+
+	messageMaps, err := models.FindMessageMapsBySrcUids(ctx, j.Mailbox.Id, folderName, srcUids)
+	if err != nil {
+		return err
+	}
+
+	dstFolder, err := dstClient.Select(folderName, false)
+	if err != nil {
+		return err
+	}
+
+	flagsUpdated := 0
+	for _, msg := range changes.Messages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		dstUids, err := findDestinationUids(dstClient, messageMaps[msg.Uid], normalizeMessageId(msg.Envelope))
+		if err != nil {
+			return err
+		}
+		if len(dstUids) == 0 {
+			continue
+		}
+
+		dstSeqset := &imap.SeqSet{}
+		dstSeqset.AddNum(dstUids...)
+		err = dstClient.UidStore(dstSeqset, imap.FormatFlagsOp(imap.SetFlags, true), flagsToInterface(j.flags.apply(msg.Flags, dstFolder.PermanentFlags)), nil)
+		if err != nil {
+			return err
+		}
+		flagsUpdated++
+	}
+
+	// Only mirror lists delete destination copies, runMirror finds the
+	// expunged messages in the ledger after the folders are copied and
+	// deletes them within the delete limit. Other lists forget them.
+	if !j.SyncList.Mirror {
+		err = models.DeleteMessageMapsBySrcUids(ctx, j.Mailbox.Id, folderName, changes.Vanished)
+		if err != nil {
+			return err
+		}
+	}
+
+	slog.Debug("Synced changes", "folder", folderName, "flagsUpdated", flagsUpdated, "vanished", len(changes.Vanished))
+
+	return nil
+}
+
+// findDestinationUids resolves the destination copy of a source message,
+// by its recorded uid or else by Message-ID.
+func findDestinationUids(dstClient *client.Client, messageMap *models.MessageMap, messageId string) ([]uint32, error) {
+	if messageMap != nil && messageMap.DstUid != nil {
+		return []uint32{*messageMap.DstUid}, nil
+	}
+
+	if messageId == "" && messageMap != nil && messageMap.MessageId != nil {
+		messageId = *messageMap.MessageId
+	}
+	if messageId == "" {
+		return nil, nil
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Set("Message-ID", messageId)
+	criteria.WithoutFlags = []string{imap.DeletedFlag}
+
+	return dstClient.UidSearch(criteria)
+}
@@ -0,0 +1,226 @@
+package jobs
+
+import (
+	"app/models"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// contentIndex holds the digests of the destination messages without a
+// Message-ID in the selected folder. It is built on the first lookup, once
+// per folder, so folders whose messages all have a Message-ID cost nothing.
+type contentIndex struct {
+	c       *client.Client
+	mode    models.ContentDedup
+	digests map[string]int
+}
+
+func newContentIndex(c *client.Client, mode models.ContentDedup) *contentIndex {
+	return &contentIndex{c: c, mode: mode}
+}
+
+// headerDigest covers Date, From, Subject and size, normalized so the same
+// message read from two servers gives the same digest.
+func headerDigest(envelope *imap.Envelope, size uint32) string {
+	var date, subject string
+	from := make([]string, 0)
+	if envelope != nil {
+		if !envelope.Date.IsZero() {
+			date = strconv.FormatInt(envelope.Date.Unix(), 10)
+		}
+		subject = strings.ToLower(strings.Join(strings.Fields(envelope.Subject), " "))
+		for _, address := range envelope.From {
+			from = append(from, strings.ToLower(address.Address()))
+		}
+	}
+
+	sum := sha256.Sum256([]byte(date + "\n" + strings.Join(from, ",") + "\n" + subject + "\n" + strconv.FormatUint(uint64(size), 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// messageDigest reads a fetched message in the index's mode. In body mode the
+// literal is consumed, it is put back so the message can still be appended.
+func (x *contentIndex) messageDigest(msg *imap.Message) (string, error) {
+	if x.mode != models.ContentDedupBody {
+		return headerDigest(msg.Envelope, msg.Size), nil
+	}
+
+	for section, literal := range msg.Body {
+		if literal == nil {
+			continue
+		}
+
+		body, err := io.ReadAll(literal)
+		if err != nil {
+			return "", err
+		}
+		msg.Body[section] = bytes.NewReader(body)
+
+		return bodyDigest(body), nil
+	}
+
+	return bodyDigest(nil), nil
+}
+
+func (x *contentIndex) build(ctx context.Context) error {
+	x.digests = make(map[string]int)
+
+	mbox := x.c.Mailbox()
+	if mbox == nil || mbox.Messages == 0 {
+		return nil
+	}
+
+	messages, err := fetchAll(ctx, x.c, mbox.Messages, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size})
+	if err != nil {
+		return err
+	}
+
+	bodies := &imap.SeqSet{}
+	for _, msg := range messages {
+		if normalizeMessageId(msg.Envelope) != "" || hasFlag(msg.Flags, imap.DeletedFlag) {
+			continue
+		}
+
+		if x.mode == models.ContentDedupBody {
+			bodies.AddNum(msg.SeqNum)
+			continue
+		}
+		x.digests[headerDigest(msg.Envelope, msg.Size)]++
+	}
+
+	if bodies.Empty() {
+		return nil
+	}
+
+	section := &imap.BodySectionName{Peek: true}
+	return fetchEach(ctx, x.c, bodies, false, []imap.FetchItem{section.FetchItem()}, func(msg *imap.Message) error {
+		digest, err := x.messageDigest(msg)
+		if err != nil {
+			return err
+		}
+
+		x.digests[digest]++
+		return nil
+	})
+}
+
+// contains reports whether a source message without a Message-ID already
+// has a copy in the destination folder. Each copy answers for a single
+// source message. The folder must be selected on the index's client.
+func (x *contentIndex) contains(ctx context.Context, msg *imap.Message) (bool, error) {
+	if x.digests == nil {
+		err := x.build(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	digest, err := x.messageDigest(msg)
+	if err != nil {
+		return false, err
+	}
+
+	if x.digests[digest] == 0 {
+		return false, nil
+	}
+	x.digests[digest]--
+
+	return true, nil
+}
+
+// messageIdIndex holds the Message-IDs of the selected destination folder,
+// read once from their header field instead of one SEARCH per message.
+type messageIdIndex struct {
+	c          *client.Client
+	messageIds map[string]bool
+}
+
+func newMessageIdIndex(c *client.Client) *messageIdIndex {
+	return &messageIdIndex{c: c}
+}
+
+var messageIdSection = &imap.BodySectionName{
+	BodyPartName: imap.BodyPartName{
+		Specifier: imap.HeaderSpecifier,
+		Fields:    []string{"MESSAGE-ID"},
+	},
+	Peek: true,
+}
+
+// headerMessageId parses the Message-ID out of a fetched header section.
+func headerMessageId(msg *imap.Message) string {
+	literal := msg.GetBody(messageIdSection)
+	if literal == nil {
+		return ""
+	}
+
+	header, err := textproto.NewReader(bufio.NewReader(literal)).ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(header.Get("Message-Id"))
+}
+
+func (x *messageIdIndex) build(ctx context.Context) error {
+	x.messageIds = make(map[string]bool)
+
+	mbox := x.c.Mailbox()
+	if mbox == nil || mbox.Messages == 0 {
+		return nil
+	}
+
+	seqset := &imap.SeqSet{}
+	seqset.AddRange(1, 0)
+
+	return fetchEach(ctx, x.c, seqset, false, []imap.FetchItem{imap.FetchFlags, messageIdSection.FetchItem()}, func(msg *imap.Message) error {
+		if hasFlag(msg.Flags, imap.DeletedFlag) {
+			return nil
+		}
+
+		if messageId := headerMessageId(msg); messageId != "" {
+			x.messageIds[messageId] = true
+		}
+		return nil
+	})
+}
+
+// contains reports whether the destination folder holds messageId. The
+// folder must be selected on the index's client.
+func (x *messageIdIndex) contains(ctx context.Context, messageId string) (bool, error) {
+	if messageId == "" {
+		return false, nil
+	}
+
+	if x.messageIds == nil {
+		err := x.build(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return x.messageIds[messageId], nil
+}
+
+// add records a message appended during the run, so a second source copy
+// of it is skipped like a SEARCH would have.
+func (x *messageIdIndex) add(messageId string) {
+	if x.messageIds != nil && messageId != "" {
+		x.messageIds[messageId] = true
+	}
+}
@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"app/models"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestHeaderDigest(t *testing.T) {
+	date := time.Date(2026, time.March, 2, 10, 17, 0, 0, time.UTC)
+	envelope := func(date time.Time, subject string, from ...string) *imap.Envelope {
+		addresses := make([]*imap.Address, 0, len(from))
+		for _, address := range from {
+			mailbox, host, _ := strings.Cut(address, "@")
+			addresses = append(addresses, &imap.Address{MailboxName: mailbox, HostName: host})
+		}
+		return &imap.Envelope{Date: date, Subject: subject, From: addresses}
+	}
+	base := headerDigest(envelope(date, "Quarterly report", "alice@example.com"), 2048)
+
+	tests := []struct {
+		name     string
+		envelope *imap.Envelope
+		size     uint32
+		same     bool
+	}{
+		{"identical", envelope(date, "Quarterly report", "alice@example.com"), 2048, true},
+		{"subject case and spacing", envelope(date, "  quarterly   REPORT ", "alice@example.com"), 2048, true},
+		{"address case", envelope(date, "Quarterly report", "Alice@Example.COM"), 2048, true},
+		{"date in another zone", envelope(date.In(time.FixedZone("CET", 3600)), "Quarterly report", "alice@example.com"), 2048, true},
+		{"other date", envelope(date.Add(time.Second), "Quarterly report", "alice@example.com"), 2048, false},
+		{"other subject", envelope(date, "Quarterly report v2", "alice@example.com"), 2048, false},
+		{"other sender", envelope(date, "Quarterly report", "bob@example.com"), 2048, false},
+		{"extra sender", envelope(date, "Quarterly report", "alice@example.com", "bob@example.com"), 2048, false},
+		{"other size", envelope(date, "Quarterly report", "alice@example.com"), 2049, false},
+		{"no envelope", nil, 2048, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := headerDigest(tt.envelope, tt.size) == base; same != tt.same {
+				t.Errorf("headerDigest() matches = %v, want %v", same, tt.same)
+			}
+		})
+	}
+
+	if headerDigest(nil, 0) != headerDigest(&imap.Envelope{}, 0) {
+		t.Error("headerDigest() differs between a missing and an empty envelope")
+	}
+}
+
+func TestMessageDigestBodyMode(t *testing.T) {
+	section := &imap.BodySectionName{}
+	body := []byte("Subject: Hi\r\n\r\nHello\r\n")
+	msg := &imap.Message{Body: map[*imap.BodySectionName]imap.Literal{section: bytes.NewReader(body)}}
+
+	x := &contentIndex{mode: models.ContentDedupBody}
+	digest, err := x.messageDigest(msg)
+	if err != nil {
+		t.Fatalf("messageDigest() error = %v", err)
+	}
+	if digest != bodyDigest(body) {
+		t.Errorf("messageDigest() = %s, want the body digest", digest)
+	}
+
+	// The literal is put back for the APPEND
+	restored, err := io.ReadAll(msg.Body[section])
+	if err != nil || !bytes.Equal(restored, body) {
+		t.Errorf("body after digest = %q, %v, want %q", restored, err, body)
+	}
+}
+
+func TestHeaderMessageId(t *testing.T) {
+	// Servers answer without the PEEK of the request
+	responseSection := &imap.BodySectionName{BodyPartName: messageIdSection.BodyPartName}
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"message id", "Message-ID: <abc@example.com>\r\n\r\n", "<abc@example.com>"},
+		{"header name case", "message-id:   <abc@example.com>  \r\n\r\n", "<abc@example.com>"},
+		{"folded", "Message-ID:\r\n <abc@example.com>\r\n\r\n", "<abc@example.com>"},
+		{"no terminating blank line", "Message-ID: <abc@example.com>\r\n", "<abc@example.com>"},
+		{"no message id", "\r\n", ""},
+		{"empty section", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &imap.Message{Body: map[*imap.BodySectionName]imap.Literal{
+				responseSection: bytes.NewReader([]byte(tt.header)),
+			}}
+			if got := headerMessageId(msg); got != tt.want {
+				t.Errorf("headerMessageId() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := headerMessageId(&imap.Message{}); got != "" {
+		t.Errorf("headerMessageId() without the section = %q, want empty", got)
+	}
+}
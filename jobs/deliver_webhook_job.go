@@ -0,0 +1,316 @@
+package jobs
+
+import (
+	"app/config"
+	"app/helpers"
+	"app/models"
+	"app/worker"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var DeliverWebhookType models.JobType = "deliver_webhook"
+
+// Delays between delivery attempts, the first attempt is immediate. Each
+// retry is a delayed job of its own so a failing endpoint doesn't hold a
+// worker while it waits.
+var webhookRetryDelays = []time.Duration{
+	10 * time.Second,
+	30 * time.Second,
+	2 * time.Minute,
+	5 * time.Minute,
+}
+
+var errWebhookAddress = errors.New("webhook host resolves to a private address")
+
+// Every connection is checked once its host is resolved, which covers
+// redirects and names that resolve differently between requests. There is no
+// proxy, it would be dialed instead of the host.
+var webhookHttpClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: webhookDialControl,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// Carrier-grade NAT space, not covered by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func webhookDialControl(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !isPublicAddr(addr) {
+		return errWebhookAddress
+	}
+
+	return nil
+}
+
+// isPublicAddr reports whether addr is a unicast address outside the
+// loopback, link-local and private ranges.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+type DeliverWebhook struct {
+	Delivery *models.WebhookDelivery
+
+	retrying bool
+}
+
+type DeliverWebhookPayload struct {
+	DeliveryId int `json:"deliveryId"`
+}
+
+type WebhookJobBody struct {
+	Id           int              `json:"id"`
+	Type         models.JobType   `json:"type"`
+	Status       models.JobStatus `json:"status"`
+	Error        *string          `json:"error"`
+	RelatedTable *string          `json:"relatedTable"`
+	RelatedId    *int             `json:"relatedId"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	StartedAt    *time.Time       `json:"startedAt"`
+	FinishedAt   *time.Time       `json:"finishedAt"`
+}
+
+type WebhookBody struct {
+	Event      models.WebhookEvent `json:"event"`
+	OccurredAt time.Time           `json:"occurredAt"`
+	Job        WebhookJobBody      `json:"job"`
+}
+
+func DeliverWebhookFactory(ctx context.Context, payload *json.RawMessage) (worker.JobHandler, error) {
+	deliverWebhookPayload := new(DeliverWebhookPayload)
+
+	err := json.Unmarshal(*payload, deliverWebhookPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := models.FindWebhookDeliveryByIdWithWebhook(ctx, deliverWebhookPayload.DeliveryId)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &DeliverWebhook{
+		Delivery: delivery,
+	}
+
+	return handler, nil
+}
+
+// SignWebhookBody returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhookBody(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (j *DeliverWebhook) Run(ctx context.Context) error {
+	secret, err := helpers.AesDecrypt(j.Delivery.Webhook.SecretHash, config.Config.AppKey)
+	if err != nil {
+		return err
+	}
+
+	j.Delivery.Attempts++
+	err = j.send(ctx, secret)
+	if err == nil {
+		now := time.Now()
+		j.Delivery.Status = models.WebhookDeliveryStatusDelivered
+		j.Delivery.Error = nil
+		j.Delivery.DeliveredAt = &now
+		return nil
+	}
+
+	errStr := err.Error()
+	j.Delivery.Error = &errStr
+	slog.Debug("webhook: delivery attempt failed", "delivery", j.Delivery.Id, "attempt", j.Delivery.Attempts, "error", err)
+
+	// A private address won't become public by waiting
+	if j.Delivery.Attempts > len(webhookRetryDelays) || errors.Is(err, errWebhookAddress) {
+		return err
+	}
+
+	retryErr := j.scheduleRetry(ctx, webhookRetryDelays[j.Delivery.Attempts-1])
+	if retryErr != nil {
+		return errors.Join(err, retryErr)
+	}
+	j.retrying = true
+
+	return err
+}
+
+// scheduleRetry queues the next attempt of the delivery after delay.
+func (j *DeliverWebhook) scheduleRetry(ctx context.Context, delay time.Duration) error {
+	payloadJson, err := json.Marshal(DeliverWebhookPayload{DeliveryId: j.Delivery.Id})
+	if err != nil {
+		return err
+	}
+
+	// The attempt that failed may have been cancelled
+	_, err = models.CreateDelayedJobWithRelated(context.WithoutCancel(ctx), j.Delivery.Webhook.UserId, DeliverWebhookType, "webhook_deliveries", j.Delivery.Id, (*json.RawMessage)(&payloadJson), time.Now().Add(delay))
+	return err
+}
+
+func (j *DeliverWebhook) send(ctx context.Context, secret string) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body := []byte(j.Delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.Delivery.Webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", config.Config.AppName+"-Webhook")
+	req.Header.Set("X-Webhook-Event", string(j.Delivery.Event))
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(j.Delivery.Id))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhookBody(secret, timestamp, body))
+
+	res, err := webhookHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	j.Delivery.ResponseStatus = &res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// OnStop records the attempt, a delivery with a retry queued stays pending.
+func (j *DeliverWebhook) OnStop(ctx context.Context) error {
+	if j.Delivery.Status != models.WebhookDeliveryStatusDelivered && !j.retrying {
+		j.Delivery.Status = models.WebhookDeliveryStatusFailed
+	}
+
+	return models.UpdateWebhookDelivery(ctx, j.Delivery)
+}
+
+// DispatchJobEvent queues a delivery for every webhook of the job owner that
+// subscribes to the event matching the job's current status.
+func DispatchJobEvent(ctx context.Context, job *models.Job) {
+	if job.Type == DeliverWebhookType || job.Type == SendEmailType {
+		return
+	}
+
+	event, ok := models.WebhookEventForJobStatus(job.Status)
+	if !ok {
+		return
+	}
+
+	err := dispatchWebhookEvent(ctx, job, event)
+	if err != nil {
+		slog.Error("webhook: failed to dispatch event", "job", job.Id, "event", event, "err", err)
+	}
+}
+
+func dispatchWebhookEvent(ctx context.Context, job *models.Job, event models.WebhookEvent) error {
+	webhooks, err := models.FindWebhooksByUserId(ctx, job.UserId)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(WebhookBody{
+		Event:      event,
+		OccurredAt: time.Now(),
+		Job: WebhookJobBody{
+			Id:           job.Id,
+			Type:         job.Type,
+			Status:       job.Status,
+			Error:        job.Error,
+			RelatedTable: job.RelatedTable,
+			RelatedId:    job.RelatedId,
+			CreatedAt:    job.CreatedAt,
+			StartedAt:    job.StartedAt,
+			FinishedAt:   job.FinishedAt,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+
+		deliveries = append(deliveries, &models.WebhookDelivery{
+			WebhookId: webhook.Id,
+			Event:     event,
+			Payload:   body,
+			Status:    models.WebhookDeliveryStatusPending,
+			CreatedAt: time.Now(),
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	err = models.CreateWebhookDeliveries(ctx, deliveries)
+	if err != nil {
+		return err
+	}
+
+	deliveryIds := make([]int, len(deliveries))
+	payloads := make([]*json.RawMessage, len(deliveries))
+	for i, delivery := range deliveries {
+		payloadJson, err := json.Marshal(DeliverWebhookPayload{DeliveryId: delivery.Id})
+		if err != nil {
+			return err
+		}
+
+		deliveryIds[i] = delivery.Id
+		payloads[i] = (*json.RawMessage)(&payloadJson)
+	}
+
+	_, err = models.CreateJobsWithRelated(ctx, job.UserId, DeliverWebhookType, "webhook_deliveries", deliveryIds, payloads)
+	return err
+}
+
+// DispatchJobEvents is DispatchJobEvent for a batch of jobs.
+func DispatchJobEvents(ctx context.Context, jobs []*models.Job) {
+	for _, job := range jobs {
+		DispatchJobEvent(ctx, job)
+	}
+}
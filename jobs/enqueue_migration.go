@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"app/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrMultipleJobs = errors.New("found multiple jobs for mailbox")
+
+// EnqueueSyncListMigration queues a MigrateMailbox job for every mailbox of
+// the list, which must be loaded with its mailboxes. Each mailbox keeps a
+// single job row that is reset to pending, mailboxes whose job is already
+// running or pending are left alone. Lists with an active live sync are
+// refused since both would copy the same messages.
+func EnqueueSyncListMigration(ctx context.Context, list *models.SyncList, userId int) error {
+	if list.IsCutOver() {
+		return ErrSyncListCutOver
+	}
+
+	liveSyncActive, err := IsLiveSyncActive(ctx, list.Id)
+	if err != nil {
+		return err
+	}
+	if liveSyncActive {
+		return ErrLiveSyncActive
+	}
+
+	if len(list.Mailboxes) == 0 {
+		return nil
+	}
+
+	mailboxIds := make([]int, 0)
+	for _, mailbox := range list.Mailboxes {
+		mailboxIds = append(mailboxIds, mailbox.Id)
+	}
+
+	jobsByMailboxId, err := models.FindJobsByManyRelatedMap(ctx, "mailboxes", mailboxIds)
+	if err != nil {
+		return err
+	}
+
+	jobsToUpdate := make([]*models.Job, 0)
+	newJobPayloads := make([]*json.RawMessage, 0)
+	newJobMailboxIds := make([]int, 0)
+
+	for _, mailboxId := range mailboxIds {
+		relJobs, exists := jobsByMailboxId[mailboxId]
+		if len(relJobs) > 1 {
+			return ErrMultipleJobs
+		}
+
+		if exists {
+			if relJobs[0].Status == models.JobStatusRunning || relJobs[0].Status == models.JobStatusPending {
+				continue
+			}
+
+			relJobs[0].Status = models.JobStatusPending
+			now := time.Now()
+			relJobs[0].StartedAt = &now
+			relJobs[0].FinishedAt = nil
+			jobsToUpdate = append(jobsToUpdate, relJobs[0])
+		} else {
+			payloadJson, err := json.Marshal(MigrateMailboxPayload{
+				SyncListId: list.Id,
+				MailboxId:  mailboxId,
+			})
+			if err != nil {
+				return err
+			}
+
+			newJobPayloads = append(newJobPayloads, (*json.RawMessage)(&payloadJson))
+			newJobMailboxIds = append(newJobMailboxIds, mailboxId)
+		}
+	}
+
+	if len(jobsToUpdate) > 0 {
+		if err := models.UpdateJobs(ctx, jobsToUpdate); err != nil {
+			return err
+		}
+		DispatchJobEvents(ctx, jobsToUpdate)
+	}
+
+	if len(newJobPayloads) > 0 {
+		newJobs, err := models.CreateJobsWithRelated(ctx, userId, MigrateMailboxType, "mailboxes", newJobMailboxIds, newJobPayloads)
+		if err != nil {
+			return err
+		}
+		DispatchJobEvents(ctx, newJobs)
+	}
+
+	return nil
+}
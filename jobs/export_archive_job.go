@@ -0,0 +1,294 @@
+package jobs
+
+import (
+	"app/models"
+	"app/worker"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var ExportArchiveType models.JobType = "export_archive"
+
+var errMissingBody = errors.New("server sent a message without its body")
+
+// ExportArchive writes every folder of a mailbox's source into a zip file in
+// the archive directory. The file only appears once the export completed.
+type ExportArchive struct {
+	Archive  *models.Archive
+	SyncList *models.SyncList
+	Mailbox  *models.Mailbox
+
+	limiter  *transferLimiter
+	exported int
+}
+
+type ExportArchivePayload struct {
+	ArchiveId int `json:"archiveId"`
+}
+
+func ExportArchiveFactory(ctx context.Context, payload *json.RawMessage) (worker.JobHandler, error) {
+	exportPayload := new(ExportArchivePayload)
+
+	err := json.Unmarshal(*payload, exportPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := models.FindArchiveById(ctx, exportPayload.ArchiveId)
+	if err != nil {
+		return nil, err
+	}
+
+	mailbox, err := models.FindMailboxById(ctx, archive.MailboxId)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := models.FindSyncListById(ctx, mailbox.SyncListId)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &ExportArchive{
+		Archive:  archive,
+		SyncList: list,
+		Mailbox:  mailbox,
+	}
+
+	return handler, nil
+}
+
+// Run exports the mailbox. Failures carry their ErrorClass.
+func (j *ExportArchive) Run(ctx context.Context) error {
+	return classifyError(j.run(ctx))
+}
+
+func (j *ExportArchive) run(ctx context.Context) (err error) {
+	p := ArchivePath(j.Archive.Path)
+	partPath := p + ".part"
+
+	err = os.MkdirAll(filepath.Dir(p), 0o750)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(partPath)
+		}
+	}()
+
+	j.limiter = newSourceLimiter(j.SyncList)
+	w := newArchiveWriter(f, j.Archive.Format, j.Mailbox.SrcUser)
+
+	if j.SyncList.SrcProtocol == models.SourceProtocolPop3 {
+		err = j.exportPop3(ctx, w)
+	} else {
+		err = j.exportImap(ctx, w)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = w.close()
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(partPath, p)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	j.Archive.Size = info.Size()
+
+	return nil
+}
+
+// listExportFolders lists the folders that hold messages, \Noselect
+// folders only group others.
+func listExportFolders(c *client.Client) ([]*imap.MailboxInfo, error) {
+	mailboxes := make(chan *imap.MailboxInfo)
+	listDone := make(chan error, 1)
+	go func() {
+		listDone <- c.List("", "*", mailboxes)
+	}()
+
+	folders := make([]*imap.MailboxInfo, 0)
+	for mbox := range mailboxes {
+		if hasFlag(mbox.Attributes, imap.NoSelectAttr) {
+			continue
+		}
+		folders = append(folders, mbox)
+	}
+
+	return folders, <-listDone
+}
+
+func (j *ExportArchive) exportImap(ctx context.Context, w archiveWriter) error {
+	srcClient, err := connectSource(ctx, j.SyncList, j.Mailbox)
+	if err != nil {
+		return err
+	}
+	defer srcClient.Logout()
+
+	folders, err := listExportFolders(srcClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "source", "error", err)
+		return err
+	}
+
+	for _, folder := range folders {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		srcFolder, err := srcClient.Select(folder.Name, true)
+		if err != nil {
+			slog.Debug("Failed to select source folder", "folder", folder.Name, "error", err)
+			return err
+		}
+
+		name := folder.Name
+		if folder.Delimiter != "" {
+			name = strings.ReplaceAll(name, folder.Delimiter, "/")
+		}
+
+		err = w.begin(name)
+		if err != nil {
+			return err
+		}
+
+		if srcFolder.Messages == 0 {
+			continue
+		}
+
+		seqset := &imap.SeqSet{}
+		seqset.AddRange(1, 0)
+
+		items := []imap.FetchItem{imap.FetchFlags, imap.FetchInternalDate, imap.FetchRFC822}
+		err = fetchEach(ctx, srcClient, seqset, false, items, func(msg *imap.Message) error {
+			literal := msg.GetBody(&imap.BodySectionName{})
+			if literal == nil {
+				return errMissingBody
+			}
+
+			body, err := io.ReadAll(literal)
+			if err != nil {
+				return err
+			}
+
+			err = j.limiter.wait(ctx, len(body))
+			if err != nil {
+				return err
+			}
+
+			err = w.add(&archiveMessage{
+				body:  body,
+				flags: syncableFlags(msg.Flags),
+				date:  msg.InternalDate,
+			})
+			if err != nil {
+				return err
+			}
+
+			j.exported++
+			return nil
+		})
+		if err != nil {
+			slog.Debug("Failed to export folder", "folder", folder.Name, "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportPop3 writes the maildrop as the INBOX, dated by its Date headers.
+func (j *ExportArchive) exportPop3(ctx context.Context, w archiveWriter) error {
+	srcClient, err := connectPop3Source(ctx, j.SyncList, j.Mailbox)
+	if err != nil {
+		return err
+	}
+	defer srcClient.quit()
+
+	messages, err := srcClient.uidl()
+	if err != nil {
+		slog.Debug("Failed to list messages", "connection", "source", "error", err)
+		return err
+	}
+
+	err = w.begin(pop3Folder)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		body, err := srcClient.retr(message.num)
+		if err != nil {
+			slog.Debug("Failed to retrieve message", "uidl", message.uidl, "error", err)
+			return err
+		}
+
+		err = j.limiter.wait(ctx, len(body))
+		if err != nil {
+			return err
+		}
+
+		var date time.Time
+		if parsed, err := mail.ReadMessage(bytes.NewReader(body)); err == nil {
+			date, _ = parsed.Header.Date()
+		}
+
+		err = w.add(&archiveMessage{
+			body:  body,
+			flags: []string{},
+			date:  date,
+		})
+		if err != nil {
+			return err
+		}
+
+		j.exported++
+	}
+
+	return nil
+}
+
+// OnStop records how many messages were written, the file is only kept when
+// the export completed.
+func (j *ExportArchive) OnStop(ctx context.Context) error {
+	j.Archive.Messages = j.exported
+
+	return models.UpdateArchive(ctx, j.Archive)
+}
@@ -0,0 +1,273 @@
+package jobs
+
+import (
+	"app/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var ErrSyncListCutOver = errors.New("sync list is cut over")
+
+// runFinalSync re-scans every folder regardless of FolderLastUid. Messages
+// found in the destination by Message-ID only get their flags brought in
+// line, the others are appended. A report is stored per mailbox.
+func (j *MigrateMailbox) runFinalSync(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderNames []string) (err error) {
+	j.report = &models.MailboxReportData{
+		Folders:       make([]models.FolderReport, 0, len(folderNames)),
+		Discrepancies: make([]string, 0),
+	}
+	j.reportType = models.ReportTypeFinalSync
+	defer func() {
+		j.runErr = err
+	}()
+
+	for _, folderName := range folderNames {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		folderReport, err := j.finalSyncFolder(ctx, srcClient, dstClient, folderName)
+		if err != nil {
+			return err
+		}
+
+		j.report.Folders = append(j.report.Folders, folderReport)
+
+		if folderReport.DestinationMessages < folderReport.SourceMessages {
+			j.report.Discrepancies = append(j.report.Discrepancies, fmt.Sprintf(
+				"%s: destination has %d messages, source has %d",
+				folderName, folderReport.DestinationMessages, folderReport.SourceMessages,
+			))
+		}
+	}
+
+	return nil
+}
+
+func (j *MigrateMailbox) finalSyncFolder(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderName string) (models.FolderReport, error) {
+	report := models.FolderReport{Folder: folderName}
+
+	srcFolder, err := srcClient.Select(folderName, true)
+	if err != nil {
+		slog.Debug("Failed to select source folder", "folder", folderName, "error", err)
+		return report, err
+	}
+
+	if j.Mailbox.FolderUidValidity[folderName] != srcFolder.UidValidity {
+		err = j.resetFolderState(ctx, folderName, srcFolder.UidValidity)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	srcMessages, err := fetchAll(ctx, srcClient, srcFolder.Messages, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid})
+	if err != nil {
+		slog.Debug("Failed to fetch messages", "connection", "source", "folder", folderName, "error", err)
+		return report, err
+	}
+	report.SourceMessages = len(srcMessages)
+
+	if len(srcMessages) == 0 {
+		return report, nil
+	}
+
+	if err := ensureFolder(dstClient, folderName); err != nil {
+		return report, err
+	}
+
+	dstFolder, err := dstClient.Select(folderName, false)
+	if err != nil {
+		slog.Debug("Failed to select destination folder", "folder", folderName, "error", err)
+		return report, err
+	}
+
+	dstMessages, err := fetchAll(ctx, dstClient, dstFolder.Messages, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid})
+	if err != nil {
+		slog.Debug("Failed to fetch messages", "connection", "destination", "folder", folderName, "error", err)
+		return report, err
+	}
+
+	dstByMessageId := make(map[string][]*imap.Message)
+	for _, msg := range dstMessages {
+		messageId := normalizeMessageId(msg.Envelope)
+		if messageId != "" {
+			dstByMessageId[messageId] = append(dstByMessageId[messageId], msg)
+		}
+	}
+
+	var contents *contentIndex
+	if j.SyncList.ContentDedup != models.ContentDedupOff {
+		contents = newContentIndex(dstClient, j.SyncList.ContentDedup)
+	}
+
+	toCopy := &imap.SeqSet{}
+	for _, msg := range srcMessages {
+		messageId := normalizeMessageId(msg.Envelope)
+
+		if messageId == "" {
+			report.WithoutMessageId++
+			// Without a Message-ID only the UID tells whether it was copied,
+			// unless its content is looked up in the destination
+			if contents != nil || msg.Uid > j.Mailbox.FolderLastUid[folderName] {
+				toCopy.AddNum(msg.Uid)
+			}
+			continue
+		}
+
+		matches := dstByMessageId[messageId]
+		if len(matches) == 0 {
+			toCopy.AddNum(msg.Uid)
+			continue
+		}
+
+		// Each destination copy answers for a single source message
+		dstMsg := matches[0]
+		dstByMessageId[messageId] = matches[1:]
+		report.Duplicates++
+
+		err = j.recordMessageMap(ctx, folderName, msg.Uid, dstMsg.Uid, messageId)
+		if err != nil {
+			return report, err
+		}
+
+		flags := j.flags.apply(msg.Flags, dstFolder.PermanentFlags)
+		if sameFlags(flags, dstMsg.Flags) {
+			continue
+		}
+
+		seqset := &imap.SeqSet{}
+		seqset.AddNum(dstMsg.Uid)
+		err = dstClient.UidStore(seqset, imap.FormatFlagsOp(imap.SetFlags, true), flagsToInterface(flags), nil)
+		if err != nil {
+			slog.Debug("Failed to store flags", "folder", folderName, "messageID", messageId, "error", err)
+			return report, err
+		}
+		report.FlagsUpdated++
+	}
+
+	if !toCopy.Empty() {
+		// Bodies are only fetched for messages missing from the destination
+		err = fetchEach(ctx, srcClient, toCopy, true, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822, imap.FetchRFC822Size, imap.FetchUid}, func(msg *imap.Message) error {
+			if contents != nil && normalizeMessageId(msg.Envelope) == "" {
+				duplicate, err := contents.contains(ctx, msg)
+				if err != nil {
+					return err
+				}
+				if duplicate {
+					report.Duplicates++
+					return nil
+				}
+			}
+
+			literal := msg.GetBody(&imap.BodySectionName{})
+			if literal == nil {
+				return nil
+			}
+
+			dstUid, err := j.limiter.append(ctx, dstClient, j.SyncList.DstHost, folderName, j.flags.apply(msg.Flags, dstFolder.PermanentFlags), msg.Envelope.Date, literal)
+			if err != nil {
+				return err
+			}
+
+			if msg.Uid > j.Mailbox.FolderLastUid[folderName] {
+				j.Mailbox.FolderLastUid[folderName] = msg.Uid
+			}
+			j.Mailbox.LastRunMessages++
+			report.Copied++
+
+			return j.recordMessageMap(ctx, folderName, msg.Uid, dstUid, normalizeMessageId(msg.Envelope))
+		})
+		if err != nil {
+			slog.Debug("Failed to copy messages", "folder", folderName, "error", err)
+			return report, err
+		}
+	}
+
+	err = j.flushMessageMaps(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	report.DestinationMessages = len(dstMessages) + report.Copied
+
+	return report, nil
+}
+
+func flagsToInterface(flags []string) []interface{} {
+	result := make([]interface{}, len(flags))
+	for i, flag := range flags {
+		result[i] = flag
+	}
+
+	return result
+}
+
+// CompleteCutOver marks a sync list as cut over once every mailbox completed
+// a final sync.
+func CompleteCutOver(ctx context.Context, job *models.Job) {
+	if job.Type != MigrateMailboxType || job.Status != models.JobStatusCompleted || job.RelatedId == nil {
+		return
+	}
+
+	err := completeCutOver(ctx, *job.RelatedId)
+	if err != nil {
+		slog.Error("cutover: failed to complete cutover", "job", job.Id, "err", err)
+	}
+}
+
+func completeCutOver(ctx context.Context, mailboxId int) error {
+	mailbox, err := models.FindMailboxById(ctx, mailboxId)
+	if err != nil {
+		return err
+	}
+
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, mailbox.SyncListId)
+	if err != nil {
+		return err
+	}
+
+	if !list.IsFinalSync() || list.IsCutOver() {
+		return nil
+	}
+
+	mailboxIds := make([]int, len(list.Mailboxes))
+	for i, mb := range list.Mailboxes {
+		mailboxIds[i] = mb.Id
+	}
+
+	jobsByMailboxId, err := models.FindJobsByManyRelatedMap(ctx, "mailboxes", mailboxIds)
+	if err != nil {
+		return err
+	}
+
+	for _, mailboxId := range mailboxIds {
+		relJobs := jobsByMailboxId[mailboxId]
+		if len(relJobs) != 1 {
+			return nil
+		}
+
+		relJob := relJobs[0]
+		if relJob.Status != models.JobStatusCompleted || relJob.FinishedAt == nil || relJob.FinishedAt.Before(*list.FinalSyncStartedAt) {
+			return nil
+		}
+	}
+
+	marked, err := models.MarkSyncListCutOver(ctx, list.Id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if marked {
+		slog.Info("cutover: sync list cut over", "list", list.Id)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"app/models"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// flagPolicy decides which flags of a source message are set on its
+// destination copy.
+type flagPolicy struct {
+	renames     map[string]string
+	keepDeleted bool
+}
+
+func newFlagPolicy(list *models.SyncList) flagPolicy {
+	renames := make(map[string]string, len(list.FlagRenames))
+	for from, to := range list.FlagRenames {
+		renames[strings.ToLower(from)] = to
+	}
+
+	return flagPolicy{
+		renames:     renames,
+		keepDeleted: list.KeepDeletedFlags,
+	}
+}
+
+// apply renames keywords and drops \Recent, which only the server may set,
+// \Deleted unless it is kept and every flag the destination folder can't
+// store. permanentFlags is the PERMANENTFLAGS of the destination folder
+// selected read-write, nil when the server sent none and any flag is accepted.
+func (p flagPolicy) apply(flags []string, permanentFlags []string) []string {
+	accepted := make(map[string]bool, len(permanentFlags))
+	anyKeyword := false
+	for _, flag := range permanentFlags {
+		if flag == imap.TryCreateFlag {
+			anyKeyword = true
+			continue
+		}
+		accepted[strings.ToLower(flag)] = true
+	}
+
+	result := make([]string, 0, len(flags))
+	seen := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		if to, ok := p.renames[strings.ToLower(flag)]; ok {
+			flag = to
+		}
+
+		key := strings.ToLower(flag)
+		if seen[key] {
+			continue
+		}
+
+		if strings.EqualFold(flag, imap.RecentFlag) {
+			continue
+		}
+		if !p.keepDeleted && strings.EqualFold(flag, imap.DeletedFlag) {
+			continue
+		}
+
+		isKeyword := !strings.HasPrefix(flag, "\\")
+		if permanentFlags != nil && !accepted[key] && !(isKeyword && anyKeyword) {
+			continue
+		}
+
+		seen[key] = true
+		result = append(result, flag)
+	}
+
+	return result
+}
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"app/models"
+	"slices"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestFlagPolicyApply(t *testing.T) {
+	tests := []struct {
+		name           string
+		list           models.SyncList
+		flags          []string
+		permanentFlags []string
+		want           []string
+	}{
+		{
+			name:  "no permanent flags accepts everything",
+			flags: []string{imap.SeenFlag, imap.FlaggedFlag, "$Label1"},
+			want:  []string{imap.SeenFlag, imap.FlaggedFlag, "$Label1"},
+		},
+		{
+			name:  "recent is always dropped",
+			list:  models.SyncList{KeepDeletedFlags: true},
+			flags: []string{imap.RecentFlag, imap.SeenFlag, `\recent`},
+			want:  []string{imap.SeenFlag},
+		},
+		{
+			name:  "deleted is dropped by default",
+			flags: []string{imap.DeletedFlag, imap.AnsweredFlag},
+			want:  []string{imap.AnsweredFlag},
+		},
+		{
+			name:  "deleted is kept when asked",
+			list:  models.SyncList{KeepDeletedFlags: true},
+			flags: []string{imap.DeletedFlag, imap.AnsweredFlag},
+			want:  []string{imap.DeletedFlag, imap.AnsweredFlag},
+		},
+		{
+			name:  "keywords are renamed case-insensitively",
+			list:  models.SyncList{FlagRenames: map[string]string{"$label1": "Important"}},
+			flags: []string{"$Label1", imap.SeenFlag},
+			want:  []string{"Important", imap.SeenFlag},
+		},
+		{
+			name:  "duplicates after renaming are dropped",
+			list:  models.SyncList{FlagRenames: map[string]string{"Junk": "$Junk"}},
+			flags: []string{"$Junk", "Junk", "$junk"},
+			want:  []string{"$Junk"},
+		},
+		{
+			name:           "flags the folder can't store are dropped",
+			flags:          []string{imap.SeenFlag, imap.DraftFlag, "$Label1"},
+			permanentFlags: []string{imap.SeenFlag},
+			want:           []string{imap.SeenFlag},
+		},
+		{
+			name:           "permanent flags match case-insensitively",
+			flags:          []string{`\SEEN`, "work"},
+			permanentFlags: []string{imap.SeenFlag, "Work"},
+			want:           []string{`\SEEN`, "work"},
+		},
+		{
+			name:           "try create accepts keywords but not system flags",
+			flags:          []string{imap.SeenFlag, imap.DraftFlag, "$Label1"},
+			permanentFlags: []string{imap.SeenFlag, imap.TryCreateFlag},
+			want:           []string{imap.SeenFlag, "$Label1"},
+		},
+		{
+			name:           "empty permanent flags drop everything",
+			flags:          []string{imap.SeenFlag, "$Label1"},
+			permanentFlags: []string{},
+			want:           []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newFlagPolicy(&tt.list).apply(tt.flags, tt.permanentFlags)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("apply(%q, %q) = %q, want %q", tt.flags, tt.permanentFlags, got, tt.want)
+			}
+		})
+	}
+}
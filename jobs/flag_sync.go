@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"app/models"
+	"context"
+	"log/slog"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// syncFolderFlags brings the flags of messages copied by earlier runs in line
+// with the source. It is the fallback for servers without CONDSTORE, so every
+// known message is compared. The source folder must be selected.
+func (j *MigrateMailbox) syncFolderFlags(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderName string) error {
+	lastUid := j.Mailbox.FolderLastUid[folderName]
+	if lastUid == 0 {
+		return nil
+	}
+
+	seqset := &imap.SeqSet{}
+	seqset.AddRange(1, lastUid)
+
+	srcMessages, err := fetchSeqSet(ctx, srcClient, seqset, true, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid})
+	if err != nil {
+		slog.Debug("Failed to fetch flags", "connection", "source", "folder", folderName, "error", err)
+		return err
+	}
+
+	if len(srcMessages) == 0 {
+		return nil
+	}
+
+	srcUids := make([]uint32, len(srcMessages))
+	for i, msg := range srcMessages {
+		srcUids[i] = msg.Uid
+	}
+
+	messageMaps, err := models.FindMessageMapsBySrcUids(ctx, j.Mailbox.Id, folderName, srcUids)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureFolder(dstClient, folderName); err != nil {
+		return err
+	}
+
+	dstFolder, err := dstClient.Select(folderName, false)
+	if err != nil {
+		slog.Debug("Failed to select destination folder", "folder", folderName, "error", err)
+		return err
+	}
+
+	dstMessages, err := fetchAll(ctx, dstClient, dstFolder.Messages, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid})
+	if err != nil {
+		slog.Debug("Failed to fetch flags", "connection", "destination", "folder", folderName, "error", err)
+		return err
+	}
+
+	dstByUid := make(map[uint32]*imap.Message, len(dstMessages))
+	dstByMessageId := make(map[string][]*imap.Message)
+	for _, msg := range dstMessages {
+		dstByUid[msg.Uid] = msg
+		messageId := normalizeMessageId(msg.Envelope)
+		if messageId != "" {
+			dstByMessageId[messageId] = append(dstByMessageId[messageId], msg)
+		}
+	}
+
+	// Copies resolved through the UID mapping must not be matched again
+	claimed := make(map[uint32]bool)
+	for _, messageMap := range messageMaps {
+		if messageMap.DstUid != nil {
+			claimed[*messageMap.DstUid] = true
+		}
+	}
+
+	for _, msg := range srcMessages {
+		messageId := normalizeMessageId(msg.Envelope)
+
+		var dstMsg *imap.Message
+		if messageMap, ok := messageMaps[msg.Uid]; ok && messageMap.DstUid != nil {
+			dstMsg = dstByUid[*messageMap.DstUid]
+		}
+
+		if dstMsg == nil && messageId != "" {
+			matches := dstByMessageId[messageId]
+			for len(matches) > 0 && claimed[matches[0].Uid] {
+				matches = matches[1:]
+			}
+			if len(matches) > 0 {
+				dstMsg = matches[0]
+				matches = matches[1:]
+				claimed[dstMsg.Uid] = true
+
+				err = j.recordMessageMap(ctx, folderName, msg.Uid, dstMsg.Uid, messageId)
+				if err != nil {
+					return err
+				}
+			}
+			dstByMessageId[messageId] = matches
+		}
+
+		if dstMsg == nil {
+			continue
+		}
+
+		flags := j.flags.apply(msg.Flags, dstFolder.PermanentFlags)
+		if sameFlags(flags, dstMsg.Flags) {
+			continue
+		}
+
+		dstSeqset := &imap.SeqSet{}
+		dstSeqset.AddNum(dstMsg.Uid)
+		err = dstClient.UidStore(dstSeqset, imap.FormatFlagsOp(imap.SetFlags, true), flagsToInterface(flags), nil)
+		if err != nil {
+			slog.Debug("Failed to store flags", "folder", folderName, "messageID", messageId, "error", err)
+			return err
+		}
+	}
+
+	return j.flushMessageMaps(ctx)
+}
@@ -0,0 +1,483 @@
+package jobs
+
+import (
+	"app/models"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/utf7"
+)
+
+const gmailCapability = "X-GM-EXT-1"
+
+const (
+	fetchGmailMsgId  imap.FetchItem = "X-GM-MSGID"
+	fetchGmailLabels imap.FetchItem = "X-GM-LABELS"
+)
+
+// Destination folders used when the server has no matching special-use folder
+const (
+	gmailSentFolder    = "Sent"
+	gmailDraftsFolder  = "Drafts"
+	gmailArchiveFolder = "Archive"
+)
+
+var errGmailAllMailMissing = errors.New("gmail: no folder with the \\All attribute")
+
+func supportsGmail(c *client.Client) bool {
+	ok, err := c.Support(gmailCapability)
+	return err == nil && ok
+}
+
+// listSpecialFolders maps lower-cased special-use attributes to the first
+// folder carrying them.
+func listSpecialFolders(c *client.Client) (map[string]string, error) {
+	mailboxes := make(chan *imap.MailboxInfo)
+	listDone := make(chan error, 1)
+	go func() {
+		listDone <- c.List("", "*", mailboxes)
+	}()
+
+	folders := make(map[string]string)
+	for mbox := range mailboxes {
+		for _, attr := range mbox.Attributes {
+			key := strings.ToLower(attr)
+			if _, ok := folders[key]; !ok {
+				folders[key] = mbox.Name
+			}
+		}
+	}
+
+	return folders, <-listDone
+}
+
+func specialFolder(folders map[string]string, attr string, fallback string) string {
+	if name, ok := folders[strings.ToLower(attr)]; ok {
+		return name
+	}
+
+	return fallback
+}
+
+func gmailMessageId(msg *imap.Message) string {
+	if v, ok := msg.Items[fetchGmailMsgId]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+
+	return ""
+}
+
+// gmailLabels returns the labels of a message with user labels decoded from
+// modified UTF-7. System labels such as \Inbox keep their backslash.
+func gmailLabels(msg *imap.Message) []string {
+	fields, _ := msg.Items[fetchGmailLabels].([]interface{})
+
+	labels := make([]string, 0, len(fields))
+	for _, field := range fields {
+		label, err := imap.ParseString(field)
+		if err != nil || label == "" {
+			continue
+		}
+
+		if decoded, err := utf7.Encoding.NewDecoder().String(label); err == nil {
+			label = decoded
+		}
+		labels = append(labels, label)
+	}
+
+	return labels
+}
+
+// labelKeyword turns a label into a keyword atom.
+func labelKeyword(label string) string {
+	var b strings.Builder
+	for _, r := range label {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune("(){%*\"\\]", r) {
+			b.WriteByte('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gmailCopier writes messages read from the Gmail All Mail folder to the
+// destination according to the sync list's label mode.
+type gmailCopier struct {
+	job        *MigrateMailbox
+	dst        *client.Client
+	dstGmail   bool
+	dstAllMail string
+	dstFolders map[string]string
+
+	selected       string
+	permanentFlags map[string][]string
+}
+
+// selectFolder creates and selects a destination folder read-write, which
+// also tells its PERMANENTFLAGS.
+func (g *gmailCopier) selectFolder(name string) ([]string, error) {
+	permanentFlags, known := g.permanentFlags[name]
+	if g.selected == name {
+		return permanentFlags, nil
+	}
+
+	if !known {
+		if err := ensureFolder(g.dst, name); err != nil {
+			return nil, err
+		}
+	}
+
+	status, err := g.dst.Select(name, false)
+	if err != nil {
+		slog.Debug("Failed to select destination folder", "folder", name, "error", err)
+		return nil, err
+	}
+
+	g.selected = name
+	g.permanentFlags[name] = status.PermanentFlags
+
+	return status.PermanentFlags, nil
+}
+
+// folderFlags is selectFolder for folders that are only appended to, the
+// folder is selected once to learn its PERMANENTFLAGS.
+func (g *gmailCopier) folderFlags(name string) ([]string, error) {
+	if permanentFlags, ok := g.permanentFlags[name]; ok {
+		return permanentFlags, nil
+	}
+
+	return g.selectFolder(name)
+}
+
+// labelFolders maps labels to destination folders, each folder once.
+// Messages without a folder label were archived in Gmail.
+func (g *gmailCopier) labelFolders(labels []string) []string {
+	folders := make([]string, 0, len(labels))
+	seen := make(map[string]bool, len(labels))
+	add := func(name string) {
+		key := strings.ToLower(name)
+		if !seen[key] {
+			seen[key] = true
+			folders = append(folders, name)
+		}
+	}
+
+	for _, label := range labels {
+		switch strings.ToLower(label) {
+		case "\\inbox":
+			add("INBOX")
+		case "\\sent":
+			add(specialFolder(g.dstFolders, imap.SentAttr, gmailSentFolder))
+		case "\\draft":
+			add(specialFolder(g.dstFolders, imap.DraftsAttr, gmailDraftsFolder))
+		default:
+			// \Starred and \Important are carried by flags and keywords
+			if !strings.HasPrefix(label, "\\") {
+				add(label)
+			}
+		}
+	}
+
+	if len(folders) == 0 {
+		add(specialFolder(g.dstFolders, imap.ArchiveAttr, gmailArchiveFolder))
+	}
+
+	return folders
+}
+
+// primaryFolder is the single destination folder in keyword mode.
+func (g *gmailCopier) primaryFolder(labels []string) string {
+	switch {
+	case hasLabel(labels, "\\Inbox"):
+		return "INBOX"
+	case hasLabel(labels, "\\Sent"):
+		return specialFolder(g.dstFolders, imap.SentAttr, gmailSentFolder)
+	case hasLabel(labels, "\\Draft"):
+		return specialFolder(g.dstFolders, imap.DraftsAttr, gmailDraftsFolder)
+	default:
+		return specialFolder(g.dstFolders, imap.ArchiveAttr, gmailArchiveFolder)
+	}
+}
+
+func labelKeywords(labels []string) []string {
+	keywords := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if strings.EqualFold(label, "\\Important") {
+			keywords = append(keywords, "$Important")
+			continue
+		}
+		if !strings.HasPrefix(label, "\\") {
+			keywords = append(keywords, labelKeyword(label))
+		}
+	}
+
+	return keywords
+}
+
+// exists reports whether the destination folder already holds the message.
+func (g *gmailCopier) exists(folder string, messageId string) (bool, error) {
+	if !g.job.SyncList.CompareMessageIds || messageId == "" {
+		return false, nil
+	}
+
+	if _, err := g.selectFolder(folder); err != nil {
+		return false, err
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Set("Message-ID", messageId)
+	criteria.WithoutFlags = []string{imap.DeletedFlag}
+
+	existing, err := g.dst.Search(criteria)
+	if err != nil {
+		return false, err
+	}
+
+	return len(existing) > 0, nil
+}
+
+// copy writes one message and returns the uid of its first destination copy,
+// 0 when unknown.
+func (g *gmailCopier) copy(ctx context.Context, msg *imap.Message, labels []string, body []byte) (uint32, error) {
+	var date time.Time
+	if msg.Envelope != nil {
+		date = msg.Envelope.Date
+	}
+	messageId := normalizeMessageId(msg.Envelope)
+
+	if g.dstGmail {
+		return g.copyToGmail(ctx, msg, labels, body, date, messageId)
+	}
+
+	folders := []string{g.primaryFolder(labels)}
+	flags := msg.Flags
+	if g.job.SyncList.GmailLabelMode == models.GmailLabelModeFolders {
+		folders = g.labelFolders(labels)
+	} else {
+		flags = append(append([]string{}, msg.Flags...), labelKeywords(labels)...)
+	}
+
+	var firstUid uint32
+	for _, folder := range folders {
+		exists, err := g.exists(folder, messageId)
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			slog.Debug("Message-ID already exists in destination", "folder", folder, "messageID", messageId)
+			continue
+		}
+
+		permanentFlags, err := g.folderFlags(folder)
+		if err != nil {
+			return 0, err
+		}
+
+		dstUid, err := g.job.limiter.append(ctx, g.dst, g.job.SyncList.DstHost, folder, g.job.flags.apply(flags, permanentFlags), date, bytes.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		if firstUid == 0 {
+			firstUid = dstUid
+		}
+	}
+
+	return firstUid, nil
+}
+
+// copyToGmail appends to the destination All Mail folder and sets the labels
+// on the copy, which needs the uid from APPENDUID.
+func (g *gmailCopier) copyToGmail(ctx context.Context, msg *imap.Message, labels []string, body []byte, date time.Time, messageId string) (uint32, error) {
+	exists, err := g.exists(g.dstAllMail, messageId)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		slog.Debug("Message-ID already exists in destination", "folder", g.dstAllMail, "messageID", messageId)
+		return 0, nil
+	}
+
+	permanentFlags, err := g.selectFolder(g.dstAllMail)
+	if err != nil {
+		return 0, err
+	}
+
+	dstUid, err := g.job.limiter.append(ctx, g.dst, g.job.SyncList.DstHost, g.dstAllMail, g.job.flags.apply(msg.Flags, permanentFlags), date, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(labels) == 0 {
+		return dstUid, nil
+	}
+	if dstUid == 0 {
+		slog.Debug("Destination did not return APPENDUID, labels not set", "messageID", messageId)
+		return 0, nil
+	}
+
+	seqset := &imap.SeqSet{}
+	seqset.AddNum(dstUid)
+	err = g.dst.UidStore(seqset, imap.StoreItem("+X-GM-LABELS.SILENT"), flagsToInterface(labels), nil)
+	if err != nil {
+		slog.Debug("Failed to store labels", "messageID", messageId, "error", err)
+		return 0, err
+	}
+
+	return dstUid, nil
+}
+
+// runGmail reads every message once from All Mail instead of once per label
+// folder. X-GM-MSGID guards against a message being listed twice and the
+// message map against copying it again on later runs.
+func (j *MigrateMailbox) runGmail(ctx context.Context, srcClient *client.Client, dstClient *client.Client) error {
+	srcFolders, err := listSpecialFolders(srcClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "source", "error", err)
+		return err
+	}
+
+	allMail := specialFolder(srcFolders, imap.AllAttr, "")
+	if allMail == "" {
+		return errGmailAllMailMissing
+	}
+
+	dstFolders, err := listSpecialFolders(dstClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "destination", "error", err)
+		return err
+	}
+
+	copier := &gmailCopier{
+		job:            j,
+		dst:            dstClient,
+		dstGmail:       supportsGmail(dstClient),
+		dstFolders:     dstFolders,
+		permanentFlags: make(map[string][]string),
+	}
+	if copier.dstGmail {
+		copier.dstAllMail = specialFolder(dstFolders, imap.AllAttr, "")
+		if copier.dstAllMail == "" {
+			return errGmailAllMailMissing
+		}
+	}
+
+	srcFolder, err := srcClient.Select(allMail, true)
+	if err != nil {
+		slog.Debug("Failed to select source folder", "folder", allMail, "error", err)
+		return err
+	}
+
+	if j.Mailbox.FolderUidValidity[allMail] == 0 || j.Mailbox.FolderUidValidity[allMail] != srcFolder.UidValidity {
+		err = j.resetFolderState(ctx, allMail, srcFolder.UidValidity)
+		if err != nil {
+			return err
+		}
+	}
+
+	if srcFolder.Messages == 0 {
+		return nil
+	}
+
+	lastUid := uint32(0)
+	if j.SyncList.CompareLastUid {
+		lastUid = j.Mailbox.FolderLastUid[allMail]
+	}
+
+	seqset := &imap.SeqSet{}
+	seqset.AddRange(lastUid+1, 0)
+
+	srcMessages, err := fetchSeqSet(ctx, srcClient, seqset, true, []imap.FetchItem{imap.FetchUid, fetchGmailMsgId, fetchGmailLabels})
+	if err != nil {
+		slog.Debug("Failed to fetch labels", "folder", allMail, "error", err)
+		return err
+	}
+
+	srcUids := make([]uint32, 0, len(srcMessages))
+	for _, msg := range srcMessages {
+		srcUids = append(srcUids, msg.Uid)
+	}
+
+	copied, err := models.FindMessageMapsBySrcUids(ctx, j.Mailbox.Id, allMail, srcUids)
+	if err != nil {
+		return err
+	}
+
+	labelsByUid := make(map[uint32][]string, len(srcMessages))
+	seen := make(map[string]bool, len(srcMessages))
+	toCopy := &imap.SeqSet{}
+	for _, msg := range srcMessages {
+		// "n:*" always matches the last message, even below n
+		if msg.Uid <= lastUid {
+			continue
+		}
+		if _, ok := copied[msg.Uid]; ok {
+			continue
+		}
+
+		gmailId := gmailMessageId(msg)
+		if gmailId != "" {
+			if seen[gmailId] {
+				continue
+			}
+			seen[gmailId] = true
+		}
+
+		labelsByUid[msg.Uid] = gmailLabels(msg)
+		toCopy.AddNum(msg.Uid)
+	}
+
+	if toCopy.Empty() {
+		return nil
+	}
+
+	err = fetchEach(ctx, srcClient, toCopy, true, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822, imap.FetchUid}, func(msg *imap.Message) error {
+		literal := msg.GetBody(&imap.BodySectionName{})
+		if literal == nil {
+			return nil
+		}
+
+		// A message with several label folders is appended more than once
+		body, err := io.ReadAll(literal)
+		if err != nil {
+			return err
+		}
+
+		dstUid, err := copier.copy(ctx, msg, labelsByUid[msg.Uid], body)
+		if err != nil {
+			return err
+		}
+
+		if msg.Uid > j.Mailbox.FolderLastUid[allMail] {
+			j.Mailbox.FolderLastUid[allMail] = msg.Uid
+		}
+		j.Mailbox.LastRunMessages++
+
+		return j.recordMessageMap(ctx, allMail, msg.Uid, dstUid, normalizeMessageId(msg.Envelope))
+	})
+	if err != nil {
+		slog.Debug("Failed to copy messages", "folder", allMail, "error", err)
+		return err
+	}
+
+	return j.flushMessageMaps(ctx)
+}
@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"app/config"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+var ErrHostLimitTooLow = errors.New("host connection limit is lower than the connections a mailbox needs")
+
+// hostSlots bounds the connections open to each IMAP host across all workers
+// of the process. Hosts without a limit have no semaphore.
+var hostSlots = struct {
+	sync.Mutex
+	semaphores map[string]*semaphore.Weighted
+}{
+	semaphores: make(map[string]*semaphore.Weighted),
+}
+
+func hostConnectionLimit(host string) int {
+	limit, ok := config.Config.HostConnectionLimits[host]
+	if !ok {
+		limit = config.Config.HostConnectionLimit
+	}
+
+	return limit
+}
+
+// hostSemaphore returns nil when connections to host are not limited.
+func hostSemaphore(host string) *semaphore.Weighted {
+	limit := hostConnectionLimit(host)
+	if limit <= 0 {
+		return nil
+	}
+
+	hostSlots.Lock()
+	defer hostSlots.Unlock()
+
+	sem, ok := hostSlots.semaphores[host]
+	if !ok {
+		sem = semaphore.NewWeighted(int64(limit))
+		hostSlots.semaphores[host] = sem
+	}
+
+	return sem
+}
+
+// acquireHosts waits until one connection to each of hosts may be opened and
+// returns a release func per host, in the order given. Hosts are acquired in
+// sorted order, and a host listed twice all at once, so two callers never
+// hold part of what the other waits for.
+func acquireHosts(ctx context.Context, hosts ...string) ([]func(), error) {
+	hosts = slices.Clone(hosts)
+	counts := make(map[string]int64, len(hosts))
+	for i, host := range hosts {
+		hosts[i] = strings.ToLower(host)
+		counts[hosts[i]]++
+	}
+
+	sorted := make([]string, 0, len(counts))
+	for host := range counts {
+		sorted = append(sorted, host)
+	}
+	slices.Sort(sorted)
+
+	acquired := make([]string, 0, len(sorted))
+	releaseAcquired := func() {
+		for _, host := range acquired {
+			hostSemaphore(host).Release(counts[host])
+		}
+	}
+
+	for _, host := range sorted {
+		sem := hostSemaphore(host)
+		if sem == nil {
+			continue
+		}
+		if counts[host] > int64(hostConnectionLimit(host)) {
+			releaseAcquired()
+			return nil, ErrHostLimitTooLow
+		}
+
+		err := sem.Acquire(ctx, counts[host])
+		if err != nil {
+			releaseAcquired()
+			return nil, err
+		}
+		acquired = append(acquired, host)
+	}
+
+	releases := make([]func(), len(hosts))
+	for i, host := range hosts {
+		sem := hostSemaphore(host)
+		releases[i] = sync.OnceFunc(func() {
+			if sem != nil {
+				sem.Release(1)
+			}
+		})
+	}
+
+	return releases, nil
+}
@@ -0,0 +1,235 @@
+package jobs
+
+import (
+	"app/config"
+	"app/helpers"
+	"app/models"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+const imapDialTimeout = 15 * time.Second
+
+// dialImap connects with implicit TLS and falls back to STARTTLS.
+func dialImap(host string, port int) (*client.Client, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	c, err := client.DialTLS(addr, nil)
+	if err == nil && c != nil {
+		return c, nil
+	}
+	slog.Debug("Failed to connect (TLS)", "addr", addr, "error", err)
+
+	c, err = client.Dial(addr)
+	if err != nil {
+		slog.Debug("Failed to connect (no TLS)", "addr", addr, "error", err)
+		return nil, err
+	}
+
+	err = c.StartTLS(&tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: config.Config.Debug,
+	})
+	if err != nil {
+		slog.Debug("Failed to start TLS", "addr", addr, "error", err)
+		_ = c.Logout()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// dialLimited dials host once a connection slot is held, the slot is given
+// back when the connection closes.
+func dialLimited(host string, port int, release func()) (*client.Client, error) {
+	c, err := dialImap(host, port)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	go func() {
+		<-c.LoggedOut()
+		release()
+	}()
+
+	return c, nil
+}
+
+// connectMailbox waits for the host connection limits, dials the source and
+// destination servers in parallel and logs in to both accounts. The caller
+// must log out of both clients.
+func connectMailbox(ctx context.Context, list *models.SyncList, mailbox *models.Mailbox) (srcClient *client.Client, dstClient *client.Client, err error) {
+	if list.SrcProtocol == models.SourceProtocolPop3 {
+		return nil, nil, ErrImapSourceRequired
+	}
+
+	releases, err := acquireHosts(ctx, list.SrcHost, list.DstHost)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dialWg sync.WaitGroup
+	var src, dst *client.Client
+	var srcClientErr error
+	var dstClientErr error
+
+	dialWg.Add(2)
+	go func() {
+		defer dialWg.Done()
+		src, srcClientErr = dialLimited(list.SrcHost, list.SrcPort, releases[0])
+	}()
+	go func() {
+		defer dialWg.Done()
+		dst, dstClientErr = dialLimited(list.DstHost, list.DstPort, releases[1])
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		dialWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		srcClient, dstClient = src, dst
+	case <-time.After(imapDialTimeout):
+		// Late connections would hold their host slots
+		go func() {
+			<-done
+			if src != nil {
+				_ = src.Logout()
+			}
+			if dst != nil {
+				_ = dst.Logout()
+			}
+		}()
+		return nil, nil, errors.New("dial timeout")
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		if srcClient != nil {
+			_ = srcClient.Logout()
+		}
+		if dstClient != nil {
+			_ = dstClient.Logout()
+		}
+	}()
+
+	if srcClientErr != nil {
+		return srcClient, dstClient, srcClientErr
+	}
+	if dstClientErr != nil {
+		return srcClient, dstClient, dstClientErr
+	}
+	slog.Debug("Connected to source and destination servers")
+
+	decryptedSrcPassword, err := helpers.AesDecrypt(mailbox.SrcPasswordHash, config.Config.AppKey)
+	if err != nil {
+		slog.Debug("Failed to decrypt source password", "error", err)
+		return srcClient, dstClient, err
+	}
+
+	decryptedDstPassword, err := helpers.AesDecrypt(mailbox.DstPasswordHash, config.Config.AppKey)
+	if err != nil {
+		slog.Debug("Failed to decrypt destination password", "error", err)
+		return srcClient, dstClient, err
+	}
+
+	if err := srcClient.Login(mailbox.SrcUser, decryptedSrcPassword); err != nil {
+		slog.Debug("Failed to login to source account", "error", err)
+		return srcClient, dstClient, err
+	}
+
+	if err := dstClient.Login(mailbox.DstUser, decryptedDstPassword); err != nil {
+		slog.Debug("Failed to login to destination account", "error", err)
+		return srcClient, dstClient, err
+	}
+
+	return srcClient, dstClient, nil
+}
+
+// connectAccount waits for the connection limit of host, dials it and logs
+// in. The caller must log out of the client.
+func connectAccount(ctx context.Context, host string, port int, user string, passwordHash string) (c *client.Client, err error) {
+	releases, err := acquireHosts(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err = dialLimited(host, port, releases[0])
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = c.Logout()
+		}
+	}()
+
+	decryptedPassword, err := helpers.AesDecrypt(passwordHash, config.Config.AppKey)
+	if err != nil {
+		slog.Debug("Failed to decrypt password", "host", host, "error", err)
+		return c, err
+	}
+
+	err = c.Login(user, decryptedPassword)
+	if err != nil {
+		slog.Debug("Failed to login", "host", host, "error", err)
+		return c, err
+	}
+
+	return c, nil
+}
+
+// connectDestination is connectMailbox for jobs that only write to the
+// destination. The caller must log out of the client.
+func connectDestination(ctx context.Context, list *models.SyncList, mailbox *models.Mailbox) (*client.Client, error) {
+	return connectAccount(ctx, list.DstHost, list.DstPort, mailbox.DstUser, mailbox.DstPasswordHash)
+}
+
+// connectSource is connectMailbox for jobs that only read the source.
+func connectSource(ctx context.Context, list *models.SyncList, mailbox *models.Mailbox) (*client.Client, error) {
+	if list.SrcProtocol == models.SourceProtocolPop3 {
+		return nil, ErrImapSourceRequired
+	}
+
+	return connectAccount(ctx, list.SrcHost, list.SrcPort, mailbox.SrcUser, mailbox.SrcPasswordHash)
+}
+
+// folderDelimiter returns the hierarchy delimiter of the server, "/" when
+// its namespace is flat.
+func folderDelimiter(c *client.Client) (string, error) {
+	mailboxes := make(chan *imap.MailboxInfo)
+	listDone := make(chan error, 1)
+	go func() {
+		listDone <- c.List("", "", mailboxes)
+	}()
+
+	delimiter := ""
+	for mbox := range mailboxes {
+		delimiter = mbox.Delimiter
+	}
+
+	if err := <-listDone; err != nil {
+		return "", err
+	}
+	if delimiter == "" {
+		delimiter = "/"
+	}
+
+	return delimiter, nil
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+func ensureFolder(c *client.Client, folderName string) error {
+	err := c.Create(folderName)
+	if err != nil {
+		if !strings.Contains(strings.ToUpper(err.Error()), "ALREADYEXISTS") && !strings.Contains(strings.ToUpper(err.Error()), "ALREADY EXISTS") {
+			slog.Debug("Failed to create destination folder", "folder", folderName, "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchAll fetches items for every message of the selected folder, which
+// holds count messages.
+func fetchAll(ctx context.Context, c *client.Client, count uint32, items []imap.FetchItem) ([]*imap.Message, error) {
+	if count == 0 {
+		return []*imap.Message{}, nil
+	}
+
+	seqset := &imap.SeqSet{}
+	seqset.AddRange(1, 0)
+
+	return fetchSeqSet(ctx, c, seqset, false, items)
+}
+
+func fetchSeqSet(ctx context.Context, c *client.Client, seqset *imap.SeqSet, uid bool, items []imap.FetchItem) ([]*imap.Message, error) {
+	result := make([]*imap.Message, 0)
+
+	err := fetchEach(ctx, c, seqset, uid, items, func(msg *imap.Message) error {
+		result = append(result, msg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// fetchEach streams fetched messages to fn. Once fn fails or ctx is done the
+// remaining responses are drained so the fetch command can complete.
+func fetchEach(ctx context.Context, c *client.Client, seqset *imap.SeqSet, uid bool, items []imap.FetchItem, fn func(msg *imap.Message) error) error {
+	messages := make(chan *imap.Message, 16)
+	fetchDone := make(chan error, 1)
+	go func() {
+		if uid {
+			fetchDone <- c.UidFetch(seqset, items, messages)
+		} else {
+			fetchDone <- c.Fetch(seqset, items, messages)
+		}
+	}()
+
+	var fnErr error
+	for msg := range messages {
+		if fnErr != nil {
+			continue
+		}
+		if fnErr = ctx.Err(); fnErr != nil {
+			continue
+		}
+		fnErr = fn(msg)
+	}
+
+	err := <-fetchDone
+	if fnErr != nil {
+		return fnErr
+	}
+
+	return err
+}
+
+func normalizeMessageId(envelope *imap.Envelope) string {
+	if envelope == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(envelope.MessageId)
+}
+
+// syncableFlags drops \Recent, which only the server may set.
+func syncableFlags(flags []string) []string {
+	result := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		if strings.EqualFold(flag, imap.RecentFlag) {
+			continue
+		}
+		result = append(result, flag)
+	}
+
+	return result
+}
+
+func sameFlags(a []string, b []string) bool {
+	a, b = syncableFlags(a), syncableFlags(b)
+	if len(a) != len(b) {
+		return false
+	}
+
+	seen := make(map[string]int, len(a))
+	for _, flag := range a {
+		seen[strings.ToLower(flag)]++
+	}
+	for _, flag := range b {
+		seen[strings.ToLower(flag)]--
+		if seen[strings.ToLower(flag)] < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+
+	return false
+}
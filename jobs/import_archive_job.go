@@ -0,0 +1,213 @@
+package jobs
+
+import (
+	"app/models"
+	"app/worker"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/mail"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var ImportArchiveType models.JobType = "import_archive"
+
+// Import jobs relate to their archive, the mailbox row is kept for its
+// migration job.
+const ArchiveRelatedTable = "archives"
+
+// ImportArchive appends the messages of an mbox or Maildir archive to the
+// destination of a mailbox, one archive folder into the destination folder
+// of the same name.
+type ImportArchive struct {
+	Archive  *models.Archive
+	SyncList *models.SyncList
+	Mailbox  *models.Mailbox
+
+	flags    flagPolicy
+	limiter  *transferLimiter
+	imported int
+}
+
+type ImportArchivePayload struct {
+	ArchiveId int `json:"archiveId"`
+}
+
+func ImportArchiveFactory(ctx context.Context, payload *json.RawMessage) (worker.JobHandler, error) {
+	importPayload := new(ImportArchivePayload)
+
+	err := json.Unmarshal(*payload, importPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := models.FindArchiveById(ctx, importPayload.ArchiveId)
+	if err != nil {
+		return nil, err
+	}
+
+	mailbox, err := models.FindMailboxById(ctx, archive.MailboxId)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := models.FindSyncListById(ctx, mailbox.SyncListId)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &ImportArchive{
+		Archive:  archive,
+		SyncList: list,
+		Mailbox:  mailbox,
+	}
+
+	return handler, nil
+}
+
+// Run imports every folder of the archive. Failures carry their ErrorClass.
+func (j *ImportArchive) Run(ctx context.Context) error {
+	return classifyError(j.run(ctx))
+}
+
+func (j *ImportArchive) run(ctx context.Context) error {
+	source, err := openArchive(ArchivePath(j.Archive.Path))
+	if err != nil {
+		slog.Debug("Failed to open archive", "path", j.Archive.Path, "error", err)
+		return err
+	}
+	defer source.close()
+
+	folders, err := source.folders(j.Archive.Format)
+	if err != nil {
+		slog.Debug("Failed to read archive folders", "path", j.Archive.Path, "error", err)
+		return err
+	}
+
+	dstClient, err := connectDestination(ctx, j.SyncList, j.Mailbox)
+	if err != nil {
+		return err
+	}
+	defer dstClient.Logout()
+
+	j.flags = newFlagPolicy(j.SyncList)
+	j.limiter = newDestinationLimiter(j.SyncList)
+
+	_, err = checkDestinationQuota(dstClient)
+	if err != nil {
+		return err
+	}
+
+	delimiter, err := folderDelimiter(dstClient)
+	if err != nil {
+		slog.Debug("Failed to read folder delimiter", "connection", "destination", "error", err)
+		return err
+	}
+
+	for _, folder := range folders {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := j.importFolder(ctx, dstClient, folder, archiveFolderName(folder.name, delimiter))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importFolder appends the messages of one archive folder. With
+// CompareMessageIds, messages already in the destination folder are skipped,
+// so an interrupted import can be started again.
+func (j *ImportArchive) importFolder(ctx context.Context, dstClient *client.Client, folder archiveFolder, folderName string) error {
+	if folderName != "INBOX" {
+		err := ensureFolder(dstClient, folderName)
+		if err != nil {
+			return err
+		}
+	}
+
+	dstFolder, err := dstClient.Select(folderName, false)
+	if err != nil {
+		slog.Debug("Failed to select destination folder", "folder", folderName, "error", err)
+		return err
+	}
+
+	var messageIds *messageIdIndex
+	if j.SyncList.CompareMessageIds {
+		messageIds = newMessageIdIndex(dstClient)
+	}
+	var contents *contentIndex
+	if j.SyncList.ContentDedup != models.ContentDedupOff {
+		contents = newContentIndex(dstClient, j.SyncList.ContentDedup)
+	}
+
+	return folder.each(func(archived *archiveMessage) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var envelope *imap.Envelope
+		if parsed, err := mail.ReadMessage(bytes.NewReader(archived.body)); err == nil {
+			envelope = headerEnvelope(parsed.Header)
+		} else {
+			envelope = &imap.Envelope{}
+		}
+		messageId := normalizeMessageId(envelope)
+
+		msg := &imap.Message{
+			Envelope: envelope,
+			Size:     uint32(len(archived.body)),
+			Body: map[*imap.BodySectionName]imap.Literal{
+				{}: bytes.NewReader(archived.body),
+			},
+		}
+
+		duplicate := false
+		var err error
+		if contents != nil && messageId == "" {
+			duplicate, err = contents.contains(ctx, msg)
+		} else if messageIds != nil {
+			duplicate, err = messageIds.contains(ctx, messageId)
+		}
+		if err != nil {
+			slog.Debug("Failed to index destination folder", "folder", folderName, "error", err)
+			return err
+		}
+
+		if duplicate {
+			slog.Debug("Message already exists in destination", "folder", folderName, "messageId", messageId)
+			return nil
+		}
+
+		date := archived.date
+		if date.IsZero() {
+			date = envelope.Date
+		}
+
+		_, err = j.limiter.append(ctx, dstClient, j.SyncList.DstHost, folderName, j.flags.apply(archived.flags, dstFolder.PermanentFlags), date, bytes.NewReader(archived.body))
+		if err != nil {
+			return err
+		}
+
+		j.imported++
+		if messageIds != nil {
+			messageIds.add(messageId)
+		}
+
+		return nil
+	})
+}
+
+// OnStop records how many messages were imported, also when the import was
+// stopped part way.
+func (j *ImportArchive) OnStop(ctx context.Context) error {
+	j.Archive.Messages = j.imported
+
+	return models.UpdateArchive(ctx, j.Archive)
+}
@@ -0,0 +1,421 @@
+package jobs
+
+import (
+	"app/errorsx"
+	"app/models"
+	"app/worker"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var LiveSyncType models.JobType = "live_sync"
+
+// Live sync jobs relate to the sync list, one job row per list is reused.
+const LiveSyncRelatedTable = SyncListRelatedTable
+
+var ErrLiveSyncActive = errors.New("live sync is running or pending")
+
+const (
+	liveSyncMinBackoff   = 30 * time.Second
+	liveSyncMaxBackoff   = 5 * time.Minute
+	liveSyncPollInterval = 15 * time.Second
+	liveSyncKeepAlive    = 10 * time.Minute
+)
+
+type LiveSync struct {
+	SyncList *models.SyncList
+	Folders  []string
+
+	// Guards the folder state of the mailboxes, shared by the folder watchers
+	mu sync.Mutex
+}
+
+type LiveSyncPayload struct {
+	SyncListId int      `json:"syncListId"`
+	Folders    []string `json:"folders"`
+}
+
+func LiveSyncFactory(ctx context.Context, payload *json.RawMessage) (worker.JobHandler, error) {
+	liveSyncPayload := new(LiveSyncPayload)
+
+	err := json.Unmarshal(*payload, liveSyncPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, liveSyncPayload.SyncListId)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &LiveSync{
+		SyncList: list,
+		Folders:  LiveSyncFolders(liveSyncPayload.Folders),
+	}
+
+	return handler, nil
+}
+
+// LiveSyncFolders trims and dedupes folder names, INBOX is always watched.
+func LiveSyncFolders(folders []string) []string {
+	result := []string{"INBOX"}
+	seen := map[string]bool{"INBOX": true}
+
+	for _, folder := range folders {
+		folder = strings.TrimSpace(folder)
+		if strings.EqualFold(folder, "INBOX") {
+			folder = "INBOX"
+		}
+		if folder == "" || seen[folder] {
+			continue
+		}
+
+		seen[folder] = true
+		result = append(result, folder)
+	}
+
+	return result
+}
+
+// IsLiveSyncActive reports whether the live sync job of the list is running
+// or pending.
+func IsLiveSyncActive(ctx context.Context, syncListId int) (bool, error) {
+	job, err := models.FindJobByRelatedAndType(ctx, LiveSyncRelatedTable, syncListId, LiveSyncType)
+	if err != nil {
+		if errorsx.IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return job.Status == models.JobStatusRunning || job.Status == models.JobStatusPending, nil
+}
+
+// Run watches every folder of every mailbox on its own connection pair until
+// the job is cancelled. The job fails when a folder can't be opened at
+// start, connections that drop later are re-established with backoff.
+func (j *LiveSync) Run(ctx context.Context) error {
+	if j.SyncList.IsCutOver() {
+		return ErrSyncListCutOver
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	for _, mailbox := range j.SyncList.Mailboxes {
+		for _, folder := range j.Folders {
+			wg.Go(func() {
+				err := j.watchFolder(ctx, mailbox, folder)
+				if err != nil && !errors.Is(err, context.Canceled) {
+					cancel(err)
+				}
+			})
+		}
+	}
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+func (j *LiveSync) OnStop(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, mailbox := range j.SyncList.Mailboxes {
+		err := models.UpdateMailboxFolderState(ctx, mailbox)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *LiveSync) watchFolder(ctx context.Context, mailbox *models.Mailbox, folder string) error {
+	connected := false
+	backoff := liveSyncMinBackoff
+
+	for {
+		w, err := j.newFolderWatcher(ctx, mailbox, folder)
+		if err != nil && !connected {
+			return err
+		}
+
+		if err == nil {
+			connected = true
+			err = w.run(ctx)
+			w.close()
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if w.caughtUp {
+				backoff = liveSyncMinBackoff
+			}
+		}
+
+		slog.Warn("live sync: folder watcher stopped, reconnecting", "mailbox", mailbox.Id, "folder", folder, "in", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, liveSyncMaxBackoff)
+	}
+}
+
+// lastUid returns the last copied uid of the folder, resetting it when the
+// source folder was recreated.
+func (j *LiveSync) lastUid(ctx context.Context, mailbox *models.Mailbox, folder string, uidValidity uint32) (uint32, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if mailbox.FolderUidValidity[folder] != uidValidity {
+		mailbox.FolderUidValidity[folder] = uidValidity
+		mailbox.FolderLastUid[folder] = 0
+		delete(mailbox.FolderHighestModSeq, folder)
+
+		err := models.DeleteMessageMapsByFolder(ctx, mailbox.Id, folder)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return mailbox.FolderLastUid[folder], nil
+}
+
+func (j *LiveSync) advance(ctx context.Context, mailbox *models.Mailbox, folder string, uid uint32) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if uid <= mailbox.FolderLastUid[folder] {
+		return nil
+	}
+
+	mailbox.FolderLastUid[folder] = uid
+	return models.UpdateMailboxFolderState(ctx, mailbox)
+}
+
+// folderWatcher holds the connections of one source folder. The source
+// client idles on the folder, the destination client appends to it.
+type folderWatcher struct {
+	job         *LiveSync
+	mailbox     *models.Mailbox
+	folder      string
+	uidValidity uint32
+
+	src     *client.Client
+	dst     *client.Client
+	updates chan client.Update
+	flags   flagPolicy
+	// PERMANENTFLAGS of the destination folder
+	permanentFlags []string
+	newMail        chan struct{}
+	done           chan struct{}
+
+	caughtUp bool
+}
+
+func (j *LiveSync) newFolderWatcher(ctx context.Context, mailbox *models.Mailbox, folder string) (*folderWatcher, error) {
+	srcClient, dstClient, err := connectMailbox(ctx, j.SyncList, mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &folderWatcher{
+		job:     j,
+		mailbox: mailbox,
+		folder:  folder,
+		flags:   newFlagPolicy(j.SyncList),
+		src:     srcClient,
+		dst:     dstClient,
+		updates: make(chan client.Update, 16),
+		newMail: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	// The client blocks on unread updates, so they are drained right away
+	w.src.Updates = w.updates
+	go w.watchUpdates()
+
+	status, err := w.src.Select(folder, true)
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+	w.uidValidity = status.UidValidity
+
+	err = ensureFolder(w.dst, folder)
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+
+	dstStatus, err := w.dst.Select(folder, false)
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+	w.permanentFlags = dstStatus.PermanentFlags
+
+	return w, nil
+}
+
+func (w *folderWatcher) watchUpdates() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case update := <-w.updates:
+			if _, ok := update.(*client.MailboxUpdate); !ok {
+				continue
+			}
+
+			select {
+			case w.newMail <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (w *folderWatcher) close() {
+	_ = w.src.Logout()
+	_ = w.dst.Logout()
+	close(w.done)
+}
+
+func (w *folderWatcher) run(ctx context.Context) error {
+	for {
+		err := w.catchUp(ctx)
+		if err != nil {
+			return err
+		}
+		w.caughtUp = true
+
+		err = w.idle(ctx)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// catchUp copies every message above the last copied uid.
+func (w *folderWatcher) catchUp(ctx context.Context) error {
+	lastUid, err := w.job.lastUid(ctx, w.mailbox, w.folder, w.uidValidity)
+	if err != nil {
+		return err
+	}
+
+	seqset := &imap.SeqSet{}
+	seqset.AddRange(lastUid+1, 0)
+
+	return fetchEach(ctx, w.src, seqset, true, []imap.FetchItem{
+		imap.FetchEnvelope,
+		imap.FetchFlags,
+		imap.FetchRFC822,
+		imap.FetchUid,
+	}, func(msg *imap.Message) error {
+		// "n:*" always matches the last message, even below n
+		if msg.Uid <= lastUid {
+			return nil
+		}
+
+		messageId := normalizeMessageId(msg.Envelope)
+		if w.job.SyncList.CompareMessageIds && messageId != "" {
+			criteria := imap.NewSearchCriteria()
+			criteria.Header.Set("Message-ID", messageId)
+			criteria.WithoutFlags = []string{imap.DeletedFlag}
+
+			existing, err := w.dst.Search(criteria)
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				slog.Debug("live sync: Message-ID already exists in destination", "messageID", messageId)
+				return w.job.advance(ctx, w.mailbox, w.folder, msg.Uid)
+			}
+		}
+
+		literal := msg.GetBody(&imap.BodySectionName{})
+		if literal == nil {
+			return nil
+		}
+
+		var date time.Time
+		if msg.Envelope != nil {
+			date = msg.Envelope.Date
+		}
+
+		dstUid, err := appendMessage(w.dst, w.folder, w.flags.apply(msg.Flags, w.permanentFlags), date, literal)
+		if err != nil {
+			return err
+		}
+
+		messageMap := &models.MessageMap{
+			MailboxId: w.mailbox.Id,
+			Folder:    w.folder,
+			SrcUid:    msg.Uid,
+		}
+		if dstUid != 0 {
+			messageMap.DstUid = &dstUid
+		}
+		if messageId != "" {
+			messageMap.MessageId = &messageId
+		}
+
+		err = models.UpsertMessageMaps(ctx, []*models.MessageMap{messageMap})
+		if err != nil {
+			return err
+		}
+
+		slog.Debug("live sync: copied message", "mailbox", w.mailbox.Id, "folder", w.folder, "uid", msg.Uid)
+		return w.job.advance(ctx, w.mailbox, w.folder, msg.Uid)
+	})
+}
+
+// idle waits on the source folder until the server reports a change. Servers
+// without IDLE are polled. The idle destination connection is kept alive.
+func (w *folderWatcher) idle(ctx context.Context) error {
+	stop := make(chan struct{})
+	idleDone := make(chan error, 1)
+	go func() {
+		idleDone <- w.src.Idle(stop, &client.IdleOptions{
+			PollInterval: liveSyncPollInterval,
+		})
+	}()
+
+	keepAlive := time.NewTicker(liveSyncKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(stop)
+			<-idleDone
+			return ctx.Err()
+		case <-w.newMail:
+			close(stop)
+			return <-idleDone
+		case <-keepAlive.C:
+			err := w.dst.Noop()
+			if err != nil {
+				close(stop)
+				<-idleDone
+				return err
+			}
+		case err := <-idleDone:
+			return err
+		}
+	}
+}
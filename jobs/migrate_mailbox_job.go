@@ -1,19 +1,11 @@
 package jobs
 
 import (
-	"app/config"
-	"app/helpers"
 	"app/models"
 	"app/worker"
 	"context"
-	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"log/slog"
-	"net"
-	"strconv"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/emersion/go-imap"
@@ -25,8 +17,29 @@ var MigrateMailboxType models.JobType = "migrate_account"
 type MigrateMailbox struct {
 	SyncList *models.SyncList
 	Mailbox  *models.Mailbox
+
+	// Only set for final sync and mirror runs
+	report     *models.MailboxReportData
+	reportType models.ReportType
+	runErr     error
+
+	tracking    changeTracking
+	flags       flagPolicy
+	limiter     *transferLimiter
+	messageMaps []*models.MessageMap
+	// Highest source uid copied per folder in this run, a resumed run
+	// starts after it
+	copiedUids map[string]uint32
+	// POP3 messages copied in this run, by UIDL
+	copiedUidls map[string]bool
+	// Set once the source size was compared with the destination quota,
+	// resumed runs don't check again
+	sizeChecked bool
 }
 
+// Message maps are written in batches while copying
+const messageMapBatchSize = 100
+
 type MigrateMailboxPayload struct {
 	SyncListId int `json:"syncListId"`
 	MailboxId  int `json:"mailboxId"`
@@ -58,254 +71,321 @@ func MigrateMailboxFactory(ctx context.Context, payload *json.RawMessage) (worke
 	return handler, nil
 }
 
-func (j *MigrateMailbox) Run(ctx context.Context) (err error) {
+// Run migrates the mailbox. A run stopped by a throttling response backs off
+// and resumes, messages it already copied are skipped. Failures carry their
+// ErrorClass.
+func (j *MigrateMailbox) Run(ctx context.Context) error {
 	slog.Debug("Starting migration")
 
-	srcAddr := net.JoinHostPort(j.SyncList.SrcHost, strconv.Itoa(j.SyncList.SrcPort))
-	dstAddr := net.JoinHostPort(j.SyncList.DstHost, strconv.Itoa(j.SyncList.DstPort))
+	j.Mailbox.LastRunMessages = 0
+	j.copiedUids = make(map[string]uint32)
+	j.copiedUidls = make(map[string]bool)
+
+	for attempt := 1; ; attempt++ {
+		err := j.run(ctx)
+		if !isThrottled(err) || attempt > throttleRetries {
+			return classifyError(err)
+		}
 
-	var srcClient *client.Client
-	var dstClient *client.Client
-	var dialWg sync.WaitGroup
-	var srcClientErr error
-	var dstClientErr error
+		slog.Debug("Run throttled, resuming", "attempt", attempt, "error", err)
+		syncListRateLimit(j.SyncList).slowDown()
 
-	dialWg.Add(2)
-	go func() {
-		defer dialWg.Done()
-		srcClient, srcClientErr = client.DialTLS(srcAddr, nil)
-		if srcClient == nil && srcClientErr == nil {
-			srcClientErr = errors.New("source client is nil")
+		select {
+		case <-time.After(time.Duration(attempt) * throttleBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-	}()
-	go func() {
-		defer dialWg.Done()
-		dstClient, dstClientErr = client.DialTLS(dstAddr, nil)
-		if dstClient == nil && dstClientErr == nil {
-			dstClientErr = errors.New("destination client is nil")
+	}
+}
+
+func (j *MigrateMailbox) run(ctx context.Context) (err error) {
+	if j.SyncList.SrcProtocol == models.SourceProtocolPop3 {
+		return j.runPop3(ctx)
+	}
+
+	srcClient, dstClient, err := connectMailbox(ctx, j.SyncList, j.Mailbox)
+	if err != nil {
+		return err
+	}
+	defer srcClient.Logout()
+	defer dstClient.Logout()
+
+	j.tracking = detectChangeTracking(srcClient, dstClient)
+	j.flags = newFlagPolicy(j.SyncList)
+	j.limiter = newTransferLimiter(j.SyncList)
+
+	quota, err := checkDestinationQuota(dstClient)
+	if err != nil {
+		return err
+	}
+
+	if j.SyncList.GmailLabelMode != models.GmailLabelModeOff {
+		if supportsGmail(srcClient) {
+			return j.runGmail(ctx, srcClient, dstClient)
 		}
-	}()
+		slog.Debug("Source does not support X-GM-EXT-1, migrating folders")
+	}
 
-	done := make(chan struct{})
+	foldersChan := make(chan *imap.MailboxInfo)
+	listFoldersDone := make(chan error, 1)
 	go func() {
-		dialWg.Wait()
-		close(done)
+		listFoldersDone <- srcClient.List("", "*", foldersChan)
 	}()
 
-	select {
-	case <-done:
-		if srcClientErr != nil {
-			slog.Debug("Failed to connect to source server (TLS)", "error", srcClientErr)
-			srcClient, err = client.Dial(srcAddr)
-			if err != nil {
-				slog.Debug("Failed to connect to source server (no TLS)", "error", err)
-				return err
-			}
+	folderNames := []string{}
+	for mbox := range foldersChan {
+		folderNames = append(folderNames, mbox.Name)
+	}
 
-			err = srcClient.StartTLS(&tls.Config{
-				InsecureSkipVerify: config.Config.Debug,
-			})
-			if err != nil {
-				slog.Debug("Failed to start source TLS", "error", err)
-				return err
-			}
+	err = <-listFoldersDone
+	if err != nil {
+		slog.Debug("Failed to list folders", "error", err)
+		return err
+	}
 
-			slog.Debug("Connected to source server")
+	if quota != nil && !j.sizeChecked {
+		err = j.checkSourceSize(ctx, srcClient, folderNames, quota)
+		if err != nil {
+			return err
 		}
+		j.sizeChecked = true
+	}
 
-		if dstClientErr != nil {
-			slog.Debug("Failed to connect to destination server (TLS)", "error", dstClientErr)
-			dstClient, err = client.Dial(dstAddr)
-			if err != nil {
-				slog.Debug("Failed to connect to destination server (no TLS)", "error", err)
-				return err
+	if j.SyncList.IsFinalSync() {
+		return j.runFinalSync(ctx, srcClient, dstClient, folderNames)
+	}
+
+	if j.SyncList.ParallelFolders > 1 {
+		err = j.migrateFoldersParallel(ctx, srcClient, dstClient, folderNames)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, folderName := range folderNames {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
 			}
 
-			err = dstClient.StartTLS(&tls.Config{
-				InsecureSkipVerify: config.Config.Debug,
-			})
+			err = j.migrateFolder(ctx, srcClient, dstClient, folderName)
 			if err != nil {
-				slog.Debug("Failed to start destination TLS", "error", err)
 				return err
 			}
-
-			slog.Debug("Connected to destination server")
 		}
+	}
 
-		if srcClient != nil {
-			defer srcClient.Logout()
-		}
-		if dstClient != nil {
-			defer dstClient.Logout()
-		}
+	if j.SyncList.TwoWay {
+		return j.syncReverse(ctx, srcClient, dstClient)
+	}
 
-	case <-time.After(15 * time.Second):
-		return errors.New("dial timeout")
+	if j.SyncList.Mirror {
+		return j.runMirror(ctx, srcClient, dstClient, folderNames)
 	}
 
-	decryptedSrcPassword, err := helpers.AesDecrypt(j.Mailbox.SrcPasswordHash, config.Config.AppKey)
-	if err != nil {
-		slog.Debug("Failed to decrypt source password", "error", err)
-		return err
+	return nil
+}
+
+// migrateFolder copies the new messages of one source folder, syncing flag
+// changes first when the sync list asks for it.
+func (j *MigrateMailbox) migrateFolder(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderName string) error {
+	var err error
+
+	// Read before selecting so changes made during the run are seen next time
+	var modSeq uint64
+	if j.tracking.condStore {
+		modSeq, err = highestModSeq(srcClient, folderName)
+		if err != nil {
+			slog.Debug("Failed to read HIGHESTMODSEQ", "folder", folderName, "error", err)
+			modSeq = 0
+		}
 	}
 
-	decryptedDstPassword, err := helpers.AesDecrypt(j.Mailbox.DstPasswordHash, config.Config.AppKey)
+	srcFolder, err := srcClient.Select(folderName, true)
 	if err != nil {
-		slog.Debug("Failed to decrypt destination password", "error", err)
+		slog.Debug("Failed to select source folder", "folder", folderName, "error", err)
 		return err
 	}
 
-	if err := srcClient.Login(j.Mailbox.SrcUser, decryptedSrcPassword); err != nil {
-		slog.Debug("Failed to login to source account", "error", err)
-		return err
+	if j.Mailbox.FolderUidValidity[folderName] == 0 || j.Mailbox.FolderUidValidity[folderName] != srcFolder.UidValidity {
+		err = j.resetFolderState(ctx, folderName, srcFolder.UidValidity)
+		if err != nil {
+			return err
+		}
+	}
+
+	// With a stored modseq CONDSTORE reports the changes, otherwise the
+	// flags of every known message are compared
+	changesTracked := false
+	if modSeq > 0 {
+		lastModSeq := j.Mailbox.FolderHighestModSeq[folderName]
+		changesTracked = j.SyncList.CompareLastUid && lastModSeq > 0
+		if changesTracked && modSeq > lastModSeq {
+			err = j.syncFolderChanges(ctx, srcClient, dstClient, folderName, lastModSeq)
+			if err != nil {
+				slog.Debug("Failed to sync changes", "folder", folderName, "error", err)
+				return err
+			}
+		}
+		j.Mailbox.FolderHighestModSeq[folderName] = modSeq
 	}
 
-	if err := dstClient.Login(j.Mailbox.DstUser, decryptedDstPassword); err != nil {
-		slog.Debug("Failed to login to destination account", "error", err)
+	if j.SyncList.SyncFlags && !changesTracked {
+		err = j.syncFolderFlags(ctx, srcClient, dstClient, folderName)
+		if err != nil {
+			slog.Debug("Failed to sync flags", "folder", folderName, "error", err)
+			return err
+		}
+	}
+
+	criteria := imap.NewSearchCriteria()
+	if j.SyncList.CompareLastUid {
+		criteria.Uid = &imap.SeqSet{}
+		criteria.Uid.AddRange(j.Mailbox.FolderLastUid[folderName]+1, 4294967295)
+	}
+
+	uids, err := srcClient.Search(criteria)
+	if err != nil {
+		slog.Debug("Failed to search for messages", "connection", "source", "folder", folderName, "error", err)
 		return err
 	}
 
-	foldersChan := make(chan *imap.MailboxInfo)
-	listFoldersDone := make(chan error, 1)
-	go func() {
-		listFoldersDone <- srcClient.List("", "*", foldersChan)
-	}()
+	if len(uids) == 0 {
+		return nil
+	}
 
-	folderNames := []string{}
-	for mbox := range foldersChan {
-		folderNames = append(folderNames, mbox.Name)
+	if err := ensureFolder(dstClient, folderName); err != nil {
+		return err
 	}
 
-	err = <-listFoldersDone
+	// EXAMINE reports no PERMANENTFLAGS, so the folder is selected read-write
+	dstFolder, err := dstClient.Select(folderName, false)
 	if err != nil {
-		slog.Debug("Failed to list folders", "error", err)
+		slog.Debug("Failed to select destination folder", "folder", folderName, "error", err)
 		return err
 	}
+	permanentFlags := dstFolder.PermanentFlags
 
-	for _, folderName := range folderNames {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+	// Both are read from the destination folder once, on first use
+	var messageIds *messageIdIndex
+	if j.SyncList.CompareMessageIds {
+		messageIds = newMessageIdIndex(dstClient)
+	}
+	var contents *contentIndex
+	if j.SyncList.ContentDedup != models.ContentDedupOff {
+		contents = newContentIndex(dstClient, j.SyncList.ContentDedup)
+	}
 
-		srcFolder, err := srcClient.Select(folderName, true)
+	// Messages the reverse pass copied from the destination are in the
+	// ledger and must not be copied back
+	var ledger map[uint32]bool
+	if j.SyncList.TwoWay {
+		ledger, err = j.ledgerSrcUids(ctx, folderName)
 		if err != nil {
-			slog.Debug("Failed to select source folder", "folder", folderName, "error", err)
 			return err
 		}
+	}
 
-		if j.Mailbox.FolderUidValidity[folderName] == 0 || j.Mailbox.FolderUidValidity[folderName] != srcFolder.UidValidity {
-			j.Mailbox.FolderUidValidity[folderName] = srcFolder.UidValidity
-			j.Mailbox.FolderLastUid[folderName] = 0
-		}
+	seqset := &imap.SeqSet{}
+	seqset.AddNum(uids...)
+
+	messages := make(chan *imap.Message)
+	fetchMessagesDone := make(chan error, 1)
+	go func() {
+		fetchMessagesDone <- srcClient.Fetch(seqset, []imap.FetchItem{
+			imap.FetchEnvelope,
+			imap.FetchFlags,
+			imap.FetchRFC822,
+			imap.FetchRFC822Size,
+			imap.FetchUid,
+		}, messages)
+	}()
 
-		criteria := imap.NewSearchCriteria()
-		if j.SyncList.CompareLastUid {
-			criteria.Uid = &imap.SeqSet{}
-			criteria.Uid.AddRange(j.Mailbox.FolderLastUid[folderName]+1, 4294967295)
+	for msg := range messages {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
 		}
 
-		uids, err := srcClient.Search(criteria)
-		if err != nil {
-			slog.Debug("Failed to search for messages", "connection", "source", "folder", folderName, "error", err)
-			return err
+		if j.SyncList.CompareLastUid && msg.Uid <= j.Mailbox.FolderLastUid[folderName] {
+			slog.Debug("Message Uid is less than or equal to last UID", "messageID", msg.Envelope.MessageId)
+			continue
 		}
 
-		if len(uids) == 0 {
+		if msg.Uid <= j.copiedUids[folderName] {
 			continue
 		}
 
-		if err := dstClient.Create(folderName); err != nil {
-			if !strings.Contains(strings.ToUpper(err.Error()), "ALREADYEXISTS") && !strings.Contains(strings.ToUpper(err.Error()), "ALREADY EXISTS") {
-				slog.Debug("Failed to create destination folder", "folder", folderName, "error", err)
-				return err
+		if ledger[msg.Uid] {
+			if msg.Uid > j.Mailbox.FolderLastUid[folderName] {
+				j.Mailbox.FolderLastUid[folderName] = msg.Uid
 			}
+			continue
 		}
 
-		seqset := &imap.SeqSet{}
-		seqset.AddNum(uids...)
-
-		messages := make(chan *imap.Message)
-		fetchMessagesDone := make(chan error, 1)
-		go func() {
-			fetchMessagesDone <- srcClient.Fetch(seqset, []imap.FetchItem{
-				imap.FetchEnvelope,
-				imap.FetchFlags,
-				imap.FetchRFC822,
-				imap.FetchUid,
-			}, messages)
-		}()
-
-		for msg := range messages {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
+		// A Message-ID search can't match a message without one
+		if contents != nil && normalizeMessageId(msg.Envelope) == "" {
+			duplicate, err := contents.contains(ctx, msg)
+			if err != nil {
+				slog.Debug("Failed to index destination folder", "folder", folderName, "error", err)
+				return err
 			}
 
-			if j.SyncList.CompareLastUid && msg.Uid <= j.Mailbox.FolderLastUid[folderName] {
-				slog.Debug("Message Uid is less than or equal to last UID", "messageID", msg.Envelope.MessageId)
+			if duplicate {
+				slog.Debug("Message content already exists in destination", "folder", folderName, "uid", msg.Uid)
 				continue
 			}
-
-			if j.SyncList.CompareMessageIds {
-				dstCriteria := imap.NewSearchCriteria()
-				dstCriteria.Header.Set("Message-ID", msg.Envelope.MessageId)
-				dstCriteria.WithoutFlags = []string{"\\Deleted"}
-
-				_, err = dstClient.Select(folderName, true)
-				if err != nil {
-					slog.Debug("Failed to select source folder", "folder", folderName, "error", err)
-					continue
-				}
-
-				existing, err := dstClient.Search(dstCriteria)
-				if err != nil {
-					slog.Debug("Failed to search for messages", "connection", "destination", "folder", folderName, "error", err)
-					continue
-				}
-
-				if len(existing) > 0 {
-					slog.Debug("Message-ID already exists in destination", "messageID", msg.Envelope.MessageId)
-					continue
-				}
+		} else if messageIds != nil {
+			exists, err := messageIds.contains(ctx, normalizeMessageId(msg.Envelope))
+			if err != nil {
+				slog.Debug("Failed to index destination folder", "folder", folderName, "error", err)
+				return err
 			}
 
-			slog.Debug("Migrating message", "messageID", msg.Envelope.MessageId)
-
-			literal := msg.GetBody(&imap.BodySectionName{})
-			if literal == nil {
+			if exists {
+				slog.Debug("Message-ID already exists in destination", "messageID", msg.Envelope.MessageId)
 				continue
 			}
+		}
 
-			flags := msg.Flags
-			date := msg.Envelope.Date
-			uid := msg.Uid
+		slog.Debug("Migrating message", "messageID", msg.Envelope.MessageId)
+
+		literal := msg.GetBody(&imap.BodySectionName{})
+		if literal == nil {
+			continue
+		}
 
-			appendDone := make(chan error, 1)
-			go func(lit imap.Literal, f []string, d time.Time, u uint32) {
-				select {
-				case appendDone <- dstClient.Append(folderName, f, d, lit):
-				case <-ctx.Done():
-				}
-			}(literal, flags, date, uid)
+		flags := j.flags.apply(msg.Flags, permanentFlags)
+		date := msg.Envelope.Date
+		uid := msg.Uid
 
+		// Read once appendDone delivered
+		var dstUid uint32
+		appendDone := make(chan error, 1)
+		go func(lit imap.Literal, f []string, d time.Time, u uint32) {
+			var err error
+			dstUid, err = j.limiter.append(ctx, dstClient, j.SyncList.DstHost, folderName, f, d, lit)
 			select {
-			case err := <-appendDone:
-				if err != nil {
-					return err
-				}
-				j.Mailbox.FolderLastUid[folderName] = uid
+			case appendDone <- err:
 			case <-ctx.Done():
-				return ctx.Err()
 			}
-		}
+		}(literal, flags, date, uid)
 
 		select {
-		case err := <-fetchMessagesDone:
+		case err := <-appendDone:
+			if err != nil {
+				return err
+			}
+			j.Mailbox.FolderLastUid[folderName] = uid
+			j.copiedUids[folderName] = uid
+			j.Mailbox.LastRunMessages++
+			if messageIds != nil {
+				messageIds.add(normalizeMessageId(msg.Envelope))
+			}
+
+			err = j.recordMessageMap(ctx, folderName, uid, dstUid, normalizeMessageId(msg.Envelope))
 			if err != nil {
-				slog.Debug("Failed to fetch messages", "folder", folderName, "error", err)
 				return err
 			}
 		case <-ctx.Done():
@@ -313,7 +393,20 @@ func (j *MigrateMailbox) Run(ctx context.Context) (err error) {
 		}
 	}
 
-	return nil
+	select {
+	case err := <-fetchMessagesDone:
+		if err != nil {
+			slog.Debug("Failed to fetch messages", "folder", folderName, "error", err)
+			if isThrottled(err) {
+				hostRateLimit(j.SyncList.SrcHost).slowDown()
+			}
+			return err
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return j.flushMessageMaps(ctx)
 }
 
 func (j *MigrateMailbox) OnStop(ctx context.Context) error {
@@ -322,5 +415,62 @@ func (j *MigrateMailbox) OnStop(ctx context.Context) error {
 		return err
 	}
 
+	err = j.flushMessageMaps(ctx)
+	if err != nil {
+		return err
+	}
+
+	if j.report != nil {
+		if j.runErr != nil {
+			j.report.Discrepancies = append(j.report.Discrepancies, "Run did not finish: "+classifyError(j.runErr).Error())
+		}
+
+		_, err = models.CreateReport(ctx, j.SyncList.Id, &j.Mailbox.Id, j.reportType, len(j.report.Discrepancies) == 0, j.report)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resetFolderState forgets what was copied from a folder whose UIDVALIDITY
+// changed, its uids no longer refer to the same messages.
+func (j *MigrateMailbox) resetFolderState(ctx context.Context, folderName string, uidValidity uint32) error {
+	j.Mailbox.FolderUidValidity[folderName] = uidValidity
+	j.Mailbox.FolderLastUid[folderName] = 0
+	delete(j.Mailbox.FolderHighestModSeq, folderName)
+
+	return models.DeleteMessageMapsByFolder(ctx, j.Mailbox.Id, folderName)
+}
+
+func (j *MigrateMailbox) recordMessageMap(ctx context.Context, folderName string, srcUid uint32, dstUid uint32, messageId string) error {
+	messageMap := &models.MessageMap{
+		MailboxId: j.Mailbox.Id,
+		Folder:    folderName,
+		SrcUid:    srcUid,
+	}
+	if dstUid != 0 {
+		messageMap.DstUid = &dstUid
+	}
+	if messageId != "" {
+		messageMap.MessageId = &messageId
+	}
+
+	j.messageMaps = append(j.messageMaps, messageMap)
+	if len(j.messageMaps) < messageMapBatchSize {
+		return nil
+	}
+
+	return j.flushMessageMaps(ctx)
+}
+
+func (j *MigrateMailbox) flushMessageMaps(ctx context.Context) error {
+	err := models.UpsertMessageMaps(ctx, j.messageMaps)
+	if err != nil {
+		return err
+	}
+
+	j.messageMaps = j.messageMaps[:0]
 	return nil
 }
@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"app/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var ErrMirrorLimitExceeded = errors.New("mirror deletions exceed the limit")
+
+// Preview reports list at most this many deletions per folder
+const mirrorPreviewLimit = 100
+
+// mirrorFolder holds what a mirror run removes from one destination folder.
+type mirrorFolder struct {
+	name     string
+	uids     *imap.SeqSet
+	mapIds   []int64
+	report   models.FolderReport
+	isFolder bool
+}
+
+// runMirror removes destination copies of messages expunged at the source,
+// found through the message maps, and destination folders whose source
+// folder was deleted. Only folders the migration copied are considered.
+func (j *MigrateMailbox) runMirror(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderNames []string) (err error) {
+	j.report = &models.MailboxReportData{
+		Folders:       make([]models.FolderReport, 0),
+		Discrepancies: make([]string, 0),
+	}
+	j.reportType = models.ReportTypeMirror
+	if j.SyncList.MirrorDryRun {
+		j.reportType = models.ReportTypeMirrorPreview
+	}
+	defer func() {
+		j.runErr = err
+	}()
+
+	onSrc := make(map[string]bool, len(folderNames))
+	for _, name := range folderNames {
+		onSrc[name] = true
+	}
+
+	dstFolderNames, err := listFolderNames(dstClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "destination", "error", err)
+		return err
+	}
+
+	removals := make([]*mirrorFolder, 0)
+	total, deletions := 0, 0
+
+	for _, name := range dstFolderNames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		status, err := dstClient.Status(name, []imap.StatusItem{imap.StatusMessages})
+		if err != nil {
+			slog.Debug("Failed to read folder status", "folder", name, "error", err)
+			continue
+		}
+		total += int(status.Messages)
+
+		_, copied := j.Mailbox.FolderUidValidity[name]
+		if !copied {
+			continue
+		}
+
+		if !onSrc[name] {
+			if strings.EqualFold(name, "INBOX") {
+				continue
+			}
+
+			removals = append(removals, &mirrorFolder{
+				name:     name,
+				isFolder: true,
+				report:   models.FolderReport{Folder: name, Deleted: int(status.Messages), FolderDeleted: true},
+			})
+			deletions += int(status.Messages)
+			continue
+		}
+
+		removal, err := j.mirrorExpunged(ctx, srcClient, name)
+		if err != nil {
+			return err
+		}
+		if removal != nil {
+			removals = append(removals, removal)
+			deletions += removal.report.Deleted
+		}
+	}
+
+	for _, removal := range removals {
+		j.report.Folders = append(j.report.Folders, removal.report)
+	}
+
+	limit := j.SyncList.MirrorMaxDeletePercent
+	if deletions > 0 && deletions*100 > total*limit {
+		j.report.Discrepancies = append(j.report.Discrepancies, fmt.Sprintf(
+			"%d of %d destination messages would be deleted, more than the %d%% limit", deletions, total, limit,
+		))
+		return ErrMirrorLimitExceeded
+	}
+
+	if j.SyncList.MirrorDryRun {
+		return nil
+	}
+
+	for _, removal := range removals {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if removal.isFolder {
+			err = j.deleteMirrorFolder(ctx, dstClient, removal.name)
+		} else {
+			err = j.deleteMirrorMessages(ctx, dstClient, removal)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mirrorExpunged finds the destination copies of messages expunged from a
+// source folder. It returns nil when there are none. Only copies with a
+// recorded uid are deleted, a search by Message-ID would also find copies the
+// migration never made. Entries without one are reported and dropped.
+func (j *MigrateMailbox) mirrorExpunged(ctx context.Context, srcClient *client.Client, folderName string) (*mirrorFolder, error) {
+	maps, err := models.FindMessageMapsByFolder(ctx, j.Mailbox.Id, folderName)
+	if err != nil || len(maps) == 0 {
+		return nil, err
+	}
+
+	_, err = srcClient.Select(folderName, true)
+	if err != nil {
+		slog.Debug("Failed to select source folder", "folder", folderName, "error", err)
+		return nil, err
+	}
+
+	srcUids, err := srcClient.UidSearch(imap.NewSearchCriteria())
+	if err != nil {
+		return nil, err
+	}
+
+	onSrc := make(map[uint32]bool, len(srcUids))
+	for _, uid := range srcUids {
+		onSrc[uid] = true
+	}
+
+	removal := &mirrorFolder{
+		name:   folderName,
+		uids:   &imap.SeqSet{},
+		report: models.FolderReport{Folder: folderName, SourceMessages: len(srcUids)},
+	}
+
+	for _, m := range maps {
+		if onSrc[m.SrcUid] {
+			continue
+		}
+
+		// The entry is dropped whether or not its copy can be deleted
+		removal.mapIds = append(removal.mapIds, m.Id)
+
+		messageId := ""
+		if m.MessageId != nil {
+			messageId = *m.MessageId
+		}
+
+		if m.DstUid == nil {
+			removal.report.Unresolved++
+			if len(removal.report.UnresolvedIds) < mirrorPreviewLimit {
+				label := messageId
+				if label == "" {
+					label = "Source UID " + strconv.FormatUint(uint64(m.SrcUid), 10)
+				}
+				removal.report.UnresolvedIds = append(removal.report.UnresolvedIds, label)
+			}
+			continue
+		}
+
+		removal.uids.AddNum(*m.DstUid)
+		removal.report.Deleted++
+
+		if j.SyncList.MirrorDryRun && len(removal.report.Deletions) < mirrorPreviewLimit {
+			label := messageId
+			if label == "" {
+				label = "UID " + strconv.FormatUint(uint64(*m.DstUid), 10)
+			}
+			removal.report.Deletions = append(removal.report.Deletions, label)
+		}
+	}
+
+	if len(removal.mapIds) == 0 {
+		return nil, nil
+	}
+
+	return removal, nil
+}
+
+func (j *MigrateMailbox) deleteMirrorMessages(ctx context.Context, dstClient *client.Client, removal *mirrorFolder) error {
+	if !removal.uids.Empty() {
+		_, err := dstClient.Select(removal.name, false)
+		if err != nil {
+			return err
+		}
+
+		err = deleteUids(dstClient, removal.uids, j.tracking.uidPlus)
+		if err != nil {
+			slog.Debug("Failed to delete messages", "folder", removal.name, "error", err)
+			return err
+		}
+	}
+
+	return models.DeleteMessageMapsByIds(ctx, removal.mapIds)
+}
+
+func (j *MigrateMailbox) deleteMirrorFolder(ctx context.Context, dstClient *client.Client, folderName string) error {
+	// Some servers refuse to delete the selected folder
+	_, err := dstClient.Select("INBOX", true)
+	if err != nil {
+		return err
+	}
+
+	err = dstClient.Delete(folderName)
+	if err != nil {
+		slog.Debug("Failed to delete folder", "folder", folderName, "error", err)
+		return err
+	}
+
+	delete(j.Mailbox.FolderLastUid, folderName)
+	delete(j.Mailbox.FolderUidValidity, folderName)
+	delete(j.Mailbox.FolderHighestModSeq, folderName)
+
+	return models.DeleteMessageMapsByFolder(ctx, j.Mailbox.Id, folderName)
+}
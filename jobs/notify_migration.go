@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"app/config"
+	"app/models"
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+)
+
+// NotifyMigrationFinished queues an email to the owner of a finished mailbox
+// migration, either right away or once every mailbox of the sync list has
+// finished, depending on the user's notification preference. Interrupted
+// mailboxes count as finished for the summary.
+func NotifyMigrationFinished(ctx context.Context, job *models.Job) {
+	if job.Type != MigrateMailboxType {
+		return
+	}
+
+	if job.Status != models.JobStatusCompleted && job.Status != models.JobStatusFailed && job.Status != models.JobStatusInterrupted {
+		return
+	}
+
+	err := notifyMigrationFinished(ctx, job)
+	if err != nil {
+		slog.Error("notify: failed to queue migration email", "job", job.Id, "err", err)
+	}
+}
+
+func notifyMigrationFinished(ctx context.Context, job *models.Job) error {
+	if job.RelatedId == nil {
+		return nil
+	}
+
+	user, err := models.FindUserById(ctx, job.UserId)
+	if err != nil {
+		return err
+	}
+
+	if user.NotificationPreference == models.NotificationPreferenceOff {
+		return nil
+	}
+
+	mailbox, err := models.FindMailboxById(ctx, *job.RelatedId)
+	if err != nil {
+		return err
+	}
+
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, mailbox.SyncListId)
+	if err != nil {
+		return err
+	}
+
+	if user.NotificationPreference == models.NotificationPreferenceImmediate {
+		// A stop asked for by the user is not worth an email of its own
+		if job.Status == models.JobStatusInterrupted {
+			return nil
+		}
+
+		subject := fmt.Sprintf("%s | %s: %s %s", config.Config.AppName, list.Name, mailbox.SrcUser, job.Status)
+		return EnqueueEmail(ctx, user.Id, migrationEmail(user.Email, subject, list, []*models.Mailbox{mailbox}, map[int]*models.Job{mailbox.Id: job}))
+	}
+
+	mailboxIds := make([]int, len(list.Mailboxes))
+	for i, mb := range list.Mailboxes {
+		mailboxIds[i] = mb.Id
+	}
+
+	relatedJobs, err := models.FindJobsByManyRelated(ctx, "mailboxes", mailboxIds)
+	if err != nil {
+		return err
+	}
+
+	jobsByMailboxId := make(map[int]*models.Job)
+	for _, relJob := range relatedJobs {
+		if relJob.Status == models.JobStatusRunning || relJob.Status == models.JobStatusPending {
+			return nil
+		}
+		jobsByMailboxId[*relJob.RelatedId] = relJob
+	}
+
+	if job.StartedAt == nil {
+		return nil
+	}
+
+	claimed, err := models.ClaimSyncListNotification(ctx, list.Id, *job.StartedAt)
+	if err != nil || !claimed {
+		return err
+	}
+
+	subject := fmt.Sprintf("%s | %s: migration finished", config.Config.AppName, list.Name)
+	return EnqueueEmail(ctx, user.Id, migrationEmail(user.Email, subject, list, list.Mailboxes, jobsByMailboxId))
+}
+
+func migrationEmail(to string, subject string, list *models.SyncList, mailboxes []*models.Mailbox, jobsByMailboxId map[int]*models.Job) SendEmailPayload {
+	completed, failed, interrupted, messages := 0, 0, 0, 0
+	rows := strings.Builder{}
+
+	for _, mailbox := range mailboxes {
+		status := models.JobStatusNone
+		errStr := ""
+
+		job, ok := jobsByMailboxId[mailbox.Id]
+		if ok {
+			status = job.Status
+			if job.Error != nil {
+				errStr = *job.Error
+			}
+		}
+
+		switch status {
+		case models.JobStatusCompleted:
+			completed++
+		case models.JobStatusFailed:
+			failed++
+		case models.JobStatusInterrupted:
+			interrupted++
+		}
+		messages += mailbox.LastRunMessages
+
+		fmt.Fprintf(&rows, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td></tr>",
+			html.EscapeString(mailbox.SrcUser),
+			html.EscapeString(mailbox.DstUser),
+			html.EscapeString(string(status)),
+			mailbox.LastRunMessages,
+			html.EscapeString(errStr),
+		)
+	}
+
+	body := fmt.Sprintf(
+		"<p>Sync list <b>%s</b> (%s to %s)</p>"+
+			"<p>Mailboxes completed: %d<br>Mailboxes failed: %d<br>Mailboxes interrupted: %d<br>Messages migrated: %d</p>"+
+			"<table border='1' cellpadding='4' cellspacing='0'>"+
+			"<tr><th>Source</th><th>Destination</th><th>Status</th><th>Messages</th><th>Error</th></tr>%s</table>",
+		html.EscapeString(list.Name),
+		html.EscapeString(list.SrcHost),
+		html.EscapeString(list.DstHost),
+		completed,
+		failed,
+		interrupted,
+		messages,
+		rows.String(),
+	)
+
+	return SendEmailPayload{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	}
+}
@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"github.com/emersion/go-imap/client"
+)
+
+// migrateFoldersParallel migrates up to ParallelFolders folders at once. The
+// first worker uses the connections of the run, every other one opens its own
+// pair within the host connection limits. A worker that can't connect is left
+// out, the others take its folders.
+func (j *MigrateMailbox) migrateFoldersParallel(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderNames []string) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// Extra connections are only worth waiting for while folders are left
+	connectCtx, connectCancel := context.WithCancel(ctx)
+	defer connectCancel()
+
+	folders := make(chan string)
+	go func() {
+		defer close(folders)
+		defer connectCancel()
+		for _, folderName := range folderNames {
+			select {
+			case folders <- folderName:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	work := func(src *client.Client, dst *client.Client, tracking changeTracking) {
+		for folderName := range folders {
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Other workers merge into the maps being cloned
+			mu.Lock()
+			folderJob := j.folderJob(tracking)
+			mu.Unlock()
+
+			err := folderJob.migrateFolder(ctx, src, dst, folderName)
+
+			mu.Lock()
+			j.mergeFolderJob(folderJob, folderName)
+			mu.Unlock()
+
+			if err != nil {
+				cancel(err)
+				return
+			}
+		}
+	}
+
+	workers := min(j.SyncList.ParallelFolders, len(folderNames))
+
+	var wg sync.WaitGroup
+	for range workers - 1 {
+		wg.Go(func() {
+			src, dst, err := connectMailbox(connectCtx, j.SyncList, j.Mailbox)
+			if err != nil {
+				slog.Debug("Failed to open folder connections", "error", err)
+				return
+			}
+			defer src.Logout()
+			defer dst.Logout()
+
+			work(src, dst, detectChangeTracking(src, dst))
+		})
+	}
+	work(srcClient, dstClient, j.tracking)
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+// folderJob copies the run for a single folder, with its own folder state so
+// workers don't share maps. Callers hold the lock mergeFolderJob is called
+// under.
+func (j *MigrateMailbox) folderJob(tracking changeTracking) *MigrateMailbox {
+	mailbox := *j.Mailbox
+	mailbox.FolderLastUid = maps.Clone(j.Mailbox.FolderLastUid)
+	mailbox.FolderUidValidity = maps.Clone(j.Mailbox.FolderUidValidity)
+	mailbox.FolderHighestModSeq = maps.Clone(j.Mailbox.FolderHighestModSeq)
+	mailbox.LastRunMessages = 0
+
+	return &MigrateMailbox{
+		SyncList:   j.SyncList,
+		Mailbox:    &mailbox,
+		tracking:   tracking,
+		flags:      j.flags,
+		limiter:    j.limiter,
+		copiedUids: maps.Clone(j.copiedUids),
+	}
+}
+
+// mergeFolderJob takes the state of folderName back from a folder job, along
+// with the message maps it did not write yet.
+func (j *MigrateMailbox) mergeFolderJob(folderJob *MigrateMailbox, folderName string) {
+	mergeFolderState(j.Mailbox.FolderLastUid, folderJob.Mailbox.FolderLastUid, folderName)
+	mergeFolderState(j.Mailbox.FolderUidValidity, folderJob.Mailbox.FolderUidValidity, folderName)
+	mergeFolderState(j.Mailbox.FolderHighestModSeq, folderJob.Mailbox.FolderHighestModSeq, folderName)
+	mergeFolderState(j.copiedUids, folderJob.copiedUids, folderName)
+
+	j.Mailbox.LastRunMessages += folderJob.Mailbox.LastRunMessages
+	j.messageMaps = append(j.messageMaps, folderJob.messageMaps...)
+}
+
+func mergeFolderState[V any](dst map[string]V, src map[string]V, folderName string) {
+	value, ok := src[folderName]
+	if !ok {
+		delete(dst, folderName)
+		return
+	}
+	dst[folderName] = value
+}
@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"app/models"
+	"app/worker"
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var PlanSyncListType models.JobType = "plan_sync_list"
+
+// Plan and verification jobs relate to the sync list, one job row per type.
+const SyncListRelatedTable = "sync_lists"
+
+// PlanSyncList is a dry run of the migration of a sync list. It reads both
+// sides, counts what would be copied or skipped and stores the counts as a
+// report, nothing is appended and no mailbox state is changed.
+type PlanSyncList struct {
+	SyncList *models.SyncList
+
+	plan *models.PlanReportData
+}
+
+type PlanSyncListPayload struct {
+	SyncListId int `json:"syncListId"`
+}
+
+func PlanSyncListFactory(ctx context.Context, payload *json.RawMessage) (worker.JobHandler, error) {
+	planPayload := new(PlanSyncListPayload)
+
+	err := json.Unmarshal(*payload, planPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, planPayload.SyncListId)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &PlanSyncList{
+		SyncList: list,
+	}
+
+	return handler, nil
+}
+
+// Run plans every mailbox in turn. A mailbox that can't be read is recorded
+// in the plan and the next one is tried.
+func (j *PlanSyncList) Run(ctx context.Context) error {
+	plan := &models.PlanReportData{
+		Mailboxes: make([]models.MailboxPlan, 0, len(j.SyncList.Mailboxes)),
+	}
+
+	for _, mailbox := range j.SyncList.Mailboxes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		mailboxPlan := models.MailboxPlan{
+			MailboxId: mailbox.Id,
+			SrcUser:   mailbox.SrcUser,
+			DstUser:   mailbox.DstUser,
+			Folders:   make([]models.PlanFolder, 0),
+		}
+
+		err := j.planMailbox(ctx, mailbox, &mailboxPlan)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			slog.Debug("Failed to plan mailbox", "mailbox", mailbox.Id, "error", err)
+			mailboxPlan.Error = classifyError(err).Error()
+		}
+
+		for _, folder := range mailboxPlan.Folders {
+			plan.Copy += folder.Copy
+			plan.CopyBytes += folder.CopyBytes
+			plan.Skip += folder.Skip
+			plan.SkipBytes += folder.SkipBytes
+		}
+		plan.Mailboxes = append(plan.Mailboxes, mailboxPlan)
+	}
+
+	// Only a complete plan is stored
+	j.plan = plan
+
+	return nil
+}
+
+func (j *PlanSyncList) OnStop(ctx context.Context) error {
+	if j.plan == nil {
+		return nil
+	}
+
+	passed := true
+	for _, mailboxPlan := range j.plan.Mailboxes {
+		if mailboxPlan.Error != "" || mailboxPlan.QuotaWarning != "" {
+			passed = false
+		}
+	}
+
+	_, err := models.CreateReport(ctx, j.SyncList.Id, nil, models.ReportTypePlan, passed, j.plan)
+	return err
+}
+
+func (j *PlanSyncList) planMailbox(ctx context.Context, mailbox *models.Mailbox, mailboxPlan *models.MailboxPlan) error {
+	srcClient, dstClient, err := connectMailbox(ctx, j.SyncList, mailbox)
+	if err != nil {
+		return err
+	}
+	defer srcClient.Logout()
+	defer dstClient.Logout()
+
+	folderNames, err := listFolderNames(srcClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "source", "error", err)
+		return err
+	}
+
+	dstFolderNames, err := listFolderNames(dstClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "destination", "error", err)
+		return err
+	}
+
+	// The quota is advisory, a server that can't report it doesn't fail the plan
+	quota, err := destinationQuota(dstClient)
+	if err != nil {
+		slog.Debug("Failed to read destination quota", "error", err)
+	}
+
+	onDst := make(map[string]bool, len(dstFolderNames))
+	for _, name := range dstFolderNames {
+		onDst[name] = true
+	}
+
+	for _, folderName := range folderNames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		folder, err := j.planFolder(ctx, srcClient, dstClient, mailbox, folderName, onDst[folderName])
+		if err != nil {
+			return err
+		}
+
+		mailboxPlan.Folders = append(mailboxPlan.Folders, folder)
+	}
+
+	if quota != nil {
+		checkPlanQuota(mailboxPlan, quota)
+	}
+
+	return nil
+}
+
+// checkPlanQuota warns when the messages to copy don't fit into the space
+// left on the destination.
+func checkPlanQuota(mailboxPlan *models.MailboxPlan, quota *quotaUsage) {
+	mailboxPlan.QuotaUsed = quota.used
+	mailboxPlan.QuotaLimit = quota.limit
+
+	var copyBytes int64
+	for _, folder := range mailboxPlan.Folders {
+		copyBytes += folder.CopyBytes
+	}
+
+	mailboxPlan.QuotaWarning = quotaWarning(copyBytes, quota)
+}
+
+// planFolder picks the messages the migration would consider the way Run
+// does: past the last copied uid when CompareLastUid is set, then skipped
+// when their Message-ID is found in the destination folder.
+func (j *PlanSyncList) planFolder(ctx context.Context, srcClient *client.Client, dstClient *client.Client, mailbox *models.Mailbox, folderName string, dstExists bool) (models.PlanFolder, error) {
+	folder := models.PlanFolder{Folder: folderName}
+
+	srcFolder, err := srcClient.Select(folderName, true)
+	if err != nil {
+		slog.Debug("Failed to select source folder", "folder", folderName, "error", err)
+		return folder, err
+	}
+	folder.Messages = int(srcFolder.Messages)
+
+	if srcFolder.Messages == 0 {
+		return folder, nil
+	}
+
+	// A changed UIDVALIDITY makes the migration start the folder over
+	var lastUid uint32
+	if j.SyncList.CompareLastUid && mailbox.FolderUidValidity[folderName] == srcFolder.UidValidity {
+		lastUid = mailbox.FolderLastUid[folderName]
+	}
+
+	seqset := &imap.SeqSet{}
+	seqset.AddRange(lastUid+1, 0)
+
+	srcMessages, err := fetchSeqSet(ctx, srcClient, seqset, true, []imap.FetchItem{imap.FetchEnvelope, imap.FetchRFC822Size, imap.FetchUid})
+	if err != nil {
+		slog.Debug("Failed to fetch messages", "connection", "source", "folder", folderName, "error", err)
+		return folder, err
+	}
+
+	// Body digests would need every source body, plans match headers only
+	dedupHeaders := j.SyncList.ContentDedup == models.ContentDedupHeaders
+
+	var messageIds *messageIdIndex
+	var contents *contentIndex
+	if (j.SyncList.CompareMessageIds || dedupHeaders) && dstExists {
+		_, err = dstClient.Select(folderName, true)
+		if err != nil {
+			slog.Debug("Failed to select destination folder", "folder", folderName, "error", err)
+			return folder, err
+		}
+
+		if j.SyncList.CompareMessageIds {
+			messageIds = newMessageIdIndex(dstClient)
+		}
+		if dedupHeaders {
+			contents = newContentIndex(dstClient, models.ContentDedupHeaders)
+		}
+	}
+
+	for _, msg := range srcMessages {
+		// "n:*" always matches the last message, even below n
+		if msg.Uid <= lastUid {
+			continue
+		}
+
+		messageId := normalizeMessageId(msg.Envelope)
+		duplicate := false
+		if messageId == "" && contents != nil {
+			duplicate, err = contents.contains(ctx, msg)
+		} else if messageIds != nil {
+			duplicate, err = messageIds.contains(ctx, messageId)
+		}
+		if err != nil {
+			slog.Debug("Failed to index destination folder", "folder", folderName, "error", err)
+			return folder, err
+		}
+
+		if duplicate {
+			folder.Skip++
+			folder.SkipBytes += int64(msg.Size)
+			continue
+		}
+
+		folder.Copy++
+		folder.CopyBytes += int64(msg.Size)
+	}
+
+	return folder, nil
+}
@@ -0,0 +1,224 @@
+package jobs
+
+import (
+	"app/config"
+	"bytes"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// pop3Client speaks the few POP3 (RFC 1939) commands a migration needs,
+// with STLS from RFC 2595 and UIDL for incremental runs.
+type pop3Client struct {
+	conn net.Conn
+	text *textproto.Conn
+	// APOP timestamp from the greeting, empty when the server offers none
+	timestamp string
+	close     func()
+}
+
+// pop3Message is a message of the maildrop by its number in this session
+// and its unique id across sessions.
+type pop3Message struct {
+	num  int
+	uidl string
+}
+
+var pop3Timestamp = regexp.MustCompile(`<[^<>]+@[^<>]+>`)
+
+// dialPop3 connects with implicit TLS and falls back to STLS, like
+// dialImap. The host slot is released once the client is closed.
+func dialPop3(host string, port int, release func()) (*pop3Client, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: imapDialTimeout}
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: config.Config.Debug,
+	}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	if err == nil {
+		c, err := newPop3Client(conn, release)
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		return c, nil
+	}
+	slog.Debug("Failed to connect (TLS)", "addr", addr, "error", err)
+
+	plain, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		slog.Debug("Failed to connect (no TLS)", "addr", addr, "error", err)
+		release()
+		return nil, err
+	}
+
+	c, err := newPop3Client(plain, release)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	err = c.startTls(tlsConfig)
+	if err != nil {
+		slog.Debug("Failed to start TLS", "addr", addr, "error", err)
+		c.close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func newPop3Client(conn net.Conn, release func()) (*pop3Client, error) {
+	c := &pop3Client{
+		conn: conn,
+		text: textproto.NewConn(conn),
+	}
+	c.close = sync.OnceFunc(func() {
+		_ = c.text.Close()
+		release()
+	})
+
+	greeting, err := c.response()
+	if err != nil {
+		_ = c.text.Close()
+		return nil, err
+	}
+	c.timestamp = pop3Timestamp.FindString(greeting)
+
+	return c, nil
+}
+
+// response reads a status line and returns its text, -ERR becomes an error
+// carrying the server's text so it can be classified.
+func (c *pop3Client) response() (string, error) {
+	line, err := c.text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(line, "+OK"):
+		return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+	case strings.HasPrefix(line, "-ERR"):
+		return "", errors.New("pop3: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+	}
+
+	return "", fmt.Errorf("pop3: unexpected response %q", line)
+}
+
+func (c *pop3Client) cmd(format string, args ...any) (string, error) {
+	err := c.text.PrintfLine(format, args...)
+	if err != nil {
+		return "", err
+	}
+
+	return c.response()
+}
+
+// startTls upgrades a plain connection, the greeting's timestamp stays valid.
+func (c *pop3Client) startTls(tlsConfig *tls.Config) error {
+	_, err := c.cmd("STLS")
+	if err != nil {
+		return err
+	}
+
+	conn := tls.Client(c.conn, tlsConfig)
+	err = conn.Handshake()
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+	c.text = textproto.NewConn(conn)
+
+	return nil
+}
+
+// login uses APOP when the greeting offers a timestamp and falls back to
+// USER and PASS when the server refuses it.
+func (c *pop3Client) login(user string, password string) error {
+	if c.timestamp != "" {
+		digest := md5.Sum([]byte(c.timestamp + password))
+		_, err := c.cmd("APOP %s %s", user, hex.EncodeToString(digest[:]))
+		if err == nil {
+			return nil
+		}
+		slog.Debug("APOP refused, trying USER and PASS", "error", err)
+	}
+
+	_, err := c.cmd("USER %s", user)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.cmd("PASS %s", password)
+	return err
+}
+
+// uidl lists the maildrop, servers without UIDL can't be migrated
+// incrementally and are refused.
+func (c *pop3Client) uidl() ([]pop3Message, error) {
+	_, err := c.cmd("UIDL")
+	if err != nil {
+		return nil, fmt.Errorf("server does not support UIDL: %w", err)
+	}
+
+	lines, err := c.text.ReadDotLines()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]pop3Message, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		num, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		messages = append(messages, pop3Message{num: num, uidl: fields[1]})
+	}
+
+	return messages, nil
+}
+
+// retr downloads a message with CRLF line endings, as APPEND expects.
+func (c *pop3Client) retr(num int) ([]byte, error) {
+	_, err := c.cmd("RETR %d", num)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.text.ReadDotBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.ReplaceAll(body, []byte("\n"), []byte("\r\n")), nil
+}
+
+// quit ends the session without deleting anything, no message is marked
+// for deletion.
+func (c *pop3Client) quit() {
+	_, err := c.cmd("QUIT")
+	if err != nil {
+		slog.Debug("Failed to quit POP3 session", "error", err)
+	}
+	c.close()
+}
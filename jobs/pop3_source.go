@@ -0,0 +1,254 @@
+package jobs
+
+import (
+	"app/config"
+	"app/helpers"
+	"app/models"
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/mail"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var ErrImapSourceRequired = errors.New("the sync list reads its source over POP3, only migration runs support it")
+
+// POP3 has a single maildrop, it is copied to the destination INBOX
+const pop3Folder = "INBOX"
+
+// connectPop3Mailbox is connectMailbox for a POP3 source. The caller must
+// quit the source and log out of the destination.
+func connectPop3Mailbox(ctx context.Context, list *models.SyncList, mailbox *models.Mailbox) (srcClient *pop3Client, dstClient *client.Client, err error) {
+	releases, err := acquireHosts(ctx, list.SrcHost, list.DstHost)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	srcClient, err = dialPop3(list.SrcHost, list.SrcPort, releases[0])
+	if err != nil {
+		releases[1]()
+		return nil, nil, err
+	}
+
+	dstClient, err = dialLimited(list.DstHost, list.DstPort, releases[1])
+	if err != nil {
+		srcClient.quit()
+		return nil, nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			srcClient.quit()
+			_ = dstClient.Logout()
+		}
+	}()
+
+	decryptedSrcPassword, err := helpers.AesDecrypt(mailbox.SrcPasswordHash, config.Config.AppKey)
+	if err != nil {
+		slog.Debug("Failed to decrypt source password", "error", err)
+		return nil, nil, err
+	}
+
+	decryptedDstPassword, err := helpers.AesDecrypt(mailbox.DstPasswordHash, config.Config.AppKey)
+	if err != nil {
+		slog.Debug("Failed to decrypt destination password", "error", err)
+		return nil, nil, err
+	}
+
+	if err := srcClient.login(mailbox.SrcUser, decryptedSrcPassword); err != nil {
+		slog.Debug("Failed to login to source account", "error", err)
+		return nil, nil, err
+	}
+
+	if err := dstClient.Login(mailbox.DstUser, decryptedDstPassword); err != nil {
+		slog.Debug("Failed to login to destination account", "error", err)
+		return nil, nil, err
+	}
+
+	return srcClient, dstClient, nil
+}
+
+// connectPop3Source is connectSource for a POP3 source. The caller must quit
+// the client.
+func connectPop3Source(ctx context.Context, list *models.SyncList, mailbox *models.Mailbox) (c *pop3Client, err error) {
+	releases, err := acquireHosts(ctx, list.SrcHost)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err = dialPop3(list.SrcHost, list.SrcPort, releases[0])
+	if err != nil {
+		return nil, err
+	}
+
+	decryptedSrcPassword, err := helpers.AesDecrypt(mailbox.SrcPasswordHash, config.Config.AppKey)
+	if err != nil {
+		slog.Debug("Failed to decrypt source password", "error", err)
+		c.quit()
+		return nil, err
+	}
+
+	if err := c.login(mailbox.SrcUser, decryptedSrcPassword); err != nil {
+		slog.Debug("Failed to login to source account", "error", err)
+		c.quit()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// headerEnvelope reads the headers the dedup indexes compare, the way an IMAP
+// server reports them in ENVELOPE.
+func headerEnvelope(header mail.Header) *imap.Envelope {
+	decoder := new(mime.WordDecoder)
+
+	envelope := &imap.Envelope{
+		MessageId: strings.TrimSpace(header.Get("Message-Id")),
+	}
+	envelope.Date, _ = header.Date()
+
+	subject, err := decoder.DecodeHeader(header.Get("Subject"))
+	if err != nil {
+		subject = header.Get("Subject")
+	}
+	envelope.Subject = subject
+
+	from, _ := header.AddressList("From")
+	for _, address := range from {
+		mailboxName, hostName, _ := strings.Cut(address.Address, "@")
+		envelope.From = append(envelope.From, &imap.Address{
+			PersonalName: address.Name,
+			MailboxName:  mailboxName,
+			HostName:     hostName,
+		})
+	}
+
+	return envelope
+}
+
+// runPop3 copies the maildrop to the destination INBOX through the same
+// dedup, rate limits and append as an IMAP run. Copied messages are tracked
+// by UIDL, with CompareLastUid they are skipped on the next run. Nothing is
+// deleted from the source.
+func (j *MigrateMailbox) runPop3(ctx context.Context) error {
+	srcClient, dstClient, err := connectPop3Mailbox(ctx, j.SyncList, j.Mailbox)
+	if err != nil {
+		return err
+	}
+	defer srcClient.quit()
+	defer dstClient.Logout()
+
+	j.flags = newFlagPolicy(j.SyncList)
+	j.limiter = newTransferLimiter(j.SyncList)
+
+	_, err = checkDestinationQuota(dstClient)
+	if err != nil {
+		return err
+	}
+
+	if j.Mailbox.Pop3Uidls == nil {
+		j.Mailbox.Pop3Uidls = make(map[string]uint32)
+	}
+
+	messages, err := srcClient.uidl()
+	if err != nil {
+		slog.Debug("Failed to list messages", "connection", "source", "error", err)
+		return err
+	}
+
+	dstFolder, err := dstClient.Select(pop3Folder, false)
+	if err != nil {
+		slog.Debug("Failed to select destination folder", "folder", pop3Folder, "error", err)
+		return err
+	}
+
+	var messageIds *messageIdIndex
+	if j.SyncList.CompareMessageIds {
+		messageIds = newMessageIdIndex(dstClient)
+	}
+	var contents *contentIndex
+	if j.SyncList.ContentDedup != models.ContentDedupOff {
+		contents = newContentIndex(dstClient, j.SyncList.ContentDedup)
+	}
+
+	onSource := make(map[string]bool, len(messages))
+	for _, message := range messages {
+		onSource[message.uidl] = true
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if j.copiedUidls[message.uidl] {
+			continue
+		}
+		if _, copied := j.Mailbox.Pop3Uidls[message.uidl]; copied && j.SyncList.CompareLastUid {
+			continue
+		}
+
+		body, err := srcClient.retr(message.num)
+		if err != nil {
+			slog.Debug("Failed to retrieve message", "uidl", message.uidl, "error", err)
+			return err
+		}
+
+		var envelope *imap.Envelope
+		if parsed, err := mail.ReadMessage(bytes.NewReader(body)); err == nil {
+			envelope = headerEnvelope(parsed.Header)
+		} else {
+			envelope = &imap.Envelope{}
+		}
+		messageId := normalizeMessageId(envelope)
+
+		msg := &imap.Message{
+			Envelope: envelope,
+			Size:     uint32(len(body)),
+			Body: map[*imap.BodySectionName]imap.Literal{
+				{}: bytes.NewReader(body),
+			},
+		}
+
+		duplicate := false
+		if contents != nil && messageId == "" {
+			duplicate, err = contents.contains(ctx, msg)
+		} else if messageIds != nil {
+			duplicate, err = messageIds.contains(ctx, messageId)
+		}
+		if err != nil {
+			slog.Debug("Failed to index destination folder", "folder", pop3Folder, "error", err)
+			return err
+		}
+
+		if duplicate {
+			slog.Debug("Message already exists in destination", "uidl", message.uidl)
+			j.Mailbox.Pop3Uidls[message.uidl] = 0
+			continue
+		}
+
+		dstUid, err := j.limiter.append(ctx, dstClient, j.SyncList.DstHost, pop3Folder, j.flags.apply(nil, dstFolder.PermanentFlags), envelope.Date, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		j.Mailbox.Pop3Uidls[message.uidl] = dstUid
+		j.copiedUidls[message.uidl] = true
+		j.Mailbox.LastRunMessages++
+		if messageIds != nil {
+			messageIds.add(messageId)
+		}
+	}
+
+	// Messages gone from the maildrop are forgotten
+	for uidl := range j.Mailbox.Pop3Uidls {
+		if !onSource[uidl] {
+			delete(j.Mailbox.Pop3Uidls, uidl)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package jobs
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// scriptedConn replays the server's side of a session and records what the
+// client sent. The client waits for every response in turn, so the whole
+// server side can be written up front.
+type scriptedConn struct {
+	net.Conn
+	server *strings.Reader
+	client bytes.Buffer
+}
+
+func (c *scriptedConn) Read(p []byte) (int, error)  { return c.server.Read(p) }
+func (c *scriptedConn) Write(p []byte) (int, error) { return c.client.Write(p) }
+func (c *scriptedConn) Close() error                { return nil }
+
+// sent returns the commands the client wrote, one per line.
+func (c *scriptedConn) sent() []string {
+	return strings.Split(strings.TrimSuffix(c.client.String(), "\r\n"), "\r\n")
+}
+
+func scriptedPop3(t *testing.T, server ...string) (*pop3Client, *scriptedConn) {
+	t.Helper()
+
+	conn := &scriptedConn{server: strings.NewReader(strings.Join(server, "\r\n") + "\r\n")}
+	c, err := newPop3Client(conn, func() {})
+	if err != nil {
+		t.Fatalf("newPop3Client() error = %v", err)
+	}
+
+	return c, conn
+}
+
+func TestPop3Response(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    string
+		wantErr string
+	}{
+		{"ok", "+OK 2 messages", "2 messages", ""},
+		{"ok without text", "+OK", "", ""},
+		{"err", "-ERR [AUTH] Authentication failed", "", "pop3: [AUTH] Authentication failed"},
+		{"err without text", "-ERR", "", "pop3: "},
+		{"garbage", "* OK IMAP4rev1", "", `pop3: unexpected response "* OK IMAP4rev1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := scriptedPop3(t, "+OK ready", tt.line)
+
+			got, err := c.response()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("response() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("response() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("response() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPop3Greeting(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting string
+		want     string
+	}{
+		{"apop timestamp", "+OK POP3 ready <1896.697170952@dbc.mtview.ca.us>", "<1896.697170952@dbc.mtview.ca.us>"},
+		{"no timestamp", "+OK Dovecot ready.", ""},
+		{"brackets without host", "+OK ready <not a timestamp>", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := scriptedPop3(t, tt.greeting)
+			if c.timestamp != tt.want {
+				t.Errorf("timestamp = %q, want %q", c.timestamp, tt.want)
+			}
+		})
+	}
+
+	conn := &scriptedConn{server: strings.NewReader("-ERR busy\r\n")}
+	_, err := newPop3Client(conn, func() {})
+	if err == nil {
+		t.Error("newPop3Client() accepted a refused greeting")
+	}
+}
+
+func TestPop3Login(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting string
+		server   []string
+		wantSent []string
+		wantErr  bool
+	}{
+		{
+			// Example from RFC 1939 section 7
+			name:     "apop",
+			greeting: "+OK POP3 server ready <1896.697170952@dbc.mtview.ca.us>",
+			server:   []string{"+OK maildrop has 1 message"},
+			wantSent: []string{"APOP mrose c4c9334bac560ecc979e58001b3e22fb"},
+		},
+		{
+			name:     "apop refused",
+			greeting: "+OK POP3 server ready <1896.697170952@dbc.mtview.ca.us>",
+			server:   []string{"-ERR APOP disabled", "+OK", "+OK logged in"},
+			wantSent: []string{"APOP mrose c4c9334bac560ecc979e58001b3e22fb", "USER mrose", "PASS tanstaaf"},
+		},
+		{
+			name:     "user and pass",
+			greeting: "+OK ready",
+			server:   []string{"+OK", "+OK logged in"},
+			wantSent: []string{"USER mrose", "PASS tanstaaf"},
+		},
+		{
+			name:     "wrong password",
+			greeting: "+OK ready",
+			server:   []string{"+OK", "-ERR invalid password"},
+			wantSent: []string{"USER mrose", "PASS tanstaaf"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, conn := scriptedPop3(t, append([]string{tt.greeting}, tt.server...)...)
+
+			err := c.login("mrose", "tanstaaf")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := conn.sent(); !slices.Equal(got, tt.wantSent) {
+				t.Errorf("sent %q, want %q", got, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestPop3Uidl(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  []string
+		want    []pop3Message
+		wantErr bool
+	}{
+		{
+			name:   "listing",
+			server: []string{"+OK", "1 whqtswO00WBw418f9t5JxYwZ", "2 QhdPYR:00WBw1Ph7x7", "."},
+			want:   []pop3Message{{1, "whqtswO00WBw418f9t5JxYwZ"}, {2, "QhdPYR:00WBw1Ph7x7"}},
+		},
+		{
+			name:   "empty maildrop",
+			server: []string{"+OK", "."},
+			want:   []pop3Message{},
+		},
+		{
+			name:   "malformed lines are skipped",
+			server: []string{"+OK", "1", "x abc", "3 a b", "4 def", "."},
+			want:   []pop3Message{{4, "def"}},
+		},
+		{
+			name:    "not supported",
+			server:  []string{"-ERR unknown command"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, conn := scriptedPop3(t, append([]string{"+OK ready"}, tt.server...)...)
+
+			got, err := c.uidl()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("uidl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("uidl() = %v, want %v", got, tt.want)
+			}
+			if sent := conn.sent(); !slices.Equal(sent, []string{"UIDL"}) {
+				t.Errorf("sent %q", sent)
+			}
+		})
+	}
+}
+
+func TestPop3Retr(t *testing.T) {
+	c, conn := scriptedPop3(t,
+		"+OK ready",
+		"+OK 120 octets",
+		"Subject: Hi",
+		"",
+		"..leading dot",
+		"body",
+		".",
+	)
+
+	got, err := c.retr(7)
+	if err != nil {
+		t.Fatalf("retr() error = %v", err)
+	}
+
+	want := "Subject: Hi\r\n\r\n.leading dot\r\nbody\r\n"
+	if string(got) != want {
+		t.Errorf("retr() = %q, want %q", got, want)
+	}
+	if sent := conn.sent(); !slices.Equal(sent, []string{"RETR 7"}) {
+		t.Errorf("sent %q", sent)
+	}
+
+	c, _ = scriptedPop3(t, "+OK ready", "-ERR no such message")
+	if _, err := c.retr(9); err == nil {
+		t.Error("retr() accepted a refused message")
+	}
+}
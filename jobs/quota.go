@@ -0,0 +1,221 @@
+package jobs
+
+import (
+	"app/helpers"
+	"app/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/responses"
+)
+
+// go-imap v1 has no QUOTA (RFC 9208) support, GETQUOTAROOT is built here.
+
+var ErrOverQuota = errors.New("destination mailbox is over quota")
+
+// quotaUsage is the STORAGE resource of a quota root in bytes, servers count
+// it in KiB.
+type quotaUsage struct {
+	root  string
+	used  int64
+	limit int64
+}
+
+func (q *quotaUsage) free() int64 {
+	return max(q.limit-q.used, 0)
+}
+
+type getQuotaRoot struct {
+	Mailbox string
+}
+
+func (cmd *getQuotaRoot) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "GETQUOTAROOT",
+		Arguments: []interface{}{imap.FormatMailboxName(cmd.Mailbox)},
+	}
+}
+
+type quotaRootResult struct {
+	quotas []*quotaUsage
+}
+
+func parseQuotaNumber(f interface{}) (int64, error) {
+	switch f := f.(type) {
+	case string:
+		return strconv.ParseInt(f, 10, 64)
+	case imap.RawString:
+		return strconv.ParseInt(string(f), 10, 64)
+	}
+
+	return 0, errors.New("quota value is not a number")
+}
+
+func (r *quotaRootResult) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok {
+		return responses.ErrUnhandled
+	}
+
+	switch name {
+	case "QUOTAROOT":
+		return nil
+	case "QUOTA":
+		if len(fields) < 2 {
+			return responses.ErrUnhandled
+		}
+
+		root, _ := imap.ParseString(fields[0])
+		resources, _ := fields[1].([]interface{})
+		for i := 0; i+2 < len(resources); i += 3 {
+			resource, _ := imap.ParseString(resources[i])
+			if !strings.EqualFold(resource, "STORAGE") {
+				continue
+			}
+
+			used, err := parseQuotaNumber(resources[i+1])
+			if err != nil {
+				return err
+			}
+			limit, err := parseQuotaNumber(resources[i+2])
+			if err != nil {
+				return err
+			}
+
+			r.quotas = append(r.quotas, &quotaUsage{root: root, used: used * 1024, limit: limit * 1024})
+		}
+
+		return nil
+	}
+
+	return responses.ErrUnhandled
+}
+
+// destinationQuota returns the storage quota of the root with the least
+// space left for INBOX, nil when the server has no QUOTA extension or sets
+// no storage limit.
+func destinationQuota(c *client.Client) (*quotaUsage, error) {
+	if ok, _ := c.Support("QUOTA"); !ok {
+		return nil, nil
+	}
+
+	result := &quotaRootResult{}
+	status, err := c.Execute(&getQuotaRoot{Mailbox: "INBOX"}, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := statusErr(status); err != nil {
+		return nil, err
+	}
+
+	var tightest *quotaUsage
+	for _, quota := range result.quotas {
+		if quota.limit <= 0 {
+			continue
+		}
+		if tightest == nil || quota.free() < tightest.free() {
+			tightest = quota
+		}
+	}
+
+	return tightest, nil
+}
+
+// checkDestinationQuota stops a run before copying when the destination is
+// already full, nothing would fit. It returns the quota to compare the
+// messages to copy with, nil when there is none. A quota that can't be read
+// is ignored.
+func checkDestinationQuota(c *client.Client) (*quotaUsage, error) {
+	quota, err := destinationQuota(c)
+	if err != nil {
+		slog.Debug("Failed to read destination quota", "error", err)
+		return nil, nil
+	}
+
+	if quota != nil && quota.free() == 0 {
+		return nil, fmt.Errorf("%w: %s used of %s", ErrOverQuota, helpers.FormatBytes(quota.used), helpers.FormatBytes(quota.limit))
+	}
+
+	return quota, nil
+}
+
+// quotaWarning describes copyBytes not fitting into the space left on the
+// destination, empty when they fit.
+func quotaWarning(copyBytes int64, quota *quotaUsage) string {
+	if copyBytes <= quota.free() {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"%s to copy but only %s free on the destination",
+		helpers.FormatBytes(copyBytes), helpers.FormatBytes(quota.free()),
+	)
+}
+
+// checkSourceSize adds up the size of the messages past the last copied uid
+// of each folder and stores a quota report when they don't fit into the
+// space left on the destination. Duplicates skipped later are counted too.
+// The run goes on, the destination refuses the APPEND once it's full.
+func (j *MigrateMailbox) checkSourceSize(ctx context.Context, srcClient *client.Client, folderNames []string, quota *quotaUsage) error {
+	var copyBytes int64
+	for _, folderName := range folderNames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		srcFolder, err := srcClient.Select(folderName, true)
+		if err != nil {
+			slog.Debug("Failed to select source folder", "folder", folderName, "error", err)
+			continue
+		}
+		if srcFolder.Messages == 0 {
+			continue
+		}
+
+		var lastUid uint32
+		if j.SyncList.CompareLastUid && j.Mailbox.FolderUidValidity[folderName] == srcFolder.UidValidity {
+			lastUid = j.Mailbox.FolderLastUid[folderName]
+		}
+
+		seqset := &imap.SeqSet{}
+		seqset.AddRange(lastUid+1, 0)
+
+		messages, err := fetchSeqSet(ctx, srcClient, seqset, true, []imap.FetchItem{imap.FetchRFC822Size, imap.FetchUid})
+		if err != nil {
+			slog.Debug("Failed to fetch message sizes", "folder", folderName, "error", err)
+			return err
+		}
+
+		for _, msg := range messages {
+			// "n:*" always matches the last message, even below n
+			if msg.Uid > lastUid {
+				copyBytes += int64(msg.Size)
+			}
+		}
+	}
+
+	warning := quotaWarning(copyBytes, quota)
+	if warning == "" {
+		return nil
+	}
+
+	slog.Warn("Source does not fit the destination quota", "mailbox", j.Mailbox.Id, "warning", warning)
+	_, err := models.CreateReport(ctx, j.SyncList.Id, &j.Mailbox.Id, models.ReportTypeQuota, false, &models.MailboxReportData{
+		Folders:       []models.FolderReport{},
+		Discrepancies: []string{warning},
+	})
+
+	return err
+}
+
+// IsOverQuota reports whether job stopped because the destination mailbox
+// is full.
+func IsOverQuota(job *models.Job) bool {
+	return job.Status == models.JobStatusFailed && job.Error != nil && strings.HasPrefix(*job.Error, string(ErrorClassQuota)+": ")
+}
@@ -0,0 +1,243 @@
+package jobs
+
+import (
+	"app/config"
+	"app/models"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// A slowed down rate is doubled again after this long without throttling
+	throttleRecovery = time.Minute
+	// Messages per second a host without a message rate is slowed down from
+	throttledMessagesPerSecond = 10
+	// Slowing down stops at 1/64 of the configured rate
+	minRateFactor = 1.0 / 64
+
+	// Appends refused for going too fast are retried this many times, waiting
+	// a multiple of throttleBackoff
+	throttleRetries = 5
+	throttleBackoff = 10 * time.Second
+)
+
+// rateLimit is a token bucket for bytes and one for messages per second. A
+// throttling response halves its rates, they double again every
+// throttleRecovery until the configured rates are back.
+type rateLimit struct {
+	// Configured rates, 0 for no limit
+	bytesPerSecond    int
+	messagesPerSecond int
+
+	mu       sync.Mutex
+	factor   float64
+	slowedAt time.Time
+	bytes    *rate.Limiter
+	messages *rate.Limiter
+}
+
+func newRateLimit(bytesPerSecond int, messagesPerSecond int) *rateLimit {
+	l := &rateLimit{
+		bytesPerSecond:    bytesPerSecond,
+		messagesPerSecond: messagesPerSecond,
+		factor:            1,
+		bytes:             rate.NewLimiter(rate.Inf, max(bytesPerSecond, 1)),
+		messages:          rate.NewLimiter(rate.Inf, max(messagesPerSecond, throttledMessagesPerSecond)),
+	}
+	l.apply()
+
+	return l
+}
+
+func scaledRate(perSecond int, factor float64) rate.Limit {
+	if perSecond <= 0 {
+		return rate.Inf
+	}
+
+	return rate.Limit(float64(perSecond) * factor)
+}
+
+// apply sets the limiters from the configured rates and the current factor,
+// the caller holds mu unless l is not shared yet.
+func (l *rateLimit) apply() {
+	l.bytes.SetLimit(scaledRate(l.bytesPerSecond, l.factor))
+
+	messagesPerSecond := l.messagesPerSecond
+	if messagesPerSecond == 0 && l.factor < 1 {
+		messagesPerSecond = throttledMessagesPerSecond
+	}
+	l.messages.SetLimit(scaledRate(messagesPerSecond, l.factor))
+}
+
+func (l *rateLimit) slowDown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.factor = max(l.factor/2, minRateFactor)
+	l.slowedAt = time.Now()
+	l.apply()
+}
+
+func (l *rateLimit) recover() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.factor >= 1 || time.Since(l.slowedAt) < throttleRecovery {
+		return
+	}
+
+	l.factor = min(l.factor*2, 1)
+	l.slowedAt = time.Now()
+	l.apply()
+}
+
+// wait blocks until a message of size bytes may be copied. Sizes above the
+// burst of one second are taken in steps.
+func (l *rateLimit) wait(ctx context.Context, size int) error {
+	l.recover()
+
+	err := l.messages.Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	if l.bytesPerSecond == 0 {
+		return nil
+	}
+
+	for size > 0 {
+		n := min(size, l.bytes.Burst())
+		err := l.bytes.WaitN(ctx, n)
+		if err != nil {
+			return err
+		}
+		size -= n
+	}
+
+	return nil
+}
+
+// rateLimits are shared by all workers of the process, so every run of a
+// sync list or towards a host draws from the same buckets.
+var rateLimits = struct {
+	sync.Mutex
+	syncLists map[int]*rateLimit
+	hosts     map[string]*rateLimit
+}{
+	syncLists: make(map[int]*rateLimit),
+	hosts:     make(map[string]*rateLimit),
+}
+
+// syncListRateLimit starts over with full buckets when the sync list's rates
+// were edited.
+func syncListRateLimit(list *models.SyncList) *rateLimit {
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+
+	l, ok := rateLimits.syncLists[list.Id]
+	if !ok || l.bytesPerSecond != list.MaxBytesPerSecond || l.messagesPerSecond != list.MaxMessagesPerSecond {
+		l = newRateLimit(list.MaxBytesPerSecond, list.MaxMessagesPerSecond)
+		rateLimits.syncLists[list.Id] = l
+	}
+
+	return l
+}
+
+// hostRateLimit also exists for hosts without configured rates, so they can
+// be slowed down when they throttle.
+func hostRateLimit(host string) *rateLimit {
+	host = strings.ToLower(host)
+
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+
+	l, ok := rateLimits.hosts[host]
+	if !ok {
+		l = newRateLimit(config.Config.HostBytesPerSecond[host], config.Config.HostMessagesPerSecond[host])
+		rateLimits.hosts[host] = l
+	}
+
+	return l
+}
+
+// transferLimiter applies the rates of a sync list and of both its hosts to
+// the messages a run copies.
+type transferLimiter struct {
+	limits []*rateLimit
+}
+
+func newTransferLimiter(list *models.SyncList) *transferLimiter {
+	limits := []*rateLimit{syncListRateLimit(list), hostRateLimit(list.SrcHost)}
+	if dst := hostRateLimit(list.DstHost); dst != limits[1] {
+		limits = append(limits, dst)
+	}
+
+	return &transferLimiter{limits: limits}
+}
+
+// newDestinationLimiter applies the rates of a sync list and its destination
+// host, for messages that don't come from the source server.
+func newDestinationLimiter(list *models.SyncList) *transferLimiter {
+	return &transferLimiter{limits: []*rateLimit{syncListRateLimit(list), hostRateLimit(list.DstHost)}}
+}
+
+// newSourceLimiter applies the rates of a sync list and its source host, for
+// messages that are not copied to the destination server.
+func newSourceLimiter(list *models.SyncList) *transferLimiter {
+	return &transferLimiter{limits: []*rateLimit{syncListRateLimit(list), hostRateLimit(list.SrcHost)}}
+}
+
+func (t *transferLimiter) wait(ctx context.Context, size int) error {
+	for _, l := range t.limits {
+		err := l.wait(ctx, size)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// append appends a message to host within the transfer rates. When
+// host throttles, its rates are slowed down and the append is retried after a
+// growing pause. A full mailbox stops the run with ErrOverQuota.
+func (t *transferLimiter) append(ctx context.Context, c *client.Client, host string, folderName string, flags []string, date time.Time, literal imap.Literal) (uint32, error) {
+	body, err := io.ReadAll(literal)
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = t.wait(ctx, len(body))
+		if err != nil {
+			return 0, err
+		}
+
+		uid, err := appendMessage(c, folderName, flags, date, bytes.NewReader(body))
+		if errorClass(err) == ErrorClassQuota {
+			return 0, fmt.Errorf("%w: %w", ErrOverQuota, err)
+		}
+		if err == nil || !isThrottled(err) || attempt > throttleRetries {
+			return uid, err
+		}
+
+		slog.Debug("Append throttled, slowing down", "host", host, "folder", folderName, "attempt", attempt, "error", err)
+		hostRateLimit(host).slowDown()
+
+		select {
+		case <-time.After(time.Duration(attempt) * throttleBackoff):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"app/config"
+	"app/models"
+	"app/worker"
+	"context"
+	"encoding/json"
+
+	"gopkg.in/gomail.v2"
+)
+
+var SendEmailType models.JobType = "send_email"
+
+// SendEmail sends an HTML email through the configured SMTP server, outside
+// of the job listener that queued it.
+type SendEmail struct {
+	Payload *SendEmailPayload
+}
+
+type SendEmailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+func SendEmailFactory(ctx context.Context, payload *json.RawMessage) (worker.JobHandler, error) {
+	sendEmailPayload := new(SendEmailPayload)
+
+	err := json.Unmarshal(*payload, sendEmailPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &SendEmail{
+		Payload: sendEmailPayload,
+	}
+
+	return handler, nil
+}
+
+// EnqueueEmail queues an email to a user.
+func EnqueueEmail(ctx context.Context, userId int, payload SendEmailPayload) error {
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = models.CreateJob(ctx, userId, SendEmailType, (*json.RawMessage)(&payloadJson))
+	return err
+}
+
+func (j *SendEmail) Run(ctx context.Context) error {
+	dialer := gomail.NewDialer(config.Config.SMTPHost, config.Config.SMTPPort, config.Config.SMTPLogin, config.Config.SMTPPassword)
+
+	message := gomail.NewMessage()
+	message.SetHeader("From", config.Config.SMTPLogin)
+	message.SetHeader("To", j.Payload.To)
+	message.SetHeader("Subject", j.Payload.Subject)
+	message.SetBody("text/html", j.Payload.Body)
+
+	return dialer.DialAndSend(message)
+}
+
+func (j *SendEmail) OnStop(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,169 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// ErrorClass sorts a failed IMAP command by what can be done about it.
+type ErrorClass string
+
+const (
+	// The server wants us to slow down, the run backs off and resumes
+	ErrorClassThrottling ErrorClass = "throttling"
+	// Credentials were refused or the account is locked
+	ErrorClassAuth ErrorClass = "auth"
+	// The destination mailbox is full
+	ErrorClassQuota ErrorClass = "quota"
+	// Anything else the server refused, repeating won't help
+	ErrorClassPermanent ErrorClass = "permanent"
+)
+
+// Response codes from RFC 5530 and vendor extensions
+var responseCodeClasses = map[imap.StatusRespCode]ErrorClass{
+	"THROTTLED":            ErrorClassThrottling,
+	"UNAVAILABLE":          ErrorClassThrottling,
+	"INUSE":                ErrorClassThrottling,
+	"LIMIT":                ErrorClassThrottling,
+	"AUTHENTICATIONFAILED": ErrorClassAuth,
+	"AUTHORIZATIONFAILED":  ErrorClassAuth,
+	"EXPIRED":              ErrorClassAuth,
+	"PRIVACYREQUIRED":      ErrorClassAuth,
+	"OVERQUOTA":            ErrorClassQuota,
+}
+
+// Response texts, go-imap keeps only the text of most refused commands.
+// Throttling is matched first, "exceeded bandwidth limits" is not a quota.
+// Markers are whole phrases, single words such as "password" also appear in
+// folder names and unrelated responses.
+var responseTextClasses = []struct {
+	class   ErrorClass
+	markers []string
+}{
+	{ErrorClassThrottling, []string{"throttled", "too many connections", "too many simultaneous", "too many requests", "too many commands", "bandwidth limit", "rate limit", "try again later", "server busy", "server unavailable"}},
+	{ErrorClassAuth, []string{"authentication failed", "authentication failure", "invalid credentials", "login failed", "logon failed", "invalid password", "incorrect password", "wrong password", "account is disabled", "account disabled"}},
+	{ErrorClassQuota, []string{"overquota", "quota", "mailbox is full", "mailbox full", "insufficient storage", "storage limit"}},
+}
+
+// statusError is a refused command with its response code, which
+// StatusResp.Err drops.
+type statusError struct {
+	resp *imap.StatusResp
+}
+
+func (e *statusError) Error() string {
+	if e.resp.Code == "" {
+		return e.resp.Info
+	}
+
+	return fmt.Sprintf("[%s] %s", e.resp.Code, e.resp.Info)
+}
+
+// statusErr is StatusResp.Err keeping the response code.
+func statusErr(status *imap.StatusResp) error {
+	if status == nil {
+		return nil
+	}
+
+	err := status.Err()
+	if err == nil {
+		return nil
+	}
+
+	return &statusError{resp: status}
+}
+
+// ClassifiedError is an error with its class in front, so Job.Error shows it.
+type ClassifiedError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ClassifiedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Class, e.Err)
+}
+
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// isConnectionError reports errors without a server response, the
+// connection dropped.
+func isConnectionError(err error) bool {
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	text := err.Error()
+	return strings.Contains(text, "connection closed") || strings.Contains(text, "use of closed network connection")
+}
+
+// errorClass returns the class of err, empty for connection errors.
+func errorClass(err error) ErrorClass {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ""
+	}
+
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+
+	var status *statusError
+	if errors.As(err, &status) {
+		if class, ok := responseCodeClasses[status.resp.Code]; ok {
+			return class
+		}
+	}
+
+	text := strings.ToLower(err.Error())
+	for _, textClass := range responseTextClasses {
+		for _, marker := range textClass.markers {
+			if strings.Contains(text, marker) {
+				return textClass.class
+			}
+		}
+	}
+
+	if isConnectionError(err) {
+		return ""
+	}
+
+	return ErrorClassPermanent
+}
+
+// classifyError puts the class in front of err. Connection errors and
+// errors already classified are returned as they are.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	class := errorClass(err)
+	if class == "" {
+		return err
+	}
+
+	return &ClassifiedError{Class: class, Err: err}
+}
+
+// isThrottled reports whether err is a server asking us to slow down.
+func isThrottled(err error) bool {
+	return errorClass(err) == ErrorClassThrottling
+}
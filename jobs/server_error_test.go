@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func noResp(code imap.StatusRespCode, info string) *imap.StatusResp {
+	return &imap.StatusResp{Type: imap.StatusRespNo, Code: code, Info: info}
+}
+
+func TestStatusErr(t *testing.T) {
+	tests := []struct {
+		name   string
+		status *imap.StatusResp
+		want   string
+	}{
+		{"nil status", nil, ""},
+		{"ok", &imap.StatusResp{Type: imap.StatusRespOk, Info: "done"}, ""},
+		{"no without code", noResp("", "mailbox doesn't exist"), "mailbox doesn't exist"},
+		{"no with code", noResp("OVERQUOTA", "over quota"), "[OVERQUOTA] over quota"},
+		{"bad", &imap.StatusResp{Type: imap.StatusRespBad, Info: "syntax error"}, "syntax error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := statusErr(tt.status)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("statusErr() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("statusErr() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"nil", nil, ""},
+		{"canceled", context.Canceled, ""},
+		{"deadline", fmt.Errorf("fetch: %w", context.DeadlineExceeded), ""},
+		{"eof", io.EOF, ""},
+		{"net error", &net.OpError{Op: "read", Err: errors.New("reset")}, ""},
+		{"closed connection", errors.New("imap: connection closed"), ""},
+		{"classified", &ClassifiedError{Class: ErrorClassQuota, Err: errors.New("x")}, ErrorClassQuota},
+		{"wrapped classified", fmt.Errorf("append: %w", &ClassifiedError{Class: ErrorClassAuth, Err: io.EOF}), ErrorClassAuth},
+		{"throttled code", statusErr(noResp("THROTTLED", "slow down")), ErrorClassThrottling},
+		{"limit code", statusErr(noResp("LIMIT", "")), ErrorClassThrottling},
+		{"auth code", statusErr(noResp("AUTHENTICATIONFAILED", "no")), ErrorClassAuth},
+		{"quota code", statusErr(noResp("OVERQUOTA", "")), ErrorClassQuota},
+		{"code wins over text", statusErr(noResp("OVERQUOTA", "too many connections")), ErrorClassQuota},
+		{"unknown code falls back to text", statusErr(noResp("ALERT", "Rate limit hit")), ErrorClassThrottling},
+		{"too many connections", errors.New("Too many simultaneous connections"), ErrorClassThrottling},
+		{"bandwidth is not quota", errors.New("Account exceeded bandwidth limits"), ErrorClassThrottling},
+		{"try again later", errors.New("Server busy, try again later"), ErrorClassThrottling},
+		{"authentication failed", errors.New("Authentication failed."), ErrorClassAuth},
+		{"invalid password", errors.New("LOGIN: Invalid password"), ErrorClassAuth},
+		{"mailbox full", errors.New("Mailbox is full"), ErrorClassQuota},
+		{"quota", errors.New("Quota exceeded"), ErrorClassQuota},
+		{"password in folder name", errors.New("Mailbox doesn't exist: Passwords"), ErrorClassPermanent},
+		{"too many in other text", errors.New("Too many messages selected"), ErrorClassPermanent},
+		{"refused", statusErr(noResp("", "Invalid messageset")), ErrorClassPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorClass(tt.err); got != tt.want {
+				t.Errorf("errorClass(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	if err := classifyError(nil); err != nil {
+		t.Fatalf("classifyError(nil) = %v, want nil", err)
+	}
+
+	if err := classifyError(io.EOF); err != io.EOF {
+		t.Errorf("classifyError(EOF) = %v, want it unchanged", err)
+	}
+
+	refused := statusErr(noResp("OVERQUOTA", "over quota"))
+	err := classifyError(refused)
+	if err.Error() != "quota: [OVERQUOTA] over quota" {
+		t.Errorf("classifyError() = %q", err.Error())
+	}
+	if !errors.Is(err, refused) {
+		t.Error("classifyError() doesn't wrap the original error")
+	}
+	if again := classifyError(fmt.Errorf("append: %w", err)); errorClass(again) != ErrorClassQuota || again.Error() != "append: "+err.Error() {
+		t.Errorf("classifyError() classified twice: %q", again.Error())
+	}
+
+	if !isThrottled(errors.New("Too many requests")) {
+		t.Error("isThrottled() = false for a throttling response")
+	}
+}
@@ -0,0 +1,421 @@
+package jobs
+
+import (
+	"app/models"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// Two-way sync lists run the migration in both directions. The message maps
+// act as a ledger shared by both: every copy, whichever way it went, links a
+// source uid to a destination uid, so a copied message is never copied back.
+
+// errNoCopyLink is returned for a message whose copy could not be found again
+// to link it in the ledger, it is not copied.
+var errNoCopyLink = errors.New("copy can't be linked to its original")
+
+func (j *MigrateMailbox) ledgerSrcUids(ctx context.Context, folderName string) (map[uint32]bool, error) {
+	maps, err := models.FindMessageMapsByFolder(ctx, j.Mailbox.Id, folderName)
+	if err != nil {
+		return nil, err
+	}
+
+	srcUids := make(map[uint32]bool, len(maps))
+	for _, m := range maps {
+		srcUids[m.SrcUid] = true
+	}
+
+	return srcUids, nil
+}
+
+func listFolderNames(c *client.Client) ([]string, error) {
+	mailboxes := make(chan *imap.MailboxInfo)
+	listDone := make(chan error, 1)
+	go func() {
+		listDone <- c.List("", "*", mailboxes)
+	}()
+
+	names := make([]string, 0)
+	for mbox := range mailboxes {
+		names = append(names, mbox.Name)
+	}
+
+	return names, <-listDone
+}
+
+// syncReverse copies messages filed on the destination to the source, then
+// settles messages deleted on one side by the sync list's deletion policy.
+func (j *MigrateMailbox) syncReverse(ctx context.Context, srcClient *client.Client, dstClient *client.Client) error {
+	folderNames, err := listFolderNames(dstClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "destination", "error", err)
+		return err
+	}
+
+	srcUidPlus, _ := srcClient.Support("UIDPLUS")
+
+	for _, folderName := range folderNames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err = j.reverseFolder(ctx, srcClient, dstClient, folderName, srcUidPlus)
+		if err != nil {
+			return err
+		}
+
+		err = j.settleDeletions(ctx, srcClient, dstClient, folderName, srcUidPlus)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *MigrateMailbox) reverseFolder(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderName string, srcUidPlus bool) error {
+	dstFolder, err := dstClient.Select(folderName, true)
+	if err != nil {
+		slog.Debug("Failed to select destination folder", "folder", folderName, "error", err)
+		return err
+	}
+
+	// Without a stored validity the uids the forward pass just recorded are
+	// current, only a changed one makes them stale
+	storedValidity := j.Mailbox.FolderDstUidValidity[folderName]
+	if storedValidity != dstFolder.UidValidity {
+		j.Mailbox.FolderDstUidValidity[folderName] = dstFolder.UidValidity
+
+		if storedValidity != 0 {
+			j.Mailbox.FolderDstLastUid[folderName] = 0
+
+			// Stale destination uids would pass for deleted copies
+			err = models.ClearMessageMapDstUids(ctx, j.Mailbox.Id, folderName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if dstFolder.Messages == 0 {
+		return nil
+	}
+
+	lastUid := j.Mailbox.FolderDstLastUid[folderName]
+	seqset := &imap.SeqSet{}
+	seqset.AddRange(lastUid+1, 0)
+
+	dstMessages, err := fetchSeqSet(ctx, dstClient, seqset, true, []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid})
+	if err != nil {
+		slog.Debug("Failed to fetch messages", "connection", "destination", "folder", folderName, "error", err)
+		return err
+	}
+
+	dstUids := make([]uint32, 0, len(dstMessages))
+	messageIds := make([]string, 0, len(dstMessages))
+	for _, msg := range dstMessages {
+		dstUids = append(dstUids, msg.Uid)
+		if messageId := normalizeMessageId(msg.Envelope); messageId != "" {
+			messageIds = append(messageIds, messageId)
+		}
+	}
+
+	byDstUid, err := models.FindMessageMapsByDstUids(ctx, j.Mailbox.Id, folderName, dstUids)
+	if err != nil {
+		return err
+	}
+
+	byMessageId, err := models.FindMessageMapsByMessageIds(ctx, j.Mailbox.Id, folderName, messageIds)
+	if err != nil {
+		return err
+	}
+
+	maxUid := lastUid
+	toCopy := &imap.SeqSet{}
+	for _, msg := range dstMessages {
+		// "n:*" always matches the last message, even below n
+		if msg.Uid <= lastUid {
+			continue
+		}
+		if msg.Uid > maxUid {
+			maxUid = msg.Uid
+		}
+
+		if _, ok := byDstUid[msg.Uid]; ok {
+			continue
+		}
+
+		if m, ok := byMessageId[normalizeMessageId(msg.Envelope)]; ok {
+			// Copied without APPENDUID, the ledger learns the uid now
+			if m.DstUid == nil {
+				err = j.recordMessageMap(ctx, folderName, m.SrcUid, msg.Uid, *m.MessageId)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		toCopy.AddNum(msg.Uid)
+	}
+
+	if !toCopy.Empty() {
+		if err := ensureFolder(srcClient, folderName); err != nil {
+			return err
+		}
+
+		// Selected to look up the uids of copies when APPENDUID is missing
+		_, err = srcClient.Select(folderName, true)
+		if err != nil {
+			slog.Debug("Failed to select source folder", "folder", folderName, "error", err)
+			return err
+		}
+
+		err = fetchEach(ctx, dstClient, toCopy, true, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822, imap.FetchUid}, func(msg *imap.Message) error {
+			messageId := normalizeMessageId(msg.Envelope)
+			srcUid, err := j.copyMessage(ctx, srcClient, srcUidPlus, folderName, msg)
+			if errors.Is(err, errNoCopyLink) {
+				slog.Warn("Skipping message, its copy couldn't be linked", "folder", folderName, "dstUid", msg.Uid)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			j.Mailbox.LastRunMessages++
+
+			if srcUid == 0 {
+				slog.Debug("Copied message missing from the ledger", "folder", folderName, "messageID", messageId)
+				return nil
+			}
+
+			return j.recordMessageMap(ctx, folderName, srcUid, msg.Uid, messageId)
+		})
+		if err != nil {
+			slog.Debug("Failed to copy messages", "connection", "source", "folder", folderName, "error", err)
+			return err
+		}
+	}
+
+	j.Mailbox.FolderDstLastUid[folderName] = maxUid
+
+	return j.flushMessageMaps(ctx)
+}
+
+// copyMessage appends a fetched message to a folder of c and returns the uid
+// of the copy. Without APPENDUID the copy is searched for, which needs the
+// folder selected, and 0 is returned when it can't be found. A message that
+// could not be searched for is not appended when c lacks UIDPLUS.
+func (j *MigrateMailbox) copyMessage(ctx context.Context, c *client.Client, uidPlus bool, folderName string, msg *imap.Message) (uint32, error) {
+	literal := msg.GetBody(&imap.BodySectionName{})
+	if literal == nil {
+		return 0, nil
+	}
+
+	// The size is read before the APPEND consumes the literal
+	criteria := copySearchCriteria(msg.Envelope, uint32(literal.Len()))
+	if criteria == nil && !uidPlus {
+		return 0, errNoCopyLink
+	}
+
+	var date time.Time
+	if msg.Envelope != nil {
+		date = msg.Envelope.Date
+	}
+
+	// Keywords were renamed for the destination, they go back as they are
+	flags := flagPolicy{keepDeleted: j.flags.keepDeleted}.apply(msg.Flags, nil)
+
+	uid, err := j.limiter.append(ctx, c, j.SyncList.SrcHost, folderName, flags, date, literal)
+	if err != nil || uid != 0 || criteria == nil {
+		return uid, err
+	}
+
+	uids, err := c.UidSearch(criteria)
+	if err != nil || len(uids) == 0 {
+		return 0, err
+	}
+
+	// The copy is the newest message matching it
+	uid = uids[0]
+	for _, u := range uids[1:] {
+		if u > uid {
+			uid = u
+		}
+	}
+
+	return uid, nil
+}
+
+// copySearchCriteria finds the copy of a message by its Message-ID, or by
+// size, sent date and subject when it has none. It returns nil when the
+// message has neither.
+func copySearchCriteria(envelope *imap.Envelope, size uint32) *imap.SearchCriteria {
+	criteria := imap.NewSearchCriteria()
+
+	if messageId := normalizeMessageId(envelope); messageId != "" {
+		criteria.Header.Set("Message-ID", messageId)
+		return criteria
+	}
+
+	if envelope == nil || envelope.Date.IsZero() || envelope.Subject == "" || size == 0 {
+		return nil
+	}
+
+	// SENTON ignores the time and zone of the Date header
+	date := envelope.Date
+	criteria.SentSince = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	criteria.SentBefore = criteria.SentSince.Add(24 * time.Hour)
+	criteria.Larger = size - 1
+	criteria.Smaller = size + 1
+	criteria.Header.Set("Subject", envelope.Subject)
+
+	return criteria
+}
+
+// settleDeletions looks for ledger entries whose message is gone on one side
+// and applies the deletion policy to the other copy.
+func (j *MigrateMailbox) settleDeletions(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderName string, srcUidPlus bool) error {
+	maps, err := models.FindMessageMapsByFolder(ctx, j.Mailbox.Id, folderName)
+	if err != nil || len(maps) == 0 {
+		return err
+	}
+
+	policy := j.SyncList.DeletionPolicy
+
+	// A folder missing on the source is not treated as deleted messages
+	_, err = srcClient.Select(folderName, policy != models.DeletionPolicyPropagate)
+	if err != nil {
+		slog.Debug("Skipping deletions, source folder not selectable", "folder", folderName, "error", err)
+		return nil
+	}
+
+	srcUids, err := srcClient.UidSearch(imap.NewSearchCriteria())
+	if err != nil {
+		return err
+	}
+
+	dstFolder, err := dstClient.Select(folderName, false)
+	if err != nil {
+		return err
+	}
+
+	dstUids, err := dstClient.UidSearch(imap.NewSearchCriteria())
+	if err != nil {
+		return err
+	}
+
+	onSrc := make(map[uint32]bool, len(srcUids))
+	for _, uid := range srcUids {
+		onSrc[uid] = true
+	}
+	onDst := make(map[uint32]bool, len(dstUids))
+	for _, uid := range dstUids {
+		onDst[uid] = true
+	}
+
+	forget := make([]int64, 0)
+	deleteOnSrc, deleteOnDst := &imap.SeqSet{}, &imap.SeqSet{}
+	restoreToSrc, restoreToDst := &imap.SeqSet{}, &imap.SeqSet{}
+
+	for _, m := range maps {
+		if m.DstUid == nil {
+			continue
+		}
+
+		srcExists, dstExists := onSrc[m.SrcUid], onDst[*m.DstUid]
+		if srcExists && dstExists {
+			continue
+		}
+
+		switch {
+		case !srcExists && !dstExists, policy == models.DeletionPolicyKeep:
+			forget = append(forget, m.Id)
+		case policy == models.DeletionPolicyPropagate && !srcExists:
+			deleteOnDst.AddNum(*m.DstUid)
+			forget = append(forget, m.Id)
+		case policy == models.DeletionPolicyPropagate:
+			deleteOnSrc.AddNum(m.SrcUid)
+			forget = append(forget, m.Id)
+		case !srcExists:
+			// The old entry is replaced once the copy has a source uid
+			restoreToSrc.AddNum(*m.DstUid)
+			forget = append(forget, m.Id)
+		default:
+			restoreToDst.AddNum(m.SrcUid)
+		}
+	}
+
+	if !deleteOnSrc.Empty() {
+		err = deleteUids(srcClient, deleteOnSrc, srcUidPlus)
+		if err != nil {
+			slog.Debug("Failed to delete messages", "connection", "source", "folder", folderName, "error", err)
+			return err
+		}
+	}
+
+	if !deleteOnDst.Empty() {
+		err = deleteUids(dstClient, deleteOnDst, j.tracking.uidPlus)
+		if err != nil {
+			slog.Debug("Failed to delete messages", "connection", "destination", "folder", folderName, "error", err)
+			return err
+		}
+	}
+
+	if !restoreToSrc.Empty() {
+		err = fetchEach(ctx, dstClient, restoreToSrc, true, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822, imap.FetchUid}, func(msg *imap.Message) error {
+			srcUid, err := j.copyMessage(ctx, srcClient, srcUidPlus, folderName, msg)
+			if errors.Is(err, errNoCopyLink) {
+				slog.Warn("Skipping restore, its copy couldn't be linked", "folder", folderName, "dstUid", msg.Uid)
+				return nil
+			}
+			if err != nil || srcUid == 0 {
+				return err
+			}
+
+			return j.recordMessageMap(ctx, folderName, srcUid, msg.Uid, normalizeMessageId(msg.Envelope))
+		})
+		if err != nil {
+			slog.Debug("Failed to restore messages", "connection", "source", "folder", folderName, "error", err)
+			return err
+		}
+	}
+
+	if !restoreToDst.Empty() {
+		err = fetchEach(ctx, srcClient, restoreToDst, true, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822, imap.FetchUid}, func(msg *imap.Message) error {
+			literal := msg.GetBody(&imap.BodySectionName{})
+			if literal == nil {
+				return nil
+			}
+
+			var date time.Time
+			if msg.Envelope != nil {
+				date = msg.Envelope.Date
+			}
+
+			dstUid, err := j.limiter.append(ctx, dstClient, j.SyncList.DstHost, folderName, j.flags.apply(msg.Flags, dstFolder.PermanentFlags), date, literal)
+			if err != nil {
+				return err
+			}
+
+			return j.recordMessageMap(ctx, folderName, msg.Uid, dstUid, normalizeMessageId(msg.Envelope))
+		})
+		if err != nil {
+			slog.Debug("Failed to restore messages", "connection", "destination", "folder", folderName, "error", err)
+			return err
+		}
+	}
+
+	err = models.DeleteMessageMapsByIds(ctx, forget)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Settled deletions", "folder", folderName, "policy", policy, "forgotten", len(forget))
+
+	return j.flushMessageMaps(ctx)
+}
@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestCopySearchCriteria(t *testing.T) {
+	date := time.Date(2026, time.March, 2, 23, 30, 0, 0, time.FixedZone("", -5*3600))
+
+	tests := []struct {
+		name     string
+		envelope *imap.Envelope
+		size     uint32
+		want     *imap.SearchCriteria
+	}{
+		{
+			name:     "message id",
+			envelope: &imap.Envelope{MessageId: " <abc@example.com> ", Date: date, Subject: "Hi"},
+			size:     2048,
+			want:     &imap.SearchCriteria{Header: map[string][]string{"Message-Id": {"<abc@example.com>"}}},
+		},
+		{
+			name:     "size, date and subject",
+			envelope: &imap.Envelope{Date: date, Subject: "Quarterly report"},
+			size:     2048,
+			want: &imap.SearchCriteria{
+				Header:     map[string][]string{"Subject": {"Quarterly report"}},
+				SentSince:  time.Date(2026, time.March, 2, 0, 0, 0, 0, date.Location()),
+				SentBefore: time.Date(2026, time.March, 3, 0, 0, 0, 0, date.Location()),
+				Larger:     2047,
+				Smaller:    2049,
+			},
+		},
+		{"no subject", &imap.Envelope{Date: date}, 2048, nil},
+		{"no date", &imap.Envelope{Subject: "Hi"}, 2048, nil},
+		{"no size", &imap.Envelope{Date: date, Subject: "Hi"}, 0, nil},
+		{"no envelope", nil, 2048, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := copySearchCriteria(tt.envelope, tt.size)
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("copySearchCriteria() = %+v, want %+v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+
+			for key, values := range tt.want.Header {
+				if got.Header.Get(key) != values[0] {
+					t.Errorf("header %s = %q, want %q", key, got.Header.Get(key), values[0])
+				}
+			}
+			if len(got.Header) != len(tt.want.Header) {
+				t.Errorf("header = %v, want %v", got.Header, tt.want.Header)
+			}
+			if !got.SentSince.Equal(tt.want.SentSince) || !got.SentBefore.Equal(tt.want.SentBefore) {
+				t.Errorf("sent %s to %s, want %s to %s", got.SentSince, got.SentBefore, tt.want.SentSince, tt.want.SentBefore)
+			}
+			if got.Larger != tt.want.Larger || got.Smaller != tt.want.Smaller {
+				t.Errorf("size between %d and %d, want %d and %d", got.Larger, got.Smaller, tt.want.Larger, tt.want.Smaller)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package jobs
+
+import (
+	"app/models"
+	"app/worker"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+var VerifySyncListType models.JobType = "verify_sync_list"
+
+// Reports list at most this many missing or extra Message-IDs per folder
+const verifyIdLimit = 100
+
+// VerifySyncList compares every source folder of each mailbox with the
+// destination folder of the same name and stores a report per mailbox.
+// Messages flagged \Deleted are left out on both sides.
+type VerifySyncList struct {
+	SyncList *models.SyncList
+}
+
+type VerifySyncListPayload struct {
+	SyncListId int `json:"syncListId"`
+}
+
+func VerifySyncListFactory(ctx context.Context, payload *json.RawMessage) (worker.JobHandler, error) {
+	verifyPayload := new(VerifySyncListPayload)
+
+	err := json.Unmarshal(*payload, verifyPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := models.FindSyncListByIdWithMailboxes(ctx, verifyPayload.SyncListId)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &VerifySyncList{
+		SyncList: list,
+	}
+
+	return handler, nil
+}
+
+func (j *VerifySyncList) Run(ctx context.Context) error {
+	for _, mailbox := range j.SyncList.Mailboxes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		report := &models.MailboxReportData{
+			Folders:       make([]models.FolderReport, 0),
+			Discrepancies: make([]string, 0),
+		}
+
+		err := j.verifyMailbox(ctx, mailbox, report)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			slog.Debug("Failed to verify mailbox", "mailbox", mailbox.Id, "error", err)
+			report.Discrepancies = append(report.Discrepancies, "Verification did not finish: "+classifyError(err).Error())
+		}
+
+		_, err = models.CreateReport(ctx, j.SyncList.Id, &mailbox.Id, models.ReportTypeVerification, len(report.Discrepancies) == 0, report)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *VerifySyncList) OnStop(ctx context.Context) error {
+	return nil
+}
+
+func (j *VerifySyncList) verifyMailbox(ctx context.Context, mailbox *models.Mailbox, report *models.MailboxReportData) error {
+	srcClient, dstClient, err := connectMailbox(ctx, j.SyncList, mailbox)
+	if err != nil {
+		return err
+	}
+	defer srcClient.Logout()
+	defer dstClient.Logout()
+
+	folderNames, err := listFolderNames(srcClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "source", "error", err)
+		return err
+	}
+
+	dstFolderNames, err := listFolderNames(dstClient)
+	if err != nil {
+		slog.Debug("Failed to list folders", "connection", "destination", "error", err)
+		return err
+	}
+
+	onDst := make(map[string]bool, len(dstFolderNames))
+	for _, name := range dstFolderNames {
+		onDst[name] = true
+	}
+
+	for _, folderName := range folderNames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		folderReport, err := verifyFolder(ctx, srcClient, dstClient, folderName, onDst[folderName])
+		if err != nil {
+			return err
+		}
+		report.Folders = append(report.Folders, folderReport)
+
+		if !onDst[folderName] && folderReport.SourceMessages > 0 {
+			report.Discrepancies = append(report.Discrepancies, fmt.Sprintf(
+				"%s: folder missing on destination, source has %d messages", folderName, folderReport.SourceMessages,
+			))
+			continue
+		}
+		if folderReport.Missing > 0 || folderReport.Extra > 0 {
+			report.Discrepancies = append(report.Discrepancies, fmt.Sprintf(
+				"%s: %d messages missing on destination, %d extra", folderName, folderReport.Missing, folderReport.Extra,
+			))
+		}
+		if folderReport.SourceMessages != folderReport.DestinationMessages {
+			report.Discrepancies = append(report.Discrepancies, fmt.Sprintf(
+				"%s: destination has %d messages, source has %d",
+				folderName, folderReport.DestinationMessages, folderReport.SourceMessages,
+			))
+			continue
+		}
+		if !sizesMatch(folderReport.SourceBytes, folderReport.DestinationBytes, folderReport.SourceMessages) {
+			report.Discrepancies = append(report.Discrepancies, fmt.Sprintf(
+				"%s: destination holds %d bytes, source holds %d",
+				folderName, folderReport.DestinationBytes, folderReport.SourceBytes,
+			))
+		}
+	}
+
+	return nil
+}
+
+// Servers may add headers or normalize line endings when a message is
+// appended. Totals of equally many messages differing by up to
+// verifySizeTolerancePercent of the source plus verifySizeSlackPerMessage
+// bytes per message still match.
+const (
+	verifySizeTolerancePercent = 2
+	verifySizeSlackPerMessage  = 512
+)
+
+// sizesMatch compares the total sizes of a folder within the tolerance.
+func sizesMatch(srcBytes int64, dstBytes int64, messages int) bool {
+	diff := dstBytes - srcBytes
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff <= srcBytes*verifySizeTolerancePercent/100+int64(messages)*verifySizeSlackPerMessage
+}
+
+// folderContents is what one side holds in a folder, Message-IDs counted so
+// duplicates on one side are told apart.
+type folderContents struct {
+	messages         int
+	bytes            int64
+	withoutMessageId int
+	messageIds       map[string]int
+}
+
+func readFolderContents(ctx context.Context, c *client.Client, folderName string) (*folderContents, error) {
+	contents := &folderContents{messageIds: make(map[string]int)}
+
+	folder, err := c.Select(folderName, true)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := fetchAll(ctx, c, folder.Messages, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range messages {
+		if hasFlag(msg.Flags, imap.DeletedFlag) {
+			continue
+		}
+
+		contents.messages++
+		contents.bytes += int64(msg.Size)
+
+		messageId := normalizeMessageId(msg.Envelope)
+		if messageId == "" {
+			contents.withoutMessageId++
+			continue
+		}
+		contents.messageIds[messageId]++
+	}
+
+	return contents, nil
+}
+
+func verifyFolder(ctx context.Context, srcClient *client.Client, dstClient *client.Client, folderName string, dstExists bool) (models.FolderReport, error) {
+	report := models.FolderReport{Folder: folderName}
+
+	src, err := readFolderContents(ctx, srcClient, folderName)
+	if err != nil {
+		slog.Debug("Failed to read folder", "connection", "source", "folder", folderName, "error", err)
+		return report, err
+	}
+
+	dst := &folderContents{messageIds: make(map[string]int)}
+	if dstExists {
+		dst, err = readFolderContents(ctx, dstClient, folderName)
+		if err != nil {
+			slog.Debug("Failed to read folder", "connection", "destination", "folder", folderName, "error", err)
+			return report, err
+		}
+	}
+
+	report.SourceMessages = src.messages
+	report.DestinationMessages = dst.messages
+	report.SourceBytes = src.bytes
+	report.DestinationBytes = dst.bytes
+	report.WithoutMessageId = src.withoutMessageId
+
+	for messageId, count := range src.messageIds {
+		if missing := count - dst.messageIds[messageId]; missing > 0 {
+			report.Missing += missing
+			if len(report.MissingIds) < verifyIdLimit {
+				report.MissingIds = append(report.MissingIds, messageId)
+			}
+		}
+	}
+
+	for messageId, count := range dst.messageIds {
+		if extra := count - src.messageIds[messageId]; extra > 0 {
+			report.Extra += extra
+			if len(report.ExtraIds) < verifyIdLimit {
+				report.ExtraIds = append(report.ExtraIds, messageId)
+			}
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import "testing"
+
+func TestSizesMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		srcBytes int64
+		dstBytes int64
+		messages int
+		want     bool
+	}{
+		{"equal", 1_000_000, 1_000_000, 10, true},
+		{"empty folders", 0, 0, 0, true},
+		{"within the percentage", 1_000_000, 1_020_000, 0, true},
+		{"beyond the percentage", 1_000_000, 1_020_001, 0, false},
+		{"smaller within the percentage", 1_000_000, 980_000, 0, true},
+		{"smaller beyond the percentage", 1_000_000, 979_999, 0, false},
+		{"slack per message", 1_000, 1_000 + 20 + 3*512, 3, true},
+		{"beyond the slack", 1_000, 1_000 + 20 + 3*512 + 1, 3, false},
+		{"destination empty", 50_000, 0, 10, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sizesMatch(tt.srcBytes, tt.dstBytes, tt.messages); got != tt.want {
+				t.Errorf("sizesMatch(%d, %d, %d) = %v, want %v", tt.srcBytes, tt.dstBytes, tt.messages, got, tt.want)
+			}
+		})
+	}
+}
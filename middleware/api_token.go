@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"app/errorsx"
+	"app/helpers"
+	"app/models"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+)
+
+// WithApiTokenRequired authenticates requests with a personal access token
+// sent as "Authorization: Bearer <token>". Safe methods require the read
+// scope, everything else requires the write scope.
+func WithApiTokenRequired(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		rawToken, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if !ok || rawToken == "" {
+			return helpers.Problem(c, http.StatusUnauthorized, helpers.MsgErrUnauthenticated)
+		}
+
+		token, err := models.FindApiTokenByTokenHashWithUser(c.Request().Context(), helpers.HashToken(rawToken))
+		if err != nil {
+			if !errorsx.IsNotFoundError(err) {
+				slog.Error("failed to find api token", "error", err)
+				return helpers.Problem(c, http.StatusInternalServerError, helpers.MsgErrGeneric)
+			}
+
+			return helpers.Problem(c, http.StatusUnauthorized, helpers.MsgErrUnauthenticated)
+		}
+
+		if token.User == nil || !token.User.Confirmed {
+			return helpers.Problem(c, http.StatusUnauthorized, helpers.MsgErrUnauthenticated)
+		}
+
+		scope := models.ApiTokenScopeWrite
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			scope = models.ApiTokenScopeRead
+		}
+
+		if !token.HasScope(scope) {
+			return helpers.Problem(c, http.StatusForbidden, helpers.MsgErrInsufficientScope)
+		}
+
+		err = models.TouchApiToken(c.Request().Context(), token.Id)
+		if err != nil {
+			slog.Error("failed to update api token last use", "error", err)
+		}
+
+		userData := &helpers.UserSessionData{
+			Id:    token.User.Id,
+			Email: token.User.Email,
+		}
+		helpers.SetRequestUserData(c, userData)
+
+		ctx := context.WithValue(c.Request().Context(), helpers.TemplContextSessionKey, userData)
+		c.SetRequest(c.Request().WithContext(ctx))
+
+		return next(c)
+	}
+}
@@ -3,14 +3,23 @@ package middleware
 import (
 	"app/helpers"
 	"context"
+	"net/http"
 
 	"github.com/labstack/echo/v5"
 )
 
 func WithAuthRequired(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c *echo.Context) error {
+		if helpers.HasBearerToken(c) {
+			return WithApiTokenRequired(next)(c)
+		}
+
 		userSession := helpers.GetUserSessionData(c)
 		if userSession == nil {
+			if helpers.WantsJSON(c) {
+				return helpers.Problem(c, http.StatusUnauthorized, helpers.MsgErrUnauthenticated)
+			}
+
 			co, err := c.Cookie(helpers.GetSessionKey())
 			if err == nil {
 				co.MaxAge = -1
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE webhooks (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL,
+  url VARCHAR(2048) NOT NULL,
+  secret_hash VARCHAR(255) NOT NULL,
+  events JSONB NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_deliveries (
+  id SERIAL PRIMARY KEY,
+  webhook_id INT NOT NULL,
+  event VARCHAR(255) NOT NULL,
+  payload JSONB NOT NULL,
+  status VARCHAR(255) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  response_status INT DEFAULT NULL,
+  error VARCHAR(1024) DEFAULT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  delivered_at TIMESTAMP DEFAULT NULL,
+  FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS webhook_deliveries;
+
+DROP TABLE IF EXISTS webhooks;
+
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE webhook_deliveries ALTER COLUMN error TYPE TEXT;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE webhook_deliveries ALTER COLUMN error TYPE VARCHAR(1024) USING LEFT(error, 1024);
+
+-- +goose StatementEnd
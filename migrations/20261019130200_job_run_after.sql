@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE jobs ADD COLUMN run_after TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX jobs_run_after_idx ON jobs (run_after) WHERE run_after IS NOT NULL;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS jobs_run_after_idx;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS run_after;
+
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN notification_preference VARCHAR(255) NOT NULL DEFAULT 'off';
+
+ALTER TABLE sync_lists ADD COLUMN notified_at TIMESTAMP NULL DEFAULT NULL;
+
+ALTER TABLE mailboxes ADD COLUMN last_run_messages INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE mailboxes DROP COLUMN IF EXISTS last_run_messages;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS notified_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS notification_preference;
+
+-- +goose StatementEnd
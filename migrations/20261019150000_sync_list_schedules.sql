@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN schedule VARCHAR(255) NULL DEFAULT NULL;
+
+ALTER TABLE sync_lists ADD COLUMN next_run_at TIMESTAMP NULL DEFAULT NULL;
+
+ALTER TABLE sync_lists ADD COLUMN last_run_at TIMESTAMP NULL DEFAULT NULL;
+
+CREATE INDEX sync_lists_next_run_at_idx ON sync_lists (next_run_at) WHERE next_run_at IS NOT NULL;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS sync_lists_next_run_at_idx;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS last_run_at;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS next_run_at;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS schedule;
+
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN final_sync_started_at TIMESTAMP NULL DEFAULT NULL;
+
+ALTER TABLE sync_lists ADD COLUMN cut_over_at TIMESTAMP NULL DEFAULT NULL;
+
+CREATE TABLE reports (
+  id SERIAL PRIMARY KEY,
+  sync_list_id INT NOT NULL,
+  mailbox_id INT NULL DEFAULT NULL,
+  type VARCHAR(255) NOT NULL,
+  passed BOOLEAN NOT NULL,
+  data JSONB NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (sync_list_id) REFERENCES sync_lists (id) ON DELETE CASCADE,
+  FOREIGN KEY (mailbox_id) REFERENCES mailboxes (id) ON DELETE CASCADE
+);
+
+CREATE INDEX reports_sync_list_id_idx ON reports (sync_list_id, created_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS reports;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS cut_over_at;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS final_sync_started_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE mailboxes ADD COLUMN folder_highest_mod_seq JSONB NOT NULL DEFAULT '{}';
+
+CREATE TABLE message_maps (
+  id BIGSERIAL PRIMARY KEY,
+  mailbox_id INT NOT NULL,
+  folder VARCHAR(255) NOT NULL,
+  src_uid BIGINT NOT NULL,
+  dst_uid BIGINT NULL DEFAULT NULL,
+  message_id VARCHAR(998) NULL DEFAULT NULL,
+  FOREIGN KEY (mailbox_id) REFERENCES mailboxes (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX message_maps_mailbox_id_folder_src_uid_idx ON message_maps (mailbox_id, folder, src_uid);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_maps;
+
+ALTER TABLE mailboxes DROP COLUMN IF EXISTS folder_highest_mod_seq;
+
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN sync_flags BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS sync_flags;
+
+-- +goose StatementEnd
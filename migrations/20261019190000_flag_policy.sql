@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN flag_renames JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE sync_lists ADD COLUMN keep_deleted_flags BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS keep_deleted_flags;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS flag_renames;
+
+-- +goose StatementEnd
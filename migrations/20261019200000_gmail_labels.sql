@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN gmail_label_mode VARCHAR(16) NOT NULL DEFAULT 'off';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS gmail_label_mode;
+
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN two_way BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE sync_lists ADD COLUMN deletion_policy VARCHAR(16) NOT NULL DEFAULT 'keep';
+
+ALTER TABLE mailboxes ADD COLUMN folder_dst_last_uid JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE mailboxes ADD COLUMN folder_dst_uid_validity JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX message_maps_mailbox_id_folder_dst_uid_idx ON message_maps (mailbox_id, folder, dst_uid);
+
+CREATE INDEX message_maps_mailbox_id_folder_message_id_idx ON message_maps (mailbox_id, folder, message_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS message_maps_mailbox_id_folder_message_id_idx;
+
+DROP INDEX IF EXISTS message_maps_mailbox_id_folder_dst_uid_idx;
+
+ALTER TABLE mailboxes DROP COLUMN IF EXISTS folder_dst_uid_validity;
+
+ALTER TABLE mailboxes DROP COLUMN IF EXISTS folder_dst_last_uid;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS deletion_policy;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS two_way;
+
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN mirror BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE sync_lists ADD COLUMN mirror_max_delete_percent INT NOT NULL DEFAULT 10;
+
+ALTER TABLE sync_lists ADD COLUMN mirror_dry_run BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS mirror_dry_run;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS mirror_max_delete_percent;
+
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS mirror;
+
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN content_dedup VARCHAR(16) NOT NULL DEFAULT 'off';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS content_dedup;
+
+-- +goose StatementEnd
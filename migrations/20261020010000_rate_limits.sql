@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN max_bytes_per_second INT NOT NULL DEFAULT 0;
+ALTER TABLE sync_lists ADD COLUMN max_messages_per_second INT NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS max_messages_per_second;
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS max_bytes_per_second;
+
+-- +goose StatementEnd
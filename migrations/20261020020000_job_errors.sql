@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE jobs ALTER COLUMN error TYPE TEXT;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE jobs ALTER COLUMN error TYPE VARCHAR(255) USING LEFT(error, 255);
+
+-- +goose StatementEnd
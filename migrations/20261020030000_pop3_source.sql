@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_lists ADD COLUMN src_protocol VARCHAR(16) NOT NULL DEFAULT 'imap';
+ALTER TABLE mailboxes ADD COLUMN pop3_uidls JSONB NOT NULL DEFAULT '{}';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE mailboxes DROP COLUMN IF EXISTS pop3_uidls;
+ALTER TABLE sync_lists DROP COLUMN IF EXISTS src_protocol;
+
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE archives (
+  id SERIAL PRIMARY KEY,
+  mailbox_id INT NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  format VARCHAR(16) NOT NULL,
+  path VARCHAR(2048) NOT NULL,
+  size BIGINT NOT NULL DEFAULT 0,
+  messages INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (mailbox_id) REFERENCES mailboxes (id) ON DELETE CASCADE
+);
+
+CREATE INDEX archives_mailbox_id_idx ON archives (mailbox_id, created_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS archives;
+
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE archives ADD COLUMN expires_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX archives_expires_at_idx ON archives (expires_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS archives_expires_at_idx;
+
+ALTER TABLE archives DROP COLUMN IF EXISTS expires_at;
+
+-- +goose StatementEnd
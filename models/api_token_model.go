@@ -0,0 +1,118 @@
+package models
+
+import (
+	"app/db"
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type ApiTokenScope string
+
+const (
+	ApiTokenScopeRead  ApiTokenScope = "read"
+	ApiTokenScopeWrite ApiTokenScope = "write"
+)
+
+var ApiTokenScopes = []ApiTokenScope{ApiTokenScopeRead, ApiTokenScopeWrite}
+
+type ApiToken struct {
+	bun.BaseModel `bun:"table:api_tokens"`
+
+	Id         int `bun:",pk,autoincrement"`
+	UserId     int
+	Name       string
+	TokenHash  string
+	Scopes     []ApiTokenScope
+	LastUsedAt *time.Time `bun:",nullzero"`
+	CreatedAt  time.Time  `bun:",default:current_timestamp"`
+
+	User *User `bun:"rel:belongs-to,join:user_id=id"`
+}
+
+func (t *ApiToken) HasScope(scope ApiTokenScope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func CreateApiToken(ctx context.Context, userId int, name string, tokenHash string, scopes []ApiTokenScope) (*ApiToken, error) {
+	token := &ApiToken{
+		UserId:    userId,
+		Name:      name,
+		TokenHash: tokenHash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := db.Bun.
+		NewInsert().
+		Model(token).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func FindApiTokenByTokenHashWithUser(ctx context.Context, tokenHash string) (*ApiToken, error) {
+	token := new(ApiToken)
+
+	err := db.Bun.
+		NewSelect().
+		Model(token).
+		Where("api_token.token_hash = ?", tokenHash).
+		Relation("User").
+		Scan(ctx)
+
+	return token, err
+}
+
+func FindApiTokensByUserId(ctx context.Context, userId int) ([]*ApiToken, error) {
+	tokens := make([]*ApiToken, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&tokens).
+		Where("user_id = ?", userId).
+		OrderBy("created_at", bun.OrderDesc).
+		Scan(ctx)
+
+	return tokens, err
+}
+
+func TouchApiToken(ctx context.Context, id int) error {
+	_, err := db.Bun.
+		NewUpdate().
+		Model((*ApiToken)(nil)).
+		Set("last_used_at = ?", time.Now()).
+		Where("id = ?", id).
+		Exec(ctx)
+
+	return err
+}
+
+func DeleteApiTokenByIdAndUserId(ctx context.Context, id int, userId int) error {
+	res, err := db.Bun.
+		NewDelete().
+		Model((*ApiToken)(nil)).
+		Where("id = ?", id).
+		Where("user_id = ?", userId).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
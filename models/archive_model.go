@@ -0,0 +1,163 @@
+package models
+
+import (
+	"app/db"
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type ArchiveKind string
+
+const (
+	ArchiveKindImport ArchiveKind = "import"
+	ArchiveKindExport ArchiveKind = "export"
+)
+
+type ArchiveFormat string
+
+const (
+	// One file per folder
+	ArchiveFormatMbox ArchiveFormat = "mbox"
+	// One directory per folder with a file per message
+	ArchiveFormatMaildir ArchiveFormat = "maildir"
+	// A file per message with a manifest of folders, flags and dates
+	ArchiveFormatEml ArchiveFormat = "eml"
+)
+
+var (
+	ImportArchiveFormats = []ArchiveFormat{ArchiveFormatMbox, ArchiveFormatMaildir}
+	ExportArchiveFormats = []ArchiveFormat{ArchiveFormatMbox, ArchiveFormatMaildir, ArchiveFormatEml}
+)
+
+// Directories of the archive directory the app writes to
+const (
+	ArchiveUploadDir = "uploads"
+	ArchiveExportDir = "exports"
+)
+
+// Archive is a file or directory of mail under config.Config.ArchiveDir, read
+// into a mailbox's destination by an import job or written from its source
+// by an export job.
+type Archive struct {
+	bun.BaseModel `bun:"table:archives"`
+
+	Id        int `bun:",pk,autoincrement"`
+	MailboxId int
+	Kind      ArchiveKind
+	Format    ArchiveFormat
+	// Relative to config.Config.ArchiveDir
+	Path      string
+	Size      int64
+	Messages  int
+	CreatedAt time.Time  `bun:",default:current_timestamp"`
+	ExpiresAt *time.Time `bun:",nullzero"`
+
+	Mailbox *Mailbox `bun:"rel:belongs-to,join:mailbox_id=id"`
+}
+
+// IsStored reports whether the app wrote the files of the archive, uploads
+// and exports are deleted with it. Server paths given for an import are left
+// alone.
+func (a *Archive) IsStored() bool {
+	return a.Kind == ArchiveKindExport || strings.HasPrefix(a.Path, ArchiveUploadDir+string(filepath.Separator))
+}
+
+func CreateArchive(ctx context.Context, mailboxId int, kind ArchiveKind, format ArchiveFormat, path string, size int64, expiresAt *time.Time) (*Archive, error) {
+	archive := &Archive{
+		MailboxId: mailboxId,
+		Kind:      kind,
+		Format:    format,
+		Path:      path,
+		Size:      size,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	_, err := db.Bun.
+		NewInsert().
+		Model(archive).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+func FindArchiveById(ctx context.Context, id int) (*Archive, error) {
+	archive := new(Archive)
+
+	err := db.Bun.
+		NewSelect().
+		Model(archive).
+		Where("id = ?", id).
+		Scan(ctx)
+
+	return archive, err
+}
+
+func FindArchivesByMailboxId(ctx context.Context, mailboxId int) ([]*Archive, error) {
+	archives := make([]*Archive, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&archives).
+		Where("mailbox_id = ?", mailboxId).
+		OrderBy("created_at", bun.OrderDesc).
+		OrderBy("id", bun.OrderDesc).
+		Scan(ctx)
+
+	return archives, err
+}
+
+func FindArchivesByMailboxIds(ctx context.Context, mailboxIds []int) ([]*Archive, error) {
+	archives := make([]*Archive, 0)
+	if len(mailboxIds) == 0 {
+		return archives, nil
+	}
+
+	err := db.Bun.
+		NewSelect().
+		Model(&archives).
+		Where("mailbox_id IN (?)", bun.In(mailboxIds)).
+		Scan(ctx)
+
+	return archives, err
+}
+
+func FindExpiredArchives(ctx context.Context, now time.Time) ([]*Archive, error) {
+	archives := make([]*Archive, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&archives).
+		Where("expires_at IS NOT NULL").
+		Where("expires_at < ?", now).
+		Scan(ctx)
+
+	return archives, err
+}
+
+func UpdateArchive(ctx context.Context, archive *Archive) error {
+	_, err := db.Bun.
+		NewUpdate().
+		Model(archive).
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+func DeleteArchive(ctx context.Context, id int) error {
+	_, err := db.Bun.
+		NewDelete().
+		Model(new(Archive)).
+		Where("id = ?", id).
+		Exec(ctx)
+
+	return err
+}
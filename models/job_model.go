@@ -2,6 +2,7 @@ package models
 
 import (
 	"app/db"
+	"app/helpers"
 	"context"
 	"encoding/json"
 	"time"
@@ -36,6 +37,13 @@ type Job struct {
 	CreatedAt    time.Time        `bun:",default:current_timestamp"`
 	StartedAt    *time.Time       `bun:",nullzero"`
 	FinishedAt   *time.Time       `bun:",nullzero"`
+	// Pending jobs are not picked up before this time
+	RunAfter *time.Time `bun:",nullzero"`
+}
+
+type JobsPaginated struct {
+	Jobs       []*Job
+	Pagination helpers.Pagination
 }
 
 func CreateJob(ctx context.Context, userId int, jobType JobType, payload *json.RawMessage) (*Job, error) {
@@ -80,6 +88,31 @@ func CreateJobWithRelated(ctx context.Context, userId int, jobType JobType, rela
 	return job, nil
 }
 
+// CreateDelayedJobWithRelated queues a job that waits until runAfter,
+// ReleaseDelayedJobs hands it to the workers once it is due.
+func CreateDelayedJobWithRelated(ctx context.Context, userId int, jobType JobType, relatedTable string, relatedId int, payload *json.RawMessage, runAfter time.Time) (*Job, error) {
+	job := &Job{
+		UserId:       userId,
+		RelatedTable: &relatedTable,
+		RelatedId:    &relatedId,
+		Type:         jobType,
+		Status:       JobStatusPending,
+		Payload:      payload,
+		CreatedAt:    time.Now(),
+		RunAfter:     &runAfter,
+	}
+
+	_, err := db.Bun.
+		NewInsert().
+		Model(job).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
 func CreateJobsWithRelated(ctx context.Context, userId int, jobType JobType, relatedTable string, relatedIds []int, payloads []*json.RawMessage) ([]*Job, error) {
 	jobs := make([]*Job, 0, len(relatedIds))
 
@@ -149,6 +182,38 @@ func FindJobsByIdsMap(ctx context.Context, ids []int) (map[int]*Job, error) {
 	return jobsMap, err
 }
 
+func FindJobsByUserIdPaginated(ctx context.Context, userId int, page int) (*JobsPaginated, error) {
+	jobs := make([]*Job, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&jobs).
+		Where("user_id = ?", userId).
+		Limit(helpers.PaginationLimit).
+		Offset((page-1)*helpers.PaginationLimit).
+		OrderBy("created_at", bun.OrderDesc).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := db.Bun.
+		NewSelect().
+		Model((*Job)(nil)).
+		Where("user_id = ?", userId).
+		Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	jobsPaginated := &JobsPaginated{
+		Jobs:       jobs,
+		Pagination: helpers.NewPagination(page, total),
+	}
+
+	return jobsPaginated, nil
+}
+
 func FindJobByRelated(ctx context.Context, relatedTable string, relatedId int) (*Job, error) {
 	job := new(Job)
 
@@ -162,6 +227,22 @@ func FindJobByRelated(ctx context.Context, relatedTable string, relatedId int) (
 	return job, err
 }
 
+// FindJobByRelatedAndType tells apart jobs of different types sharing a
+// related row, such as the live sync and plan jobs of a sync list.
+func FindJobByRelatedAndType(ctx context.Context, relatedTable string, relatedId int, jobType JobType) (*Job, error) {
+	job := new(Job)
+
+	err := db.Bun.
+		NewSelect().
+		Model(job).
+		Where("related_table = ?", relatedTable).
+		Where("related_id = ?", relatedId).
+		Where("type = ?", jobType).
+		Scan(ctx)
+
+	return job, err
+}
+
 func FindJobsByRelated(ctx context.Context, relatedTable string, relatedId int) ([]*Job, error) {
 	jobs := make([]*Job, 0)
 
@@ -218,7 +299,7 @@ func FindJobsByManyRelatedMap(ctx context.Context, relatedTable string, relatedI
 
 	jobsMap := make(map[int][]*Job, len(jobs))
 	for _, job := range jobs {
-		jobsMap[job.Id] = append(jobsMap[job.Id], job)
+		jobsMap[*job.RelatedId] = append(jobsMap[*job.RelatedId], job)
 	}
 
 	return jobsMap, err
@@ -231,6 +312,7 @@ func FindPendingJob(ctx context.Context) (*Job, error) {
 		NewSelect().
 		Model(job).
 		Where("status = ?", JobStatusPending).
+		Where("run_after IS NULL").
 		OrderBy("created_at", bun.OrderAsc).
 		Limit(1).
 		Scan(ctx)
@@ -238,6 +320,20 @@ func FindPendingJob(ctx context.Context) (*Job, error) {
 	return job, err
 }
 
+// ReleaseDelayedJobs clears the wait of pending jobs due at now, the update
+// notifies the workers like a new job.
+func ReleaseDelayedJobs(ctx context.Context, now time.Time) error {
+	_, err := db.Bun.
+		NewUpdate().
+		Model((*Job)(nil)).
+		Set("run_after = NULL").
+		Where("status = ?", JobStatusPending).
+		Where("run_after <= ?", now).
+		Exec(ctx)
+
+	return err
+}
+
 func UpdateJob(ctx context.Context, job *Job) error {
 	_, err := db.Bun.
 		NewUpdate().
@@ -19,6 +19,15 @@ type Mailbox struct {
 	DstPasswordHash   string
 	FolderLastUid     map[string]uint32
 	FolderUidValidity map[string]uint32
+	// Only tracked when both servers support CONDSTORE
+	FolderHighestModSeq map[string]uint64
+	// Destination side of two-way sync lists
+	FolderDstLastUid     map[string]uint32
+	FolderDstUidValidity map[string]uint32
+	LastRunMessages      int
+	// UIDLs of the POP3 source messages copied, with their destination uid
+	// when known
+	Pop3Uidls map[string]uint32
 
 	SyncList *SyncList `bun:"rel:belongs-to,join:sync_list_id=id"`
 }
@@ -30,13 +39,17 @@ type MailboxesPaginated struct {
 
 func CreateMailbox(ctx context.Context, syncListId int, srcUser string, srcPasswordHash string, dstUser string, dstPasswordHash string) (*Mailbox, error) {
 	Mailbox := &Mailbox{
-		SyncListId:        syncListId,
-		SrcUser:           srcUser,
-		SrcPasswordHash:   srcPasswordHash,
-		DstUser:           dstUser,
-		DstPasswordHash:   dstPasswordHash,
-		FolderLastUid:     make(map[string]uint32),
-		FolderUidValidity: make(map[string]uint32),
+		SyncListId:           syncListId,
+		SrcUser:              srcUser,
+		SrcPasswordHash:      srcPasswordHash,
+		DstUser:              dstUser,
+		DstPasswordHash:      dstPasswordHash,
+		FolderLastUid:        make(map[string]uint32),
+		FolderUidValidity:    make(map[string]uint32),
+		FolderHighestModSeq:  make(map[string]uint64),
+		FolderDstLastUid:     make(map[string]uint32),
+		FolderDstUidValidity: make(map[string]uint32),
+		Pop3Uidls:            make(map[string]uint32),
 	}
 
 	_, err := db.Bun.
@@ -105,7 +118,6 @@ func FindMailboxesBySyncListId(ctx context.Context, syncListId int) ([]*Mailbox,
 		NewSelect().
 		Model(&Mailboxes).
 		Where("sync_list_id = ?", syncListId).
-		Limit(helpers.PaginationLimit).
 		OrderBy("src_user", bun.OrderAsc).
 		OrderBy("dst_user", bun.OrderAsc).
 		Scan(ctx)
@@ -129,6 +141,38 @@ func UpdateMailbox(ctx context.Context, Mailbox *Mailbox) error {
 	return nil
 }
 
+// UpdateMailboxAccounts only writes the users and passwords, so an edit made
+// while a job runs does not overwrite the folder state the job persists.
+func UpdateMailboxAccounts(ctx context.Context, mailbox *Mailbox) error {
+	_, err := db.Bun.
+		NewUpdate().
+		Model(mailbox).
+		Column("src_user", "src_password_hash", "dst_user", "dst_password_hash").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateMailboxFolderState only writes the per folder sync state, so it does
+// not overwrite credentials edited while a job is running.
+func UpdateMailboxFolderState(ctx context.Context, mailbox *Mailbox) error {
+	_, err := db.Bun.
+		NewUpdate().
+		Model(mailbox).
+		Column("folder_last_uid", "folder_uid_validity", "folder_highest_mod_seq").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func DeleteMailbox(ctx context.Context, id int) error {
 	Mailbox := &Mailbox{Id: id}
 
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"app/db"
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// MessageMap links a copied source message to its destination copy. DstUid
+// is only known when the destination returns APPENDUID.
+type MessageMap struct {
+	bun.BaseModel `bun:"table:message_maps"`
+
+	Id        int64 `bun:",pk,autoincrement"`
+	MailboxId int
+	Folder    string
+	SrcUid    uint32
+	DstUid    *uint32 `bun:",nullzero"`
+	MessageId *string `bun:",nullzero"`
+}
+
+func UpsertMessageMaps(ctx context.Context, maps []*MessageMap) error {
+	if len(maps) == 0 {
+		return nil
+	}
+
+	_, err := db.Bun.
+		NewInsert().
+		Model(&maps).
+		On("CONFLICT (mailbox_id, folder, src_uid) DO UPDATE").
+		Set("dst_uid = EXCLUDED.dst_uid").
+		Set("message_id = EXCLUDED.message_id").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func FindMessageMapsBySrcUids(ctx context.Context, mailboxId int, folder string, srcUids []uint32) (map[uint32]*MessageMap, error) {
+	maps := make([]*MessageMap, 0)
+	result := make(map[uint32]*MessageMap)
+
+	if len(srcUids) == 0 {
+		return result, nil
+	}
+
+	err := db.Bun.
+		NewSelect().
+		Model(&maps).
+		Where("mailbox_id = ?", mailboxId).
+		Where("folder = ?", folder).
+		Where("src_uid IN (?)", bun.In(srcUids)).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range maps {
+		result[m.SrcUid] = m
+	}
+
+	return result, nil
+}
+
+func DeleteMessageMapsBySrcUids(ctx context.Context, mailboxId int, folder string, srcUids []uint32) error {
+	if len(srcUids) == 0 {
+		return nil
+	}
+
+	_, err := db.Bun.
+		NewDelete().
+		Model(new(MessageMap)).
+		Where("mailbox_id = ?", mailboxId).
+		Where("folder = ?", folder).
+		Where("src_uid IN (?)", bun.In(srcUids)).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteMessageMapsByFolder drops the mapping of a folder whose UIDVALIDITY
+// changed, its uids no longer refer to the same messages.
+func DeleteMessageMapsByFolder(ctx context.Context, mailboxId int, folder string) error {
+	_, err := db.Bun.
+		NewDelete().
+		Model(new(MessageMap)).
+		Where("mailbox_id = ?", mailboxId).
+		Where("folder = ?", folder).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func FindMessageMapsByDstUids(ctx context.Context, mailboxId int, folder string, dstUids []uint32) (map[uint32]*MessageMap, error) {
+	maps := make([]*MessageMap, 0)
+	result := make(map[uint32]*MessageMap)
+
+	if len(dstUids) == 0 {
+		return result, nil
+	}
+
+	err := db.Bun.
+		NewSelect().
+		Model(&maps).
+		Where("mailbox_id = ?", mailboxId).
+		Where("folder = ?", folder).
+		Where("dst_uid IN (?)", bun.In(dstUids)).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range maps {
+		result[*m.DstUid] = m
+	}
+
+	return result, nil
+}
+
+func FindMessageMapsByMessageIds(ctx context.Context, mailboxId int, folder string, messageIds []string) (map[string]*MessageMap, error) {
+	maps := make([]*MessageMap, 0)
+	result := make(map[string]*MessageMap)
+
+	if len(messageIds) == 0 {
+		return result, nil
+	}
+
+	err := db.Bun.
+		NewSelect().
+		Model(&maps).
+		Where("mailbox_id = ?", mailboxId).
+		Where("folder = ?", folder).
+		Where("message_id IN (?)", bun.In(messageIds)).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range maps {
+		result[*m.MessageId] = m
+	}
+
+	return result, nil
+}
+
+func FindMessageMapsByFolder(ctx context.Context, mailboxId int, folder string) ([]*MessageMap, error) {
+	maps := make([]*MessageMap, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&maps).
+		Where("mailbox_id = ?", mailboxId).
+		Where("folder = ?", folder).
+		OrderBy("src_uid", bun.OrderAsc).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return maps, nil
+}
+
+func DeleteMessageMapsByIds(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := db.Bun.
+		NewDelete().
+		Model(new(MessageMap)).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClearMessageMapDstUids forgets the destination uids of a folder whose
+// destination UIDVALIDITY changed.
+func ClearMessageMapDstUids(ctx context.Context, mailboxId int, folder string) error {
+	_, err := db.Bun.
+		NewUpdate().
+		Model(new(MessageMap)).
+		Set("dst_uid = NULL").
+		Where("mailbox_id = ?", mailboxId).
+		Where("folder = ?", folder).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
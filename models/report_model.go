@@ -0,0 +1,176 @@
+package models
+
+import (
+	"app/db"
+	"app/helpers"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type ReportType string
+
+const (
+	ReportTypeFinalSync     ReportType = "final_sync"
+	ReportTypeMirror        ReportType = "mirror"
+	ReportTypeMirrorPreview ReportType = "mirror_preview"
+	ReportTypePlan          ReportType = "plan"
+	ReportTypeQuota         ReportType = "quota"
+	ReportTypeVerification  ReportType = "verification"
+)
+
+type Report struct {
+	bun.BaseModel `bun:"table:reports"`
+
+	Id         int `bun:",pk,autoincrement"`
+	SyncListId int
+	MailboxId  *int `bun:",nullzero"`
+	Type       ReportType
+	Passed     bool
+	Data       json.RawMessage
+	CreatedAt  time.Time `bun:",default:current_timestamp"`
+
+	Mailbox *Mailbox `bun:"rel:belongs-to,join:mailbox_id=id"`
+}
+
+type ReportsPaginated struct {
+	Reports    []*Report
+	Pagination helpers.Pagination
+}
+
+// FolderReport is the outcome of a pass over one folder of a mailbox.
+type FolderReport struct {
+	Folder              string `json:"folder"`
+	SourceMessages      int    `json:"sourceMessages"`
+	DestinationMessages int    `json:"destinationMessages"`
+	Copied              int    `json:"copied"`
+	Duplicates          int    `json:"duplicates"`
+	FlagsUpdated        int    `json:"flagsUpdated"`
+	WithoutMessageId    int    `json:"withoutMessageId"`
+	// Mirror runs only
+	Deleted       int      `json:"deleted"`
+	FolderDeleted bool     `json:"folderDeleted"`
+	Deletions     []string `json:"deletions,omitempty"`
+	// Expunged at the source without a recorded destination uid, their copy
+	// is kept
+	Unresolved    int      `json:"unresolved"`
+	UnresolvedIds []string `json:"unresolvedIds,omitempty"`
+	// Verification runs only
+	SourceBytes      int64    `json:"sourceBytes"`
+	DestinationBytes int64    `json:"destinationBytes"`
+	Missing          int      `json:"missing"`
+	Extra            int      `json:"extra"`
+	MissingIds       []string `json:"missingIds,omitempty"`
+	ExtraIds         []string `json:"extraIds,omitempty"`
+}
+
+type MailboxReportData struct {
+	Folders       []FolderReport `json:"folders"`
+	Discrepancies []string       `json:"discrepancies"`
+}
+
+// PlanFolder counts what a migration would do with one source folder.
+type PlanFolder struct {
+	Folder    string `json:"folder"`
+	Messages  int    `json:"messages"`
+	Copy      int    `json:"copy"`
+	CopyBytes int64  `json:"copyBytes"`
+	Skip      int    `json:"skip"`
+	SkipBytes int64  `json:"skipBytes"`
+}
+
+type MailboxPlan struct {
+	MailboxId int          `json:"mailboxId"`
+	SrcUser   string       `json:"srcUser"`
+	DstUser   string       `json:"dstUser"`
+	Folders   []PlanFolder `json:"folders"`
+	Error     string       `json:"error,omitempty"`
+	// Storage quota of the destination, 0 when it reports none
+	QuotaUsed    int64  `json:"quotaUsed,omitempty"`
+	QuotaLimit   int64  `json:"quotaLimit,omitempty"`
+	QuotaWarning string `json:"quotaWarning,omitempty"`
+}
+
+// PlanReportData is stored on the sync list, one report covers every mailbox.
+type PlanReportData struct {
+	Mailboxes []MailboxPlan `json:"mailboxes"`
+	Copy      int           `json:"copy"`
+	CopyBytes int64         `json:"copyBytes"`
+	Skip      int           `json:"skip"`
+	SkipBytes int64         `json:"skipBytes"`
+}
+
+func CreateReport(ctx context.Context, syncListId int, mailboxId *int, reportType ReportType, passed bool, data any) (*Report, error) {
+	dataJson, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		SyncListId: syncListId,
+		MailboxId:  mailboxId,
+		Type:       reportType,
+		Passed:     passed,
+		Data:       dataJson,
+		CreatedAt:  time.Now(),
+	}
+
+	_, err = db.Bun.
+		NewInsert().
+		Model(report).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func FindReportByIdWithMailbox(ctx context.Context, id int) (*Report, error) {
+	report := new(Report)
+
+	err := db.Bun.
+		NewSelect().
+		Model(report).
+		Relation("Mailbox").
+		Where("report.id = ?", id).
+		Scan(ctx)
+
+	return report, err
+}
+
+func FindReportsBySyncListIdPaginated(ctx context.Context, syncListId int, page int) (*ReportsPaginated, error) {
+	reports := make([]*Report, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&reports).
+		Relation("Mailbox").
+		Where("report.sync_list_id = ?", syncListId).
+		Limit(helpers.PaginationLimit).
+		Offset((page-1)*helpers.PaginationLimit).
+		OrderBy("report.created_at", bun.OrderDesc).
+		OrderBy("report.id", bun.OrderDesc).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := db.Bun.
+		NewSelect().
+		Model((*Report)(nil)).
+		Where("sync_list_id = ?", syncListId).
+		Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reportsPaginated := &ReportsPaginated{
+		Reports:    reports,
+		Pagination: helpers.NewPagination(page, total),
+	}
+
+	return reportsPaginated, nil
+}
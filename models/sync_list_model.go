@@ -4,22 +4,113 @@ import (
 	"app/db"
 	"app/helpers"
 	"context"
+	"time"
 
 	"github.com/uptrace/bun"
 )
 
+// SourceProtocol is how the source server is read. POP3 sources only have
+// an inbox, which is copied to the destination INBOX.
+type SourceProtocol string
+
+const (
+	SourceProtocolImap SourceProtocol = "imap"
+	SourceProtocolPop3 SourceProtocol = "pop3"
+)
+
+var SourceProtocols = []SourceProtocol{
+	SourceProtocolImap,
+	SourceProtocolPop3,
+}
+
+// GmailLabelMode selects how labels are migrated from a Gmail source.
+// Outside GmailLabelModeOff the source is read once from All Mail.
+type GmailLabelMode string
+
+const (
+	GmailLabelModeOff      GmailLabelMode = "off"
+	GmailLabelModeFolders  GmailLabelMode = "folders"
+	GmailLabelModeKeywords GmailLabelMode = "keywords"
+)
+
+var GmailLabelModes = []GmailLabelMode{
+	GmailLabelModeOff,
+	GmailLabelModeFolders,
+	GmailLabelModeKeywords,
+}
+
+// ContentDedup matches messages without a Message-ID against the
+// destination folder by a digest of their content.
+type ContentDedup string
+
+const (
+	ContentDedupOff     ContentDedup = "off"
+	ContentDedupHeaders ContentDedup = "headers"
+	ContentDedupBody    ContentDedup = "body"
+)
+
+var ContentDedups = []ContentDedup{
+	ContentDedupOff,
+	ContentDedupHeaders,
+	ContentDedupBody,
+}
+
+// DeletionPolicy decides what a two-way sync does with a message deleted on
+// one side whose copy still exists on the other.
+type DeletionPolicy string
+
+const (
+	DeletionPolicyKeep      DeletionPolicy = "keep"
+	DeletionPolicyPropagate DeletionPolicy = "propagate"
+	DeletionPolicyRestore   DeletionPolicy = "restore"
+)
+
+var DeletionPolicies = []DeletionPolicy{
+	DeletionPolicyKeep,
+	DeletionPolicyPropagate,
+	DeletionPolicyRestore,
+}
+
+const DefaultMirrorMaxDeletePercent = 10
+
+// ParallelFolders is the number of folders of a mailbox migrated at once
+const (
+	DefaultParallelFolders = 1
+	MaxParallelFolders     = 10
+)
+
 type SyncList struct {
 	bun.BaseModel `bun:"table:sync_lists"`
 
-	Id                int `bun:",pk,autoincrement"`
-	UserId            int
-	Name              string
-	SrcHost           string
-	SrcPort           int
-	DstHost           string
-	DstPort           int
-	CompareMessageIds bool
-	CompareLastUid    bool
+	Id                     int `bun:",pk,autoincrement"`
+	UserId                 int
+	Name                   string
+	SrcHost                string
+	SrcPort                int
+	SrcProtocol            SourceProtocol
+	DstHost                string
+	DstPort                int
+	CompareMessageIds      bool
+	CompareLastUid         bool
+	ContentDedup           ContentDedup
+	SyncFlags              bool
+	FlagRenames            map[string]string
+	KeepDeletedFlags       bool
+	GmailLabelMode         GmailLabelMode
+	TwoWay                 bool
+	DeletionPolicy         DeletionPolicy
+	Mirror                 bool
+	MirrorMaxDeletePercent int
+	MirrorDryRun           bool
+	ParallelFolders        int
+	MaxBytesPerSecond      int
+	MaxMessagesPerSecond   int
+	NotifiedAt             *time.Time `bun:",nullzero"`
+	Schedule               *string    `bun:",nullzero"`
+	NextRunAt              *time.Time `bun:",nullzero"`
+	LastRunAt              *time.Time `bun:",nullzero"`
+	FinalSyncStartedAt     *time.Time `bun:",nullzero"`
+	CutOverAt              *time.Time `bun:",nullzero"`
 
 	Mailboxes []*Mailbox `bun:"rel:has-many,join:id=sync_list_id"`
 }
@@ -40,29 +131,111 @@ type SyncListStatus struct {
 }
 
 type CreateSyncListParams struct {
-	UserId            int
-	Name              string
-	SrcHost           string
-	SrcPort           int
-	DstHost           string
-	DstPort           int
-	CompareMessageIds bool
-	CompareLastUid    bool
+	UserId                 int
+	Name                   string
+	SrcHost                string
+	SrcPort                int
+	SrcProtocol            SourceProtocol
+	DstHost                string
+	DstPort                int
+	CompareMessageIds      bool
+	CompareLastUid         bool
+	ContentDedup           ContentDedup
+	SyncFlags              bool
+	FlagRenames            map[string]string
+	KeepDeletedFlags       bool
+	GmailLabelMode         GmailLabelMode
+	TwoWay                 bool
+	DeletionPolicy         DeletionPolicy
+	Mirror                 bool
+	MirrorMaxDeletePercent int
+	MirrorDryRun           bool
+	ParallelFolders        int
+	MaxBytesPerSecond      int
+	MaxMessagesPerSecond   int
+	Schedule               string
+}
+
+// ApplySchedule stores the schedule spec and computes the next run from now.
+// An empty spec disables scheduling. The next run is kept when the spec did
+// not change, so editing other fields does not postpone a pending run.
+func (l *SyncList) ApplySchedule(spec string, now time.Time) error {
+	if spec == "" {
+		l.Schedule = nil
+		l.NextRunAt = nil
+		return nil
+	}
+
+	if l.Schedule != nil && *l.Schedule == spec && l.NextRunAt != nil {
+		return nil
+	}
+
+	schedule, err := helpers.ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	next := schedule.Next(now)
+	l.Schedule = &spec
+	l.NextRunAt = &next
+
+	return nil
 }
 
 func CreateSyncList(ctx context.Context, params CreateSyncListParams) (*SyncList, error) {
+	if params.FlagRenames == nil {
+		params.FlagRenames = make(map[string]string)
+	}
+	if params.ContentDedup == "" {
+		params.ContentDedup = ContentDedupOff
+	}
+	if params.SrcProtocol == "" {
+		params.SrcProtocol = SourceProtocolImap
+	}
+	if params.GmailLabelMode == "" {
+		params.GmailLabelMode = GmailLabelModeOff
+	}
+	if params.DeletionPolicy == "" {
+		params.DeletionPolicy = DeletionPolicyKeep
+	}
+	if params.MirrorMaxDeletePercent == 0 {
+		params.MirrorMaxDeletePercent = DefaultMirrorMaxDeletePercent
+	}
+	if params.ParallelFolders == 0 {
+		params.ParallelFolders = DefaultParallelFolders
+	}
+
 	syncList := &SyncList{
-		UserId:            params.UserId,
-		Name:              params.Name,
-		SrcHost:           params.SrcHost,
-		SrcPort:           params.SrcPort,
-		DstHost:           params.DstHost,
-		DstPort:           params.DstPort,
-		CompareMessageIds: params.CompareMessageIds,
-		CompareLastUid:    params.CompareLastUid,
+		UserId:                 params.UserId,
+		Name:                   params.Name,
+		SrcHost:                params.SrcHost,
+		SrcPort:                params.SrcPort,
+		SrcProtocol:            params.SrcProtocol,
+		DstHost:                params.DstHost,
+		DstPort:                params.DstPort,
+		CompareMessageIds:      params.CompareMessageIds,
+		CompareLastUid:         params.CompareLastUid,
+		ContentDedup:           params.ContentDedup,
+		SyncFlags:              params.SyncFlags,
+		FlagRenames:            params.FlagRenames,
+		KeepDeletedFlags:       params.KeepDeletedFlags,
+		GmailLabelMode:         params.GmailLabelMode,
+		TwoWay:                 params.TwoWay,
+		DeletionPolicy:         params.DeletionPolicy,
+		Mirror:                 params.Mirror,
+		MirrorMaxDeletePercent: params.MirrorMaxDeletePercent,
+		MirrorDryRun:           params.MirrorDryRun,
+		ParallelFolders:        params.ParallelFolders,
+		MaxBytesPerSecond:      params.MaxBytesPerSecond,
+		MaxMessagesPerSecond:   params.MaxMessagesPerSecond,
 	}
 
-	_, err := db.Bun.
+	err := syncList.ApplySchedule(params.Schedule, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Bun.
 		NewInsert().
 		Model(syncList).
 		Exec(ctx)
@@ -203,6 +376,102 @@ func UpdateSyncList(ctx context.Context, syncList *SyncList) error {
 	return nil
 }
 
+func FindDueSyncLists(ctx context.Context, now time.Time) ([]*SyncList, error) {
+	syncLists := make([]*SyncList, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&syncLists).
+		Where("next_run_at IS NOT NULL").
+		Where("next_run_at <= ?", now).
+		OrderBy("next_run_at", bun.OrderAsc).
+		Scan(ctx)
+
+	return syncLists, err
+}
+
+// ClaimSyncListRun moves a due sync list to its next run, provided no other
+// instance did so first. It reports whether the caller should enqueue the run.
+func ClaimSyncListRun(ctx context.Context, id int, dueAt time.Time, nextRunAt time.Time, now time.Time) (bool, error) {
+	res, err := db.Bun.
+		NewUpdate().
+		Model((*SyncList)(nil)).
+		Set("next_run_at = ?", nextRunAt).
+		Set("last_run_at = ?", now).
+		Where("id = ?", id).
+		Where("next_run_at = ?", dueAt).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// IsFinalSync reports whether the cutover pass was started, every migration
+// of the list is then a final sync.
+func (l *SyncList) IsFinalSync() bool {
+	return l.FinalSyncStartedAt != nil
+}
+
+// IsCutOver reports whether every mailbox completed its final sync, the list
+// is read-only from then on.
+func (l *SyncList) IsCutOver() bool {
+	return l.CutOverAt != nil
+}
+
+// MarkSyncListCutOver reports whether the list was not already cut over.
+func MarkSyncListCutOver(ctx context.Context, id int, now time.Time) (bool, error) {
+	res, err := db.Bun.
+		NewUpdate().
+		Model((*SyncList)(nil)).
+		Set("cut_over_at = ?", now).
+		Set("schedule = NULL").
+		Set("next_run_at = NULL").
+		Where("id = ?", id).
+		Where("final_sync_started_at IS NOT NULL").
+		Where("cut_over_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// ClaimSyncListNotification marks the sync list as notified unless a
+// notification was already sent after since. It reports whether the caller
+// won the claim, so concurrent workers send a single summary per run.
+func ClaimSyncListNotification(ctx context.Context, id int, since time.Time) (bool, error) {
+	res, err := db.Bun.
+		NewUpdate().
+		Model((*SyncList)(nil)).
+		Set("notified_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("notified_at IS NULL OR notified_at < ?", since).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
 func DeleteSyncListById(ctx context.Context, id int) error {
 	accounts, err := FindMailboxesBySyncListId(ctx, id)
 	if err == nil {
@@ -8,6 +8,20 @@ import (
 	"github.com/uptrace/bun"
 )
 
+type NotificationPreference string
+
+const (
+	NotificationPreferenceImmediate NotificationPreference = "immediate"
+	NotificationPreferenceSummary   NotificationPreference = "summary"
+	NotificationPreferenceOff       NotificationPreference = "off"
+)
+
+var NotificationPreferences = []NotificationPreference{
+	NotificationPreferenceImmediate,
+	NotificationPreferenceSummary,
+	NotificationPreferenceOff,
+}
+
 type User struct {
 	bun.BaseModel `bun:"table:users"`
 
@@ -19,7 +33,8 @@ type User struct {
 	ConfirmationExpiresAt  *time.Time `bun:",nullzero,default:null"`
 	PasswordResetTokenHash *string    `bun:",nullzero,default:null"`
 	PasswordResetExpiresAt *time.Time `bun:",nullzero,default:null"`
-	CreatedAt              time.Time  `bun:",default:current_timestamp"`
+	NotificationPreference NotificationPreference
+	CreatedAt              time.Time `bun:",default:current_timestamp"`
 }
 
 func CreateUser(ctx context.Context, email string, passwordHash string, confirmationTokenHash string, confirmationExpiresAt time.Time) (*User, error) {
@@ -31,6 +46,7 @@ func CreateUser(ctx context.Context, email string, passwordHash string, confirma
 		ConfirmationExpiresAt:  &confirmationExpiresAt,
 		PasswordResetTokenHash: nil,
 		PasswordResetExpiresAt: nil,
+		NotificationPreference: NotificationPreferenceSummary,
 		CreatedAt:              time.Now(),
 	}
 
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"app/db"
+	"app/helpers"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type WebhookEvent string
+
+const (
+	WebhookEventJobQueued      WebhookEvent = "job.queued"
+	WebhookEventJobStarted     WebhookEvent = "job.started"
+	WebhookEventJobCompleted   WebhookEvent = "job.completed"
+	WebhookEventJobFailed      WebhookEvent = "job.failed"
+	WebhookEventJobInterrupted WebhookEvent = "job.interrupted"
+)
+
+var WebhookEvents = []WebhookEvent{
+	WebhookEventJobQueued,
+	WebhookEventJobStarted,
+	WebhookEventJobCompleted,
+	WebhookEventJobFailed,
+	WebhookEventJobInterrupted,
+}
+
+// WebhookEventForJobStatus maps a job status to the event announcing it.
+func WebhookEventForJobStatus(status JobStatus) (WebhookEvent, bool) {
+	switch status {
+	case JobStatusPending:
+		return WebhookEventJobQueued, true
+	case JobStatusRunning:
+		return WebhookEventJobStarted, true
+	case JobStatusCompleted:
+		return WebhookEventJobCompleted, true
+	case JobStatusFailed:
+		return WebhookEventJobFailed, true
+	case JobStatusInterrupted:
+		return WebhookEventJobInterrupted, true
+	default:
+		return "", false
+	}
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed"
+)
+
+type Webhook struct {
+	bun.BaseModel `bun:"table:webhooks"`
+
+	Id         int `bun:",pk,autoincrement"`
+	UserId     int
+	Url        string
+	SecretHash string
+	Events     []WebhookEvent
+	CreatedAt  time.Time `bun:",default:current_timestamp"`
+}
+
+func (w *Webhook) Subscribes(event WebhookEvent) bool {
+	return slices.Contains(w.Events, event)
+}
+
+type WebhookDelivery struct {
+	bun.BaseModel `bun:"table:webhook_deliveries"`
+
+	Id             int `bun:",pk,autoincrement"`
+	WebhookId      int
+	Event          WebhookEvent
+	Payload        json.RawMessage
+	Status         WebhookDeliveryStatus
+	Attempts       int
+	ResponseStatus *int       `bun:",nullzero"`
+	Error          *string    `bun:",nullzero"`
+	CreatedAt      time.Time  `bun:",default:current_timestamp"`
+	DeliveredAt    *time.Time `bun:",nullzero"`
+
+	Webhook *Webhook `bun:"rel:belongs-to,join:webhook_id=id"`
+}
+
+type WebhookDeliveriesPaginated struct {
+	Deliveries []*WebhookDelivery
+	Pagination helpers.Pagination
+}
+
+func CreateWebhook(ctx context.Context, userId int, url string, secretHash string, events []WebhookEvent) (*Webhook, error) {
+	webhook := &Webhook{
+		UserId:     userId,
+		Url:        url,
+		SecretHash: secretHash,
+		Events:     events,
+		CreatedAt:  time.Now(),
+	}
+
+	_, err := db.Bun.
+		NewInsert().
+		Model(webhook).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func FindWebhookById(ctx context.Context, id int) (*Webhook, error) {
+	webhook := new(Webhook)
+
+	err := db.Bun.
+		NewSelect().
+		Model(webhook).
+		Where("id = ?", id).
+		Scan(ctx)
+
+	return webhook, err
+}
+
+func FindWebhooksByUserId(ctx context.Context, userId int) ([]*Webhook, error) {
+	webhooks := make([]*Webhook, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&webhooks).
+		Where("user_id = ?", userId).
+		OrderBy("created_at", bun.OrderDesc).
+		Scan(ctx)
+
+	return webhooks, err
+}
+
+func DeleteWebhookByIdAndUserId(ctx context.Context, id int, userId int) error {
+	res, err := db.Bun.
+		NewDelete().
+		Model((*Webhook)(nil)).
+		Where("id = ?", id).
+		Where("user_id = ?", userId).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func CreateWebhookDeliveries(ctx context.Context, deliveries []*WebhookDelivery) error {
+	_, err := db.Bun.
+		NewInsert().
+		Model(&deliveries).
+		Exec(ctx)
+
+	return err
+}
+
+func FindWebhookDeliveryByIdWithWebhook(ctx context.Context, id int) (*WebhookDelivery, error) {
+	delivery := new(WebhookDelivery)
+
+	err := db.Bun.
+		NewSelect().
+		Model(delivery).
+		Where("webhook_delivery.id = ?", id).
+		Relation("Webhook").
+		Scan(ctx)
+
+	return delivery, err
+}
+
+func FindWebhookDeliveriesByWebhookIdPaginated(ctx context.Context, webhookId int, page int) (*WebhookDeliveriesPaginated, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+
+	err := db.Bun.
+		NewSelect().
+		Model(&deliveries).
+		Where("webhook_id = ?", webhookId).
+		Limit(helpers.PaginationLimit).
+		Offset((page-1)*helpers.PaginationLimit).
+		OrderBy("created_at", bun.OrderDesc).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := db.Bun.
+		NewSelect().
+		Model((*WebhookDelivery)(nil)).
+		Where("webhook_id = ?", webhookId).
+		Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveriesPaginated := &WebhookDeliveriesPaginated{
+		Deliveries: deliveries,
+		Pagination: helpers.NewPagination(page, total),
+	}
+
+	return deliveriesPaginated, nil
+}
+
+func UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	_, err := db.Bun.
+		NewUpdate().
+		Model(delivery).
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
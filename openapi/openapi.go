@@ -0,0 +1,263 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Document is a minimal OpenAPI 3.1 document. Schemas are generated from the
+// Go types handlers encode, so the document cannot drift from the responses.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+	Security   []map[string][]string            `json:"security,omitempty"`
+
+	problemType reflect.Type
+	enums       map[reflect.Type][]string
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type Operation struct {
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+// Route describes one operation. Request and Response are zero values of the
+// Go types used for the bodies, or nil when there is no body.
+type Route struct {
+	Method   string
+	Path     string
+	Summary  string
+	Tag      string
+	Query    []string
+	Request  any
+	Response any
+	Status   int
+}
+
+var pathParamRe = regexp.MustCompile(`:(\w+)`)
+
+func New(title string, version string) *Document {
+	return &Document{
+		OpenAPI: "3.1.0",
+		Info: Info{
+			Title:   title,
+			Version: version,
+		},
+		Paths: make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+		enums: make(map[reflect.Type][]string),
+	}
+}
+
+// SetProblemType sets the body documented as the default error response.
+func (d *Document) SetProblemType(value any) {
+	d.problemType = reflect.TypeOf(value)
+}
+
+// RegisterEnum lists the allowed values of a named string type.
+func (d *Document) RegisterEnum(value any, values ...string) {
+	d.enums[reflect.TypeOf(value)] = values
+}
+
+func (d *Document) AddRoute(r Route) {
+	path := pathParamRe.ReplaceAllString(r.Path, "{$1}")
+
+	op := &Operation{
+		Summary:   r.Summary,
+		Responses: make(map[string]*Response),
+	}
+
+	if r.Tag != "" {
+		op.Tags = []string{r.Tag}
+	}
+
+	for _, m := range pathParamRe.FindAllStringSubmatch(r.Path, -1) {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:     m[1],
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "integer"},
+		})
+	}
+
+	for _, q := range r.Query {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:   q,
+			In:     "query",
+			Schema: &Schema{Type: "integer"},
+		})
+	}
+
+	if r.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				"application/json": {Schema: d.schemaFor(reflect.TypeOf(r.Request))},
+			},
+		}
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	res := &Response{Description: http.StatusText(status)}
+	if r.Response != nil {
+		res.Content = map[string]*MediaType{
+			"application/json": {Schema: d.schemaFor(reflect.TypeOf(r.Response))},
+		}
+	}
+	op.Responses[strconv.Itoa(status)] = res
+
+	if d.problemType != nil {
+		op.Responses["default"] = &Response{
+			Description: "Problem details",
+			Content: map[string]*MediaType{
+				"application/problem+json": {Schema: d.schemaFor(d.problemType)},
+			},
+		}
+	}
+
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]*Operation)
+	}
+	d.Paths[path][strings.ToLower(r.Method)] = op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *Document) schemaFor(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		return d.schemaFor(t.Elem())
+	}
+
+	if values, ok := d.enums[t]; ok {
+		return &Schema{Type: "string", Enum: values}
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaFor(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := d.Components.Schemas[name]; !ok {
+			schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+			// reserve the name first so recursive types terminate
+			d.Components.Schemas[name] = schema
+			d.addProperties(schema, t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+func (d *Document) addProperties(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			d.addProperties(schema, field.Type)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := d.schemaFor(field.Type)
+		if field.Type.Kind() == reflect.Pointer && fieldSchema.Ref == "" {
+			fieldSchema.Type = []any{fieldSchema.Type, "null"}
+		}
+		schema.Properties[name] = fieldSchema
+
+		if field.Type.Kind() != reflect.Pointer && !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
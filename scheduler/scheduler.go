@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"app/helpers"
+	"app/jobs"
+	"app/models"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const tickInterval = 30 * time.Second
+
+// StartScheduler enqueues migrations of sync lists whose next run is due and
+// releases delayed jobs. Every instance runs it, a run is claimed with a
+// compare-and-set on next_run_at so each run is enqueued once per cluster.
+func StartScheduler(ctx context.Context) {
+	slog.Info("scheduler: started")
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		runDueSyncLists(ctx)
+		releaseDelayedJobs(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("scheduler: stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runDueSyncLists(ctx context.Context) {
+	now := time.Now()
+
+	lists, err := models.FindDueSyncLists(ctx, now)
+	if err != nil {
+		slog.Error("scheduler: failed to find due sync lists", "error", err)
+		return
+	}
+
+	for _, list := range lists {
+		err := runSyncList(ctx, list, now)
+		if err != nil {
+			slog.Error("scheduler: failed to run sync list", "list", list.Id, "error", err)
+		}
+	}
+}
+
+// releaseDelayedJobs hands due delayed jobs to the workers, they wait up to a
+// tick past their time.
+func releaseDelayedJobs(ctx context.Context) {
+	err := models.ReleaseDelayedJobs(ctx, time.Now())
+	if err != nil {
+		slog.Error("scheduler: failed to release delayed jobs", "error", err)
+	}
+}
+
+func runSyncList(ctx context.Context, list *models.SyncList, now time.Time) error {
+	if list.Schedule == nil || list.NextRunAt == nil {
+		return nil
+	}
+
+	schedule, err := helpers.ParseSchedule(*list.Schedule)
+	if err != nil {
+		return err
+	}
+
+	// Runs missed while no instance was up collapse into this one
+	claimed, err := models.ClaimSyncListRun(ctx, list.Id, *list.NextRunAt, schedule.Next(now), now)
+	if err != nil || !claimed {
+		return err
+	}
+
+	slog.Info("scheduler: starting sync list", "list", list.Id)
+
+	list, err = models.FindSyncListByIdWithMailboxes(ctx, list.Id)
+	if err != nil {
+		return err
+	}
+
+	err = jobs.EnqueueSyncListMigration(ctx, list, list.UserId)
+	if errors.Is(err, jobs.ErrLiveSyncActive) {
+		slog.Info("scheduler: skipped sync list with live sync", "list", list.Id)
+		return nil
+	}
+
+	return err
+}
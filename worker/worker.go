@@ -27,16 +27,38 @@ type runningJob struct {
 
 type JobFactory func(ctx context.Context, payload *json.RawMessage) (JobHandler, error)
 
+// JobListener is notified after a job's status has been persisted.
+type JobListener func(ctx context.Context, job *models.Job)
+
 var runningJobs = map[int]*runningJob{}
 var runningJobsMu sync.Mutex
 
 // Immutable after app.RegisterJobs()
 var jobHandlerRegistry = make(map[models.JobType]JobFactory)
+var longRunningJobTypes = make(map[models.JobType]bool)
+var jobListeners = make([]JobListener, 0)
 
 func RegisterJob(jobType models.JobType, factory JobFactory) {
 	jobHandlerRegistry[jobType] = factory
 }
 
+// RegisterLongRunningJob registers a job that runs until it is cancelled. It
+// is not bound by the job timeout and does not occupy a worker slot.
+func RegisterLongRunningJob(jobType models.JobType, factory JobFactory) {
+	jobHandlerRegistry[jobType] = factory
+	longRunningJobTypes[jobType] = true
+}
+
+func RegisterJobListener(listener JobListener) {
+	jobListeners = append(jobListeners, listener)
+}
+
+func notifyJobListeners(ctx context.Context, job *models.Job) {
+	for _, listener := range jobListeners {
+		listener(ctx, job)
+	}
+}
+
 func GetRunningJob(id int) *runningJob {
 	runningJobsMu.Lock()
 	defer runningJobsMu.Unlock()
@@ -51,6 +73,9 @@ func GetRunningJob(id int) *runningJob {
 func StartWorker(ctx context.Context, notifyChan <-chan pgdriver.Notification) {
 	slog.Info("worker: started")
 
+	var longRunningWg sync.WaitGroup
+	defer longRunningWg.Wait()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -66,6 +91,21 @@ func StartWorker(ctx context.Context, notifyChan <-chan pgdriver.Notification) {
 				continue
 			}
 
+			if longRunningJobTypes[job.Type] {
+				// Claimed before handing off so the next notification skips it
+				job.Status = models.JobStatusRunning
+				err = models.UpdateJob(ctx, job)
+				if err != nil {
+					slog.Error("worker: failed to claim job", "job", job.Id, "error", err)
+					continue
+				}
+
+				longRunningWg.Go(func() {
+					runJob(ctx, job)
+				})
+				continue
+			}
+
 			runJob(ctx, job)
 		}
 	}
@@ -106,15 +146,20 @@ func runJob(workerCtx context.Context, job *models.Job) {
 			return
 		}
 
-		err = GetRunningJob(job.Id).Handler.OnStop(workerCtx)
-		if err != nil {
-			slog.Error("worker: failed to run OnStop", "job", job.Id, "error", err.Error())
-			return
+		// The handler is missing when the factory failed
+		running := GetRunningJob(job.Id)
+		if running != nil {
+			err = running.Handler.OnStop(workerCtx)
+			if err != nil {
+				slog.Error("worker: failed to run OnStop", "job", job.Id, "error", err.Error())
+			}
+
+			runningJobsMu.Lock()
+			delete(runningJobs, job.Id)
+			runningJobsMu.Unlock()
 		}
 
-		runningJobsMu.Lock()
-		delete(runningJobs, job.Id)
-		runningJobsMu.Unlock()
+		notifyJobListeners(workerCtx, job)
 	}()
 
 	slog.Info("worker: job started", "job", job.Id)
@@ -127,8 +172,15 @@ func runJob(workerCtx context.Context, job *models.Job) {
 		slog.Error("worker: failed to update starting job", "job", job.Id, "error", err.Error())
 		return
 	}
-
-	jobCtx, cancelJob := context.WithTimeout(workerCtx, time.Duration(config.Config.JobTimeoutMinutes)*time.Minute)
+	notifyJobListeners(workerCtx, job)
+
+	var jobCtx context.Context
+	var cancelJob context.CancelFunc
+	if longRunningJobTypes[job.Type] {
+		jobCtx, cancelJob = context.WithCancel(workerCtx)
+	} else {
+		jobCtx, cancelJob = context.WithTimeout(workerCtx, time.Duration(config.Config.JobTimeoutMinutes)*time.Minute)
+	}
 	defer cancelJob()
 
 	factory, ok := jobHandlerRegistry[job.Type]
@@ -138,6 +190,9 @@ func runJob(workerCtx context.Context, job *models.Job) {
 		return
 	}
 	handler, err := factory(jobCtx, job.Payload)
+	if err != nil {
+		return
+	}
 
 	runningJobsMu.Lock()
 	runningJobs[job.Id] = &runningJob{